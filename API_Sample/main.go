@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // User represents a user entity
 type User struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Deleted bool   `json:"deleted"`
 }
 
 var users = []User{
@@ -20,10 +31,299 @@ var users = []User{
 	{ID: 2, Name: "Jane Smith", Email: "jane@example.com"},
 }
 
-// GetUsers handles GET requests to fetch all users
+// correlationHeader carries the ID used to follow one request across services
+const correlationHeader = "X-Correlation-ID"
+
+// correlationKey is the context key under which the correlation ID is stored
+type correlationKey struct{}
+
+// CorrelationID returns the correlation ID stored in ctx, or "" if there is none
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// logf logs a message prefixed with the request's correlation ID
+func logf(r *http.Request, format string, args ...interface{}) {
+	log.Printf("[%s] "+format, append([]interface{}{CorrelationID(r.Context())}, args...)...)
+}
+
+// newCorrelationID generates a random 16-byte hex ID
+func newCorrelationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// CorrelationMiddleware reuses the caller's X-Correlation-ID or generates one,
+// stores it in the request context, echoes it in the response and logs the
+// start and end of the request with it.
+func CorrelationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(correlationHeader)
+		if id == "" {
+			id = newCorrelationID()
+		}
+		r = r.WithContext(context.WithValue(r.Context(), correlationKey{}, id))
+		w.Header().Set(correlationHeader, id)
+
+		start := time.Now()
+		logf(r, "%s %s started", r.Method, r.URL.Path)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		logf(r, "%s %s completed with %d in %s", r.Method, r.URL.Path, rec.status, time.Since(start))
+	})
+}
+
+// auditFile receives every audit record as a JSON line, in addition to the
+// in-memory log served by GET /audit
+const auditFile = "audit.log"
+
+// AuditRecord describes one mutation: who made it, what it was and the user
+// record before and after it (Before is nil for creates).
+type AuditRecord struct {
+	Time          time.Time `json:"time"`
+	Actor         string    `json:"actor"`
+	Action        string    `json:"action"`
+	UserID        int       `json:"user_id"`
+	Before        *User     `json:"before,omitempty"`
+	After         *User     `json:"after,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+}
+
+var (
+	auditMu  sync.Mutex
+	auditLog []AuditRecord
+)
+
+// actor identifies the caller from basic auth or the X-User header
+func actor(r *http.Request) string {
+	if username, _, ok := r.BasicAuth(); ok && username != "" {
+		return username
+	}
+	if user := r.Header.Get("X-User"); user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// audit records a mutation in memory and appends it to auditFile. Before and
+// after are copied so later changes to the users slice don't rewrite history.
+func audit(r *http.Request, action string, userID int, before, after *User) {
+	record := AuditRecord{
+		Time:          time.Now().UTC(),
+		Actor:         actor(r),
+		Action:        action,
+		UserID:        userID,
+		CorrelationID: CorrelationID(r.Context()),
+	}
+	if before != nil {
+		copied := *before
+		record.Before = &copied
+	}
+	if after != nil {
+		copied := *after
+		record.After = &copied
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditLog = append(auditLog, record)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		logf(r, "audit: marshal record: %v", err)
+		return
+	}
+	file, err := os.OpenFile(auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logf(r, "audit: open %s: %v", auditFile, err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		logf(r, "audit: write %s: %v", auditFile, err)
+	}
+}
+
+// GetAudit handles GET /audit, returning audit records oldest first.
+// Optional filters: ?action=create|update|delete|restore, ?user_id=, ?actor= and
+// ?since= (RFC 3339 time).
+func GetAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	userID := 0
+	if value := query.Get("user_id"); value != "" {
+		var err error
+		if userID, err = strconv.Atoi(value); err != nil || userID <= 0 {
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+	}
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Invalid since, expected RFC 3339", http.StatusBadRequest)
+			return
+		}
+	}
+
+	auditMu.Lock()
+	result := []AuditRecord{}
+	for _, record := range auditLog {
+		if action := query.Get("action"); action != "" && record.Action != action {
+			continue
+		}
+		if who := query.Get("actor"); who != "" && record.Actor != who {
+			continue
+		}
+		if userID != 0 && record.UserID != userID {
+			continue
+		}
+		if !since.IsZero() && record.Time.Before(since) {
+			continue
+		}
+		result = append(result, record)
+	}
+	auditMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// includeDeleted reports whether the request asked for soft-deleted users too
+func includeDeleted(r *http.Request) bool {
+	return r.URL.Query().Get("include_deleted") == "true"
+}
+
+// defaultPageSize and maxPageSize bound the limit query parameter
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// UserPage is the response for cursor pagination. NextCursor is empty on the last page.
+type UserPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// encodeCursor turns the last ID seen into an opaque cursor string
+func encodeCursor(lastID int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("id:" + strconv.Itoa(lastID)))
+}
+
+// decodeCursor returns the last ID seen from a cursor; "" starts at the beginning
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(string(raw), "id:"))
+	if err != nil || !strings.HasPrefix(string(raw), "id:") || id < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return id, nil
+}
+
+// parseLimit reads ?limit=, falling back to defaultPageSize and capping at maxPageSize
+func parseLimit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("invalid limit")
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return limit, nil
+}
+
+// GetUsers handles GET requests to fetch all users.
+// Soft-deleted users are left out unless ?include_deleted=true is given.
+//
+// Pagination is optional:
+//   - ?cursor=...&limit=... returns a UserPage. Start with an empty cursor and
+//     pass next_cursor back to get the following page. The cursor holds the
+//     last ID returned, so pages stay stable when users are added or removed.
+//   - ?offset=...&limit=... returns a plain list starting at offset.
+//   - Without either, every user is returned.
 func GetUsers(w http.ResponseWriter, r *http.Request) {
+	result := []User{}
+	for _, user := range users {
+		if !user.Deleted || includeDeleted(r) {
+			result = append(result, user)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	query := r.URL.Query()
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+
+	switch {
+	case query.Has("cursor"):
+		lastID, err := decodeCursor(query.Get("cursor"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit, err := parseLimit(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Skip everything up to and including the last ID seen
+		start := sort.Search(len(result), func(i int) bool { return result[i].ID > lastID })
+		end := min(start+limit, len(result))
+		page := UserPage{Users: result[start:end]}
+		if end < len(result) {
+			page.NextCursor = encodeCursor(result[end-1].ID)
+		}
+		json.NewEncoder(w).Encode(page)
+
+	case query.Has("offset") || query.Has("limit"):
+		offset := 0
+		if value := query.Get("offset"); value != "" {
+			var err error
+			offset, err = strconv.Atoi(value)
+			if err != nil || offset < 0 {
+				http.Error(w, "invalid offset", http.StatusBadRequest)
+				return
+			}
+		}
+		limit, err := parseLimit(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		start := min(offset, len(result))
+		end := min(start+limit, len(result))
+		json.NewEncoder(w).Encode(result[start:end])
+
+	default:
+		json.NewEncoder(w).Encode(result)
+	}
 }
 
 // GetUser handles GET requests to fetch a single user by ID
@@ -35,7 +335,7 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, user := range users {
-		if user.ID == id {
+		if user.ID == id && (!user.Deleted || includeDeleted(r)) {
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(user)
 			return
@@ -49,6 +349,7 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 func CreateUser(w http.ResponseWriter, r *http.Request) {
 	var newUser User
 	if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
+		logf(r, "invalid user payload: %v", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -56,13 +357,15 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	// Assign a new ID
 	newUser.ID = len(users) + 1
 	users = append(users, newUser)
+	audit(r, "create", newUser.ID, nil, &newUser)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(newUser)
 }
 
-// DeleteUser handles DELETE requests to remove a user by ID
+// DeleteUser handles DELETE requests to soft-delete a user by ID.
+// The record is kept and flagged as deleted so it can be audited and restored.
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get("id"))
 	if err != nil || id <= 0 {
@@ -71,8 +374,9 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for index, user := range users {
-		if user.ID == id {
-			users = append(users[:index], users[index+1:]...)
+		if user.ID == id && !user.Deleted {
+			users[index].Deleted = true
+			audit(r, "delete", id, &user, &users[index])
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
@@ -81,14 +385,627 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "User not found", http.StatusNotFound)
 }
 
+// RestoreUser handles POST /users/{id}/restore to undo a soft delete
+func RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	for index, user := range users {
+		if user.ID == id {
+			if !user.Deleted {
+				http.Error(w, "User is not deleted", http.StatusConflict)
+				return
+			}
+			users[index].Deleted = false
+			audit(r, "restore", id, &user, &users[index])
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(users[index])
+			return
+		}
+	}
+
+	http.Error(w, "User not found", http.StatusNotFound)
+}
+
+// GraphQL endpoint
+//
+// POST /graphql (or GET /graphql?query=...) serves the same users as the REST
+// routes through a small GraphQL schema:
+//
+//	type User {
+//	  id: Int!
+//	  name: String!
+//	  email: String!
+//	  deleted: Boolean!
+//	}
+//	type Query {
+//	  users(includeDeleted: Boolean): [User!]!
+//	  user(id: Int!): User
+//	  searchUsers(query: String!): [User!]!  # case-insensitive, name or email
+//	}
+//	type Mutation {
+//	  createUser(name: String!, email: String!): User!
+//	  updateUser(id: Int!, name: String, email: String): User
+//	  deleteUser(id: Int!): Boolean!
+//	}
+//
+// The request body is {"query": "...", "variables": {...}, "operationName": "..."}.
+// Queries support aliases, arguments, variables and __typename; fragments and
+// directives are not supported. Mutations are audited like their REST
+// counterparts.
+
+// gqlRequest is the body of a GraphQL request
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// gqlField is one field of a selection set
+type gqlField struct {
+	alias, name string
+	args        map[string]interface{} // literal values, or gqlVariable
+	selection   []gqlField
+}
+
+// gqlVariable is a $name reference in an argument, resolved at execution
+type gqlVariable string
+
+type gqlOperation struct {
+	kind, name string
+	selection  []gqlField
+}
+
+// gqlObject is a result object that keeps its fields in query order
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value interface{}
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.key)
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+// gqlParser is a recursive descent parser over the query text
+type gqlParser struct {
+	src string
+	pos int
+}
+
+func (p *gqlParser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next significant byte, or 0 at the end
+func (p *gqlParser) peek() byte {
+	p.skipIgnored()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *gqlParser) expect(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("syntax error at offset %d: expected %q", p.pos, c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	p.skipIgnored()
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (p.pos > start && c >= '0' && c <= '9') {
+			p.pos++
+			continue
+		}
+		break
+	}
+	if start == p.pos {
+		return "", fmt.Errorf("syntax error at offset %d: expected a name", p.pos)
+	}
+	return p.src[start:p.pos], nil
+}
+
+// document parses the operations of a query
+func (p *gqlParser) document() ([]gqlOperation, error) {
+	var operations []gqlOperation
+	for p.peek() != 0 {
+		op := gqlOperation{kind: "query"}
+		if p.peek() != '{' {
+			kind, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if kind != "query" && kind != "mutation" {
+				return nil, fmt.Errorf("unsupported definition %q", kind)
+			}
+			op.kind = kind
+			if c := p.peek(); c != '{' && c != '(' {
+				if op.name, err = p.name(); err != nil {
+					return nil, err
+				}
+			}
+			if p.peek() == '(' {
+				if err := p.skipVariableDefinitions(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		selection, err := p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+		op.selection = selection
+		operations = append(operations, op)
+	}
+	if len(operations) == 0 {
+		return nil, errors.New("no operation in query")
+	}
+	return operations, nil
+}
+
+// skipVariableDefinitions skips "($id: Int!, ...)"; values come from the
+// request's variables and are checked by the resolvers
+func (p *gqlParser) skipVariableDefinitions() error {
+	depth := 0
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return nil
+			}
+		}
+		p.pos++
+	}
+	return errors.New("syntax error: unterminated variable definitions")
+}
+
+func (p *gqlParser) selectionSet() ([]gqlField, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	var fields []gqlField
+	for p.peek() != '}' {
+		if p.peek() == 0 {
+			return nil, errors.New("syntax error: unterminated selection set")
+		}
+		if p.peek() == '.' || p.peek() == '@' {
+			return nil, errors.New("fragments and directives are not supported")
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		field := gqlField{alias: name, name: name}
+		if p.peek() == ':' {
+			p.pos++
+			if field.name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek() == '(' {
+			p.pos++
+			field.args = make(map[string]interface{})
+			for p.peek() != ')' {
+				argName, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(':'); err != nil {
+					return nil, err
+				}
+				if field.args[argName], err = p.value(); err != nil {
+					return nil, err
+				}
+			}
+			p.pos++
+		}
+		if p.peek() == '{' {
+			if field.selection, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		fields = append(fields, field)
+	}
+	p.pos++
+	return fields, nil
+}
+
+// value parses an argument value: a variable, number, string, boolean, null
+// or enum name
+func (p *gqlParser) value() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '$':
+		p.pos++
+		name, err := p.name()
+		return gqlVariable(name), err
+	case c == '"':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			return nil, errors.New("syntax error: unterminated string")
+		}
+		p.pos++
+		var str string
+		if err := json.Unmarshal([]byte(p.src[start:p.pos]), &str); err != nil {
+			return nil, fmt.Errorf("syntax error: invalid string at offset %d", start)
+		}
+		return str, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		var number float64
+		if err := json.Unmarshal([]byte(p.src[start:p.pos]), &number); err != nil {
+			return nil, fmt.Errorf("syntax error: invalid number at offset %d", start)
+		}
+		return number, nil
+	default:
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return name, nil
+	}
+}
+
+// gqlArgs reads a field's arguments, substituting variables
+type gqlArgs struct {
+	field     gqlField
+	variables map[string]interface{}
+}
+
+func (a gqlArgs) get(name string) (interface{}, bool) {
+	value, ok := a.field.args[name]
+	if variable, isVar := value.(gqlVariable); isVar {
+		value, ok = a.variables[string(variable)]
+	}
+	return value, ok && value != nil
+}
+
+func (a gqlArgs) intArg(name string, required bool) (int, bool, error) {
+	value, ok := a.get(name)
+	if !ok {
+		if required {
+			return 0, false, fmt.Errorf("%s: argument %q is required", a.field.name, name)
+		}
+		return 0, false, nil
+	}
+	number, isNumber := value.(float64)
+	if !isNumber || number != float64(int(number)) {
+		return 0, false, fmt.Errorf("%s: argument %q must be an Int", a.field.name, name)
+	}
+	return int(number), true, nil
+}
+
+func (a gqlArgs) stringArg(name string, required bool) (string, bool, error) {
+	value, ok := a.get(name)
+	if !ok {
+		if required {
+			return "", false, fmt.Errorf("%s: argument %q is required", a.field.name, name)
+		}
+		return "", false, nil
+	}
+	str, isString := value.(string)
+	if !isString {
+		return "", false, fmt.Errorf("%s: argument %q must be a String", a.field.name, name)
+	}
+	return str, true, nil
+}
+
+func (a gqlArgs) boolArg(name string) (bool, error) {
+	value, ok := a.get(name)
+	if !ok {
+		return false, nil
+	}
+	b, isBool := value.(bool)
+	if !isBool {
+		return false, fmt.Errorf("%s: argument %q must be a Boolean", a.field.name, name)
+	}
+	return b, nil
+}
+
+// findUser returns the index of the user with id, or -1
+func findUser(id int) int {
+	for index, user := range users {
+		if user.ID == id {
+			return index
+		}
+	}
+	return -1
+}
+
+// resolveRoot runs one top-level query or mutation field
+func resolveRoot(r *http.Request, kind string, field gqlField, variables map[string]interface{}) (interface{}, error) {
+	args := gqlArgs{field: field, variables: variables}
+	if field.name == "__typename" {
+		return strings.ToUpper(kind[:1]) + kind[1:], nil
+	}
+
+	if kind == "query" {
+		switch field.name {
+		case "users":
+			withDeleted, err := args.boolArg("includeDeleted")
+			if err != nil {
+				return nil, err
+			}
+			result := []User{}
+			for _, user := range users {
+				if !user.Deleted || withDeleted {
+					result = append(result, user)
+				}
+			}
+			sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+			return selectUsers(result, field.selection)
+		case "user":
+			id, _, err := args.intArg("id", true)
+			if err != nil {
+				return nil, err
+			}
+			if index := findUser(id); index >= 0 && !users[index].Deleted {
+				return selectUser(users[index], field.selection)
+			}
+			return nil, nil
+		case "searchUsers":
+			query, _, err := args.stringArg("query", true)
+			if err != nil {
+				return nil, err
+			}
+			query = strings.ToLower(query)
+			result := []User{}
+			for _, user := range users {
+				if !user.Deleted && (strings.Contains(strings.ToLower(user.Name), query) || strings.Contains(strings.ToLower(user.Email), query)) {
+					result = append(result, user)
+				}
+			}
+			return selectUsers(result, field.selection)
+		}
+		return nil, fmt.Errorf("unknown query field %q", field.name)
+	}
+
+	switch field.name {
+	case "createUser":
+		name, _, err := args.stringArg("name", true)
+		if err != nil {
+			return nil, err
+		}
+		email, _, err := args.stringArg("email", true)
+		if err != nil {
+			return nil, err
+		}
+		newUser := User{ID: len(users) + 1, Name: name, Email: email}
+		users = append(users, newUser)
+		audit(r, "create", newUser.ID, nil, &newUser)
+		return selectUser(newUser, field.selection)
+	case "updateUser":
+		id, _, err := args.intArg("id", true)
+		if err != nil {
+			return nil, err
+		}
+		name, hasName, err := args.stringArg("name", false)
+		if err != nil {
+			return nil, err
+		}
+		email, hasEmail, err := args.stringArg("email", false)
+		if err != nil {
+			return nil, err
+		}
+		index := findUser(id)
+		if index < 0 || users[index].Deleted {
+			return nil, nil
+		}
+		before := users[index]
+		if hasName {
+			users[index].Name = name
+		}
+		if hasEmail {
+			users[index].Email = email
+		}
+		audit(r, "update", id, &before, &users[index])
+		return selectUser(users[index], field.selection)
+	case "deleteUser":
+		id, _, err := args.intArg("id", true)
+		if err != nil {
+			return nil, err
+		}
+		index := findUser(id)
+		if index < 0 || users[index].Deleted {
+			return false, nil
+		}
+		before := users[index]
+		users[index].Deleted = true
+		audit(r, "delete", id, &before, &users[index])
+		return true, nil
+	}
+	return nil, fmt.Errorf("unknown mutation field %q", field.name)
+}
+
+// selectUser returns the requested fields of a user
+func selectUser(user User, selection []gqlField) (interface{}, error) {
+	if len(selection) == 0 {
+		return nil, errors.New("a selection of User fields is required")
+	}
+	var object gqlObject
+	for _, field := range selection {
+		var value interface{}
+		switch field.name {
+		case "id":
+			value = user.ID
+		case "name":
+			value = user.Name
+		case "email":
+			value = user.Email
+		case "deleted":
+			value = user.Deleted
+		case "__typename":
+			value = "User"
+		default:
+			return nil, fmt.Errorf("unknown User field %q", field.name)
+		}
+		object = append(object, gqlEntry{field.alias, value})
+	}
+	return object, nil
+}
+
+func selectUsers(list []User, selection []gqlField) (interface{}, error) {
+	result := []interface{}{}
+	for _, user := range list {
+		object, err := selectUser(user, selection)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, object)
+	}
+	return result, nil
+}
+
+// writeGraphQL writes a GraphQL response with data and/or errors
+func writeGraphQL(w http.ResponseWriter, status int, data interface{}, errs []error) {
+	response := map[string]interface{}{}
+	if data != nil {
+		response["data"] = data
+	}
+	if len(errs) > 0 {
+		messages := []map[string]string{}
+		for _, err := range errs {
+			messages = append(messages, map[string]string{"message": err.Error()})
+		}
+		response["errors"] = messages
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GraphQL handles /graphql. Field errors are reported in "errors" next to the
+// data of the fields that succeeded; malformed requests get 400.
+func GraphQL(w http.ResponseWriter, r *http.Request) {
+	var req gqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				writeGraphQL(w, http.StatusBadRequest, nil, []error{errors.New("variables must be a JSON object")})
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeGraphQL(w, http.StatusBadRequest, nil, []error{fmt.Errorf("invalid request body: %v", err)})
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parser := &gqlParser{src: req.Query}
+	operations, err := parser.document()
+	if err != nil {
+		writeGraphQL(w, http.StatusBadRequest, nil, []error{err})
+		return
+	}
+	operation := operations[0]
+	if len(operations) > 1 || req.OperationName != "" {
+		found := false
+		for _, op := range operations {
+			if op.name == req.OperationName && req.OperationName != "" {
+				operation, found = op, true
+			}
+		}
+		if !found {
+			writeGraphQL(w, http.StatusBadRequest, nil, []error{errors.New("operationName must name one of the operations")})
+			return
+		}
+	}
+	if operation.kind == "mutation" && r.Method != http.MethodPost {
+		writeGraphQL(w, http.StatusMethodNotAllowed, nil, []error{errors.New("mutations require POST")})
+		return
+	}
+
+	var data gqlObject
+	var errs []error
+	for _, field := range operation.selection {
+		value, err := resolveRoot(r, operation.kind, field, req.Variables)
+		if err != nil {
+			errs = append(errs, err)
+			value = nil
+		}
+		data = append(data, gqlEntry{field.alias, value})
+	}
+	writeGraphQL(w, http.StatusOK, data, errs)
+}
+
 func main() {
 	// Define routes
 	http.HandleFunc("/users", GetUsers)         // GET all users
 	http.HandleFunc("/user", GetUser)           // GET single user by ID
 	http.HandleFunc("/user/create", CreateUser) // POST create user
-	http.HandleFunc("/user/delete", DeleteUser) // DELETE delete user by ID
+	http.HandleFunc("/user/delete", DeleteUser) // DELETE soft-delete user by ID
+
+	http.HandleFunc("POST /users/{id}/restore", RestoreUser) // POST restore a soft-deleted user
+	http.HandleFunc("GET /audit", GetAudit)                  // GET audit log of mutations
+	http.HandleFunc("/graphql", GraphQL)                     // GraphQL queries and mutations over the same users
 
-	// Start the server
+	// Start the server; every request passes through the correlation middleware
 	fmt.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Fatal(http.ListenAndServe(":8080", CorrelationMiddleware(http.DefaultServeMux)))
 }
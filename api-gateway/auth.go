@@ -0,0 +1,157 @@
+package main
+
+/**
+JWT authentication:
+Routes listed in authRoutes only accept requests carrying a valid JSON Web
+Token, the other routes stay public:
+
+	Authorization: Bearer <header>.<payload>.<signature>
+
+Authentication is opt-in: authRoutes is empty by default, so every route is
+public until one is added, e.g.
+
+	var authRoutes = map[string]bool{
+		"/service-a": true,
+	}
+
+Tokens must be signed with HS256 (HMAC-SHA256) using the secret in the
+JWT_SECRET environment variable. JWT_SECRET is only needed once a route is
+protected; the gateway then refuses to start without it. A token is rejected with 401 when
+the header is missing or malformed, the algorithm is not HS256, the
+signature does not match, or the "exp" (expiry) or "nbf" (not before) claim
+says it is not valid at this moment.
+
+After verification the token's claims are passed to the service as compact
+JSON in the X-Auth-Claims header, e.g. {"sub":"alice","exp":1735689600},
+so services do not have to verify the token again. The header is removed
+from every incoming request first, so a client cannot forge it.
+
+crypto/hmac, crypto/sha256 and encoding/base64 are enough to verify HS256,
+so no JWT library is needed.
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// claimsHeader carries the verified claims to the services
+const claimsHeader = "X-Auth-Claims"
+
+// authRoutes lists the routes that require a valid token; none by default
+var authRoutes = map[string]bool{}
+
+// verifyJWT checks an HS256 token's signature and validity period and
+// returns its claims
+func verifyJWT(token string, secret []byte, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token must have three parts")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.New("invalid token header")
+	}
+	// Only accept the algorithm the secret is for; this also rejects "none"
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid token signature")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errors.New("invalid token signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("invalid token payload")
+	}
+	if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not valid yet")
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url JSON part of a token into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jwtSecret returns the signing secret, or exits if authenticated routes have none
+func jwtSecret() []byte {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" && len(authRoutes) > 0 {
+		log.Fatalf("JWT_SECRET must be set: %d route(s) require authentication", len(authRoutes))
+	}
+	return []byte(secret)
+}
+
+/*
+*
+AuthMiddleware: Ensures that requests to the routes in authRoutes carry a
+valid JWT, and passes its claims on in the X-Auth-Claims header. Requests to
+other routes are forwarded without a check.
+*/
+func AuthMiddleware(secret []byte, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(claimsHeader)
+
+		route, ok := routeFor(r.URL.Path)
+		if !ok || !authRoutes[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			unauthorized(w, "missing bearer token")
+			return
+		}
+		claims, err := verifyJWT(strings.TrimSpace(token), secret, time.Now())
+		if err != nil {
+			unauthorized(w, err.Error())
+			return
+		}
+
+		encoded, err := json.Marshal(claims)
+		if err != nil {
+			unauthorized(w, "invalid token payload")
+			return
+		}
+		r.Header.Set(claimsHeader, string(encoded))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// quotedStringEscaper escapes text for a quoted-string header parameter
+var quotedStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// unauthorized answers 401 with the reason the token was refused
+func unauthorized(w http.ResponseWriter, reason string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+quotedStringEscaper.Replace(reason)+`"`)
+	http.Error(w, "Unauthorized: "+reason, http.StatusUnauthorized)
+}
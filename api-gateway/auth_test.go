@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test-secret")
+
+// signJWT builds a token with the given header and claims JSON
+func signJWT(header, claims string, secret []byte) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	unsigned := encode([]byte(header)) + "." + encode([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + encode(mac.Sum(nil))
+}
+
+// useAuthRoutes protects the routes for the length of a test
+func useAuthRoutes(t *testing.T, protected ...string) {
+	t.Helper()
+	saved := authRoutes
+	authRoutes = make(map[string]bool)
+	for _, route := range protected {
+		authRoutes[route] = true
+	}
+	t.Cleanup(func() { authRoutes = saved })
+}
+
+// Authentication is opt-in: nothing is protected and no secret is needed
+// unless a route is added to authRoutes
+func TestAuthIsOptIn(t *testing.T) {
+	if len(authRoutes) != 0 {
+		t.Errorf("authRoutes protects %v by default", authRoutes)
+	}
+	t.Setenv("JWT_SECRET", "")
+	if secret := jwtSecret(); len(secret) != 0 {
+		t.Errorf("got secret %q", secret)
+	}
+}
+
+func TestVerifyJWT(t *testing.T) {
+	const hs256 = `{"alg":"HS256","typ":"JWT"}`
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", signJWT(hs256, `{"sub":"alice","exp":1700000060}`, testSecret), ""},
+		{"no expiry", signJWT(hs256, `{"sub":"alice"}`, testSecret), ""},
+		{"wrong secret", signJWT(hs256, `{"sub":"alice"}`, []byte("other")), "invalid token signature"},
+		{"expired", signJWT(hs256, `{"exp":1700000000}`, testSecret), "token expired"},
+		{"not valid yet", signJWT(hs256, `{"nbf":1700000060}`, testSecret), "token not valid yet"},
+		{"alg none", signJWT(`{"alg":"none"}`, `{"sub":"alice"}`, testSecret), `unsupported signing algorithm "none"`},
+		{"two parts", "a.b", "three parts"},
+	}
+	for _, tt := range tests {
+		claims, err := verifyJWT(tt.token, testSecret, now)
+		if tt.wantErr == "" {
+			if err != nil || claims["sub"] != "alice" {
+				t.Errorf("%s: got claims %v, error %v", tt.name, claims, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	useRoutes(t, map[string][]string{"/private": {"http://p"}, "/public": {"http://q"}})
+	useAuthRoutes(t, "/private")
+
+	var claims string
+	handler := AuthMiddleware(testSecret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims = r.Header.Get(claimsHeader)
+	}))
+	send := func(path, authorization string) int {
+		claims = ""
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(claimsHeader, `{"sub":"forged"}`)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send("/public/x", ""); code != http.StatusOK || claims != "" {
+		t.Errorf("public route: got %d with claims %q, want 200 without claims", code, claims)
+	}
+	if code := send("/private/x", ""); code != http.StatusUnauthorized {
+		t.Errorf("protected route without token: got %d, want 401", code)
+	}
+	token := signJWT(`{"alg":"HS256"}`, `{"sub":"alice"}`, testSecret)
+	if code := send("/private/x", "Bearer "+token); code != http.StatusOK || claims != `{"sub":"alice"}` {
+		t.Errorf("protected route with token: got %d with claims %q", code, claims)
+	}
+}
+
+// Reasons with quotes, such as the algorithm name, stay inside the quoted
+// error_description of WWW-Authenticate
+func TestUnauthorizedEscapesReason(t *testing.T) {
+	rec := httptest.NewRecorder()
+	unauthorized(rec, `unsupported signing algorithm "none" \ x`)
+
+	want := `Bearer error="invalid_token", error_description="unsupported signing algorithm \"none\" \\ x"`
+	if got := rec.Header().Get("WWW-Authenticate"); got != want {
+		t.Errorf("got WWW-Authenticate %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+/**
+Circuit breakers:
+Every upstream has a circuit breaker, so a backend that is down is not sent
+requests that can only fail slowly:
+
+closed: requests are sent. After breakerConfig.Threshold consecutive failed
+attempts (connection errors or failover statuses, see failover.go) the
+breaker opens.
+open: the upstream is skipped for breakerConfig.Cooldown; requests go to
+the route's other upstreams, or get 503 if there is none.
+half-open: once the cooldown is over a single request is let through as a
+probe. If it succeeds the breaker closes again, if it fails the breaker
+opens for another cooldown.
+
+GET /gateway/status lists every upstream with its breaker state and health
+(see health.go) as JSON.
+*/
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerConfig sets when breakers open and for how long
+type BreakerConfig struct {
+	// Threshold is how many consecutive failures open the breaker
+	Threshold int
+
+	// Cooldown is how long an open breaker waits before a probe
+	Cooldown time.Duration
+}
+
+var breakerConfig = BreakerConfig{
+	Threshold: 5,
+	Cooldown:  30 * time.Second,
+}
+
+// Breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// breaker tracks one upstream; its methods are safe for concurrent use
+type breaker struct {
+	upstream string
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// breakers holds the breaker of every upstream, by URL. The map is only
+// read after startup; each breaker guards its own state.
+var breakers = func() map[string]*breaker {
+	all := make(map[string]*breaker)
+	for _, upstreams := range routes {
+		for _, upstream := range upstreams {
+			all[upstream] = &breaker{upstream: upstream, state: breakerClosed}
+		}
+	}
+	return all
+}()
+
+// allow reports whether a request may be sent to the upstream now. When it
+// lets a half-open probe through, the caller must report its outcome with
+// record or abort.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < breakerConfig.Cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		log.Printf("Circuit for %s half-open, sending a probe", b.upstream)
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// record reports the outcome of a request sent to the upstream
+func (b *breaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if ok {
+		if b.state != breakerClosed {
+			log.Printf("Circuit for %s closed, upstream recovered", b.upstream)
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= breakerConfig.Threshold {
+		if b.state != breakerOpen {
+			log.Printf("Circuit for %s open after %d consecutive failures", b.upstream, b.failures)
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// abort releases a request whose outcome says nothing about the upstream,
+// such as one the client gave up on, so another probe can be sent
+func (b *breaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// breakerStatus is one upstream's entry in /gateway/status
+type breakerStatus struct {
+	Upstream  string     `json:"upstream"`
+	Routes    []string   `json:"routes"`
+	Healthy   bool       `json:"healthy"`
+	State     string     `json:"state"`
+	Failures  int        `json:"consecutive_failures"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"`
+	Threshold int        `json:"threshold"`
+}
+
+// gatewayStatus lists the breaker state and health of every upstream
+func gatewayStatus(w http.ResponseWriter, r *http.Request) {
+	usedBy := make(map[string][]string)
+	for route, upstreams := range routes {
+		for _, upstream := range upstreams {
+			usedBy[upstream] = append(usedBy[upstream], route)
+		}
+	}
+
+	statuses := make([]breakerStatus, 0, len(breakers))
+	for upstream, b := range breakers {
+		b.mu.Lock()
+		status := breakerStatus{
+			Upstream:  upstream,
+			Routes:    usedBy[upstream],
+			Healthy:   healthy(upstream),
+			State:     b.state,
+			Failures:  b.failures,
+			Threshold: breakerConfig.Threshold,
+		}
+		if b.state != breakerClosed {
+			openedAt, retryAt := b.openedAt, b.openedAt.Add(breakerConfig.Cooldown)
+			status.OpenedAt, status.RetryAt = &openedAt, &retryAt
+		}
+		b.mu.Unlock()
+		sort.Strings(status.Routes)
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Upstream < statuses[j].Upstream })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"upstreams": statuses})
+}
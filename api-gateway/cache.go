@@ -0,0 +1,193 @@
+package main
+
+/**
+Response cache:
+Successful GET and HEAD answers are kept in memory, keyed by method and
+path (including the query string), and served again without contacting the
+upstream until they expire. Every GET and HEAD response carries an X-Cache
+header: HIT when it came from the cache, MISS when it came from the
+upstream. Hits also carry an Age header with the seconds since the answer
+was stored.
+
+An answer is only stored when
+  - the status is 200 OK,
+  - its Cache-Control has none of no-store, no-cache and private,
+  - it sets no cookie and has no Vary header, since the key ignores the
+    request headers,
+  - its body is at most cacheConfig.MaxEntryBytes.
+
+It is kept for Cache-Control: max-age seconds, or cacheConfig.DefaultTTL
+when the upstream gives no max-age (a DefaultTTL of 0 caches only answers
+with a max-age). Requests with an Authorization header are never cached,
+so one user's answer is not served to another.
+
+When the bodies stored reach cacheConfig.MaxBytes, the least recently used
+answers are dropped to make room.
+*/
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig sets how much is cached and for how long
+type CacheConfig struct {
+	// MaxBytes is the total size of the bodies the cache may hold
+	MaxBytes int64
+
+	// MaxEntryBytes is the largest body that is cached
+	MaxEntryBytes int64
+
+	// DefaultTTL applies to answers without Cache-Control: max-age
+	DefaultTTL time.Duration
+}
+
+var cacheConfig = CacheConfig{
+	MaxBytes:      64 << 20,
+	MaxEntryBytes: 1 << 20,
+	DefaultTTL:    30 * time.Second,
+}
+
+// cacheEntry is one stored answer
+type cacheEntry struct {
+	key      string
+	status   int
+	header   http.Header
+	body     []byte
+	storedAt time.Time
+	expires  time.Time
+}
+
+// responseCache is an LRU cache of answers; its methods are safe for
+// concurrent use
+type responseCache struct {
+	mu    sync.Mutex
+	size  int64
+	order *list.List // most recently used at the front
+	items map[string]*list.Element
+}
+
+var cache = &responseCache{order: list.New(), items: make(map[string]*list.Element)}
+
+// cacheKey returns the key of a request, or false if it must not be cached
+func cacheKey(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", false
+	}
+	if r.Header.Get("Authorization") != "" {
+		return "", false
+	}
+	return r.Method + " " + r.URL.RequestURI(), true
+}
+
+// get returns the answer stored for key, unless there is none or it expired
+func (c *responseCache) get(key string, now time.Time) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !now.Before(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry, true
+}
+
+// put stores an answer, dropping the least recently used ones if it does not fit
+func (c *responseCache) put(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[entry.key]; ok {
+		c.remove(element)
+	}
+	for c.size+int64(len(entry.body)) > cacheConfig.MaxBytes && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+	if c.size+int64(len(entry.body)) > cacheConfig.MaxBytes {
+		return
+	}
+	c.items[entry.key] = c.order.PushFront(entry)
+	c.size += int64(len(entry.body))
+}
+
+// remove drops an element; the caller must hold c.mu
+func (c *responseCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.size -= int64(len(entry.body))
+}
+
+// cacheTTL returns how long an answer may be cached, or false if it may not
+func cacheTTL(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusOK {
+		return 0, false
+	}
+	if len(resp.Header.Values("Set-Cookie")) > 0 || len(resp.Header.Values("Vary")) > 0 {
+		return 0, false
+	}
+
+	ttl := cacheConfig.DefaultTTL
+	for _, directive := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return 0, false
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil {
+				return 0, false
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+	return ttl, ttl > 0
+}
+
+/*
+*
+storeResponse writes an upstream answer to w and, if it may be cached,
+stores it under key. A body over cacheConfig.MaxEntryBytes is passed on
+without being stored.
+*/
+func storeResponse(w http.ResponseWriter, resp *http.Response, key string) {
+	w.Header().Set("X-Cache", "MISS")
+	ttl, ok := cacheTTL(resp)
+	if !ok {
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, cacheConfig.MaxEntryBytes+1))
+	w.WriteHeader(resp.StatusCode)
+	if err != nil || int64(len(body)) > cacheConfig.MaxEntryBytes {
+		// Send what was read, then the rest, without caching it
+		io.Copy(w, io.MultiReader(bytes.NewReader(body), resp.Body))
+		return
+	}
+	w.Write(body)
+
+	now := time.Now()
+	header := http.Header{}
+	copyHeaders(header, resp.Header)
+	cache.put(&cacheEntry{key: key, status: resp.StatusCode, header: header, body: body, storedAt: now, expires: now.Add(ttl)})
+}
+
+// serveCached writes a stored answer to w
+func serveCached(w http.ResponseWriter, entry *cacheEntry, now time.Time) {
+	copyHeaders(w.Header(), entry.header)
+	w.Header().Set("X-Cache", "HIT")
+	w.Header().Set("Age", strconv.Itoa(int(now.Sub(entry.storedAt).Seconds())))
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
@@ -0,0 +1,156 @@
+package main
+
+/**
+CORS:
+Browsers only let a page read a response from another origin when the
+response says that origin is allowed. CORSMiddleware adds those headers for
+the origins in corsConfig.AllowedOrigins, before any routing, so every
+response of the gateway carries them, including errors such as 401, 404
+and 429.
+
+A preflight, the OPTIONS request a browser sends before e.g. a PUT or a
+request with an Authorization header, is answered by the gateway itself
+with 204 and the allowed methods and headers; it is not forwarded and needs
+no token. A preflight from an origin that is not allowed gets 403.
+
+Wildcard mode: "*" in AllowedOrigins allows every origin, and "*" in
+AllowedHeaders every request header.
+
+Credentialed mode: with AllowCredentials the browser may send cookies and
+Authorization headers, and reads the response only if it names the origin
+exactly, so the request's Origin is echoed instead of "*" (with
+Vary: Origin), and the requested headers are echoed instead of "*".
+Combining "*" with AllowCredentials lets any website send requests with
+the user's credentials, so list the origins instead when credentials are
+allowed.
+
+Access-Control-* headers sent by the upstreams are dropped, so the
+gateway's policy is the only one. With no AllowedOrigins no headers are
+added or dropped.
+*/
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig sets which browser origins may call the gateway
+type CORSConfig struct {
+	// AllowedOrigins are e.g. "https://app.example.com", or "*" for any
+	AllowedOrigins []string
+
+	// AllowedMethods are the methods a preflight may ask for
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers a preflight may ask for, or "*"
+	AllowedHeaders []string
+
+	// AllowCredentials lets browsers send cookies and Authorization headers
+	AllowCredentials bool
+
+	// MaxAge is how long browsers may cache a preflight answer
+	MaxAge time.Duration
+}
+
+var corsConfig = CORSConfig{
+	AllowedOrigins:   []string{"http://localhost:3000"},
+	AllowedMethods:   []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+	AllowedHeaders:   []string{"Authorization", "Content-Type"},
+	AllowCredentials: false,
+	MaxAge:           10 * time.Minute,
+}
+
+// allowedOrigin returns the value of Access-Control-Allow-Origin for
+// origin, or false if the origin is not allowed
+func (c CORSConfig) allowedOrigin(origin string) (string, bool) {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			if c.AllowCredentials {
+				return origin, true
+			}
+			return "*", true
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// allowedHeaders returns the value of Access-Control-Allow-Headers for a
+// preflight that asks for requested
+func (c CORSConfig) allowedHeaders(requested string) string {
+	for _, allowed := range c.AllowedHeaders {
+		if allowed == "*" && c.AllowCredentials {
+			return requested
+		}
+	}
+	return strings.Join(c.AllowedHeaders, ", ")
+}
+
+// dropCORSHeaders removes the upstream's Access-Control-* headers when the
+// gateway sets its own
+func dropCORSHeaders(header http.Header) {
+	if len(corsConfig.AllowedOrigins) == 0 {
+		return
+	}
+	for key := range header {
+		if strings.HasPrefix(key, "Access-Control-") {
+			header.Del(key)
+		}
+	}
+}
+
+/*
+*
+CORSMiddleware adds the CORS headers for allowed origins and answers
+preflight requests with 204 without passing them on. Requests without an
+Origin header, i.e. not from a browser page on another origin, are passed
+on unchanged.
+*/
+func CORSMiddleware(config CORSConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(config.AllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		allowOrigin, ok := config.allowedOrigin(origin)
+		if !ok {
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("Access-Control-Allow-Origin", allowOrigin)
+		if allowOrigin != "*" {
+			header.Add("Vary", "Origin")
+		}
+		if config.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+		if headers := config.allowedHeaders(r.Header.Get("Access-Control-Request-Headers")); headers != "" {
+			header.Set("Access-Control-Allow-Headers", headers)
+		}
+		if config.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+/**
+Failover:
+A route can list several upstreams that serve the same service. Requests
+are spread over them round-robin: each request starts at the next upstream
+of its route, and when an attempt fails the request is sent to the
+following one. An attempt fails when the upstream cannot be reached or
+answers with one of the status codes in failover.Statuses (by default
+500, 502, 503 and 504). After failover.Retries further attempts (by default
+2, so three attempts in all) the gateway gives up with 502 Bad Gateway.
+Every failed attempt is logged. Upstreams that failed their health check
+(see health.go) or whose circuit breaker is open (see breaker.go) are
+skipped without using up an attempt; when no upstream of a route is
+available the request gets 503 at once.
+
+Only idempotent requests (GET, HEAD, OPTIONS, TRACE, PUT and DELETE) fail
+over on a failover status: sending them twice does no harm. A POST or PATCH
+that got a 5xx may already have been carried out, so the upstream's answer
+is returned as it is. Such requests only move on to the next upstream when
+the connection failed before any of the request was written, e.g. because
+the upstream refused the connection.
+
+To resend a request its body is kept in memory, up to maxRetryBody bytes;
+larger bodies are refused with 413.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+)
+
+// FailoverConfig sets how often and on which answers a request moves on to
+// the next upstream
+type FailoverConfig struct {
+	// Retries is how many more upstreams are tried after the first fails
+	Retries int
+
+	// Statuses are the status codes that count as a failed attempt
+	Statuses []int
+}
+
+var failover = FailoverConfig{
+	Retries:  2,
+	Statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+}
+
+// maxRetryBody is the largest request body that can be resent on failover
+const maxRetryBody = 10 << 20
+
+// errBodyTooLarge is returned for request bodies over maxRetryBody
+var errBodyTooLarge = fmt.Errorf("request body larger than %d bytes", maxRetryBody)
+
+// errNoUpstream is returned when no upstream of the route could be tried
+var errNoUpstream = errors.New("no healthy upstream with a closed circuit")
+
+// nextUpstream holds each route's round-robin position
+var nextUpstream = func() map[string]*atomic.Uint64 {
+	counters := make(map[string]*atomic.Uint64, len(routes))
+	for route := range routes {
+		counters[route] = new(atomic.Uint64)
+	}
+	return counters
+}()
+
+// idempotentMethods can be sent again without changing the outcome
+var idempotentMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodOptions: true,
+	http.MethodTrace: true, http.MethodPut: true, http.MethodDelete: true,
+}
+
+// failsOver reports whether an upstream's answer should be retried elsewhere
+func (c FailoverConfig) failsOver(status int) bool {
+	for _, s := range c.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+*
+forward sends the request to the route's upstreams, starting at the next
+one in round-robin order and failing over as configured, and returns the
+first answer that is not a failure. The caller must close its body.
+*/
+func forward(r *http.Request, route, path string) (*http.Response, error) {
+	upstreams := routes[route]
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("route %s has no upstreams", route)
+	}
+
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxRetryBody+1))
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %v", err)
+		}
+		if len(body) > maxRetryBody {
+			return nil, errBodyTooLarge
+		}
+	}
+
+	start := int(nextUpstream[route].Add(1) - 1)
+	attempts := failover.Retries + 1
+	made := 0
+	var failures []string
+	// Skipping unavailable upstreams does not count as an attempt; going round the
+	// list once more than the attempts need reaches every upstream
+	for i := 0; made < attempts && i < attempts+len(upstreams); i++ {
+		upstream := upstreams[(start+i)%len(upstreams)]
+		circuit := breakers[upstream]
+		if !healthy(upstream) || !circuit.allow() {
+			continue
+		}
+		made++
+
+		outURL := strings.TrimSuffix(upstream, "/") + path
+		if r.URL.RawQuery != "" {
+			outURL += "?" + r.URL.RawQuery
+		}
+		// Note whether the upstream may have seen the request
+		var sent atomic.Bool
+		ctx := httptrace.WithClientTrace(r.Context(), &httptrace.ClientTrace{
+			WroteHeaders: func() { sent.Store(true) },
+		})
+		outReq, err := http.NewRequestWithContext(ctx, r.Method, outURL, bytes.NewReader(body))
+		if err != nil {
+			circuit.abort()
+			return nil, err
+		}
+		copyHeaders(outReq.Header, r.Header)
+		setForwardedHeaders(outReq, r)
+
+		resp, err := http.DefaultClient.Do(outReq)
+		if err == nil && !failover.failsOver(resp.StatusCode) {
+			circuit.record(true)
+			return resp, nil
+		}
+		if !idempotentMethods[r.Method] && (err == nil || sent.Load()) {
+			// The upstream may have acted on the request; sending it again
+			// could repeat a write
+			circuit.record(false)
+			if err == nil {
+				log.Printf("%s %s: %s answered %s, not retried", r.Method, r.URL.Path, upstream, resp.Status)
+				return resp, nil
+			}
+			log.Printf("%s %s: request to %s failed after it was sent, not retried: %v", r.Method, r.URL.Path, upstream, err)
+			return nil, fmt.Errorf("%s: %v", upstream, err)
+		}
+		if err == nil {
+			// Drain so the connection can be reused, then try the next upstream
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			err = fmt.Errorf("answered %s", resp.Status)
+		}
+		log.Printf("%s %s: attempt %d/%d to %s failed: %v", r.Method, r.URL.Path, made, attempts, upstream, err)
+		failures = append(failures, fmt.Sprintf("%s: %v", upstream, err))
+
+		// Stop once the client has gone away; that is not the upstream's fault
+		if r.Context().Err() != nil {
+			circuit.abort()
+			break
+		}
+		circuit.record(false)
+	}
+	if made == 0 {
+		return nil, errNoUpstream
+	}
+	return nil, fmt.Errorf("all upstreams failed: %s", strings.Join(failures, "; "))
+}
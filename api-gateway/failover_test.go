@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testUpstream answers every request with status and body and counts the requests
+type testUpstream struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newTestUpstream(t *testing.T, status int, body string) *testUpstream {
+	t.Helper()
+	u := &testUpstream{}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.requests.Add(1)
+		io.Copy(io.Discard, r.Body)
+		// Keep answers out of the response cache (see cache.go)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+// closedUpstream returns the URL of a server that no longer accepts connections
+func closedUpstream() string {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return srv.URL
+}
+
+// useUpstreams routes /test to the upstreams, in order, for the length of a
+// test, with a closed circuit and a healthy state for each
+func useUpstreams(t *testing.T, upstreams ...string) {
+	t.Helper()
+	useRoutes(t, map[string][]string{"/test": upstreams})
+	nextUpstream["/test"] = new(atomic.Uint64)
+	for _, upstream := range upstreams {
+		breakers[upstream] = &breaker{upstream: upstream, state: breakerClosed}
+		upstreamHealth[upstream] = new(atomic.Bool)
+		upstreamHealth[upstream].Store(true)
+	}
+	t.Cleanup(func() {
+		delete(nextUpstream, "/test")
+		for _, upstream := range upstreams {
+			delete(breakers, upstream)
+			delete(upstreamHealth, upstream)
+		}
+	})
+}
+
+// proxy sends a request through ProxyHandler
+func proxy(method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ProxyHandler(rec, httptest.NewRequest(method, path, strings.NewReader(`{"n":1}`)))
+	return rec
+}
+
+// Idempotent requests move on to the next upstream after a 5xx
+func TestFailoverIdempotentOn5xx(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		failing := newTestUpstream(t, http.StatusServiceUnavailable, "down")
+		working := newTestUpstream(t, http.StatusOK, "ok")
+		useUpstreams(t, failing.URL, working.URL)
+
+		rec := proxy(method, "/test/items/1")
+		if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+			t.Errorf("%s: got %d %q, want 200 from the second upstream", method, rec.Code, rec.Body)
+		}
+		if failing.requests.Load() != 1 || working.requests.Load() != 1 {
+			t.Errorf("%s: upstreams got %d and %d requests, want 1 each", method, failing.requests.Load(), working.requests.Load())
+		}
+	}
+}
+
+// POST and PATCH may have been carried out by an upstream that answered
+// 5xx, so its answer is returned and the request is not sent again
+func TestNoFailoverNonIdempotentOn5xx(t *testing.T) {
+	for _, method := range []string{http.MethodPost, http.MethodPatch} {
+		failing := newTestUpstream(t, http.StatusInternalServerError, "half done")
+		working := newTestUpstream(t, http.StatusOK, "ok")
+		useUpstreams(t, failing.URL, working.URL)
+
+		rec := proxy(method, "/test/orders")
+		if rec.Code != http.StatusInternalServerError || rec.Body.String() != "half done" {
+			t.Errorf("%s: got %d %q, want the first upstream's 500", method, rec.Code, rec.Body)
+		}
+		if working.requests.Load() != 0 {
+			t.Errorf("%s: sent again to the second upstream", method)
+		}
+	}
+}
+
+// A POST whose connection was refused never reached the upstream, so it
+// can safely go to the next one
+func TestFailoverNonIdempotentOnConnectionError(t *testing.T) {
+	working := newTestUpstream(t, http.StatusCreated, "created")
+	useUpstreams(t, closedUpstream(), working.URL)
+
+	rec := proxy(http.MethodPost, "/test/orders")
+	if rec.Code != http.StatusCreated || working.requests.Load() != 1 {
+		t.Errorf("got %d %q after %d requests to the second upstream, want 201 after 1",
+			rec.Code, rec.Body, working.requests.Load())
+	}
+}
+
+// Every attempt failing gives 502
+func TestFailoverAllUpstreamsFail(t *testing.T) {
+	useUpstreams(t, closedUpstream(), closedUpstream())
+
+	if rec := proxy(http.MethodGet, "/test"); rec.Code != http.StatusBadGateway {
+		t.Errorf("got %d %q, want 502", rec.Code, rec.Body)
+	}
+}
@@ -2,4 +2,4 @@ module api-gateway
 
 go 1.23.4
 
-require golang.org/x/time v0.8.0 // indirect
+require golang.org/x/time v0.8.0
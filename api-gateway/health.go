@@ -0,0 +1,101 @@
+package main
+
+/**
+Health checks:
+A background goroutine sends GET <upstream><healthCheck.Path> to every
+upstream each healthCheck.Interval. An upstream that answers 2xx within
+healthCheck.Timeout is healthy; anything else marks it unhealthy until a
+later check passes. Changes are logged.
+
+forward skips unhealthy upstreams just like those with an open circuit
+(see failover.go), and a route whose upstreams are all unavailable gets 503
+without any request being sent. Upstreams start out healthy, so traffic
+flows before the first round of checks has finished. The health of each
+upstream is also shown by /gateway/status.
+
+Circuit breakers react to failing requests, health checks find a dead
+backend before requests are sent to it, and notice when it is back even if
+no traffic reaches it.
+*/
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthCheckConfig sets how upstreams are checked
+type HealthCheckConfig struct {
+	// Path is requested on every upstream, e.g. "/health"
+	Path string
+
+	// Interval is the time between two rounds of checks
+	Interval time.Duration
+
+	// Timeout is how long a check may take before the upstream counts as down
+	Timeout time.Duration
+}
+
+var healthCheck = HealthCheckConfig{
+	Path:     "/health",
+	Interval: 10 * time.Second,
+	Timeout:  2 * time.Second,
+}
+
+// upstreamHealth holds whether each upstream passed its last check, by URL.
+// The map is only read after startup; the values are updated atomically.
+var upstreamHealth = func() map[string]*atomic.Bool {
+	health := make(map[string]*atomic.Bool)
+	for _, upstreams := range routes {
+		for _, upstream := range upstreams {
+			health[upstream] = new(atomic.Bool)
+			health[upstream].Store(true)
+		}
+	}
+	return health
+}()
+
+// healthy reports whether the upstream passed its last health check
+func healthy(upstream string) bool {
+	return upstreamHealth[upstream].Load()
+}
+
+// runHealthChecks checks every upstream now and then every interval
+func runHealthChecks() {
+	client := &http.Client{Timeout: healthCheck.Timeout}
+	for {
+		var wg sync.WaitGroup
+		for upstream, health := range upstreamHealth {
+			wg.Add(1)
+			go func(upstream string, health *atomic.Bool) {
+				defer wg.Done()
+				ok, reason := checkUpstream(client, upstream)
+				if was := health.Swap(ok); was != ok {
+					if ok {
+						log.Printf("Upstream %s is healthy again", upstream)
+					} else {
+						log.Printf("Upstream %s is unhealthy: %s", upstream, reason)
+					}
+				}
+			}(upstream, health)
+		}
+		wg.Wait()
+		time.Sleep(healthCheck.Interval)
+	}
+}
+
+// checkUpstream requests the health path of an upstream
+func checkUpstream(client *http.Client, upstream string) (ok bool, reason string) {
+	resp, err := client.Get(strings.TrimSuffix(upstream, "/") + healthCheck.Path)
+	if err != nil {
+		return false, err.Error()
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, "health check answered " + resp.Status
+	}
+	return true, ""
+}
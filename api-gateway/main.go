@@ -98,47 +98,243 @@
 
 //basic
 
+// install go get golang.org/x/time/rate
 package main
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
 )
 
-// Route maps endpoint paths to target microservices
-var routes = map[string]string{
-	"/service-a": "http://localhost:8081",
-	"/service-b": "http://localhost:8082",
+// Route maps endpoint paths to target microservices; a route can list
+// several upstreams of the same service (see failover.go)
+var routes = map[string][]string{
+	"/service-a": {"http://localhost:8081"},
+	"/service-b": {"http://localhost:8082"},
+}
+
+/*
+*
+matchRoute finds the route for a request path. A route matches its own path
+and everything below it, so "/service-a" serves "/service-a/users/1" but not
+"/service-abc"; when several routes match, the longest one wins. It returns
+the route and the rest of the path after it, which is "/" for the route
+itself.
+*/
+func matchRoute(path string) (route, rest string, ok bool) {
+	route, ok = routeFor(path)
+	if !ok {
+		return "", "", false
+	}
+	rest = strings.TrimPrefix(path, strings.TrimSuffix(route, "/"))
+	if rest == "" {
+		rest = "/"
+	}
+	return route, rest, true
+}
+
+// hopByHopHeaders describe the connection between two hops rather than the
+// request itself, so they are not passed on by the proxy
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// copyHeaders adds every header of src to dst, except the hop-by-hop ones
+func copyHeaders(dst, src http.Header) {
+	for key, values := range src {
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+	for _, key := range hopByHopHeaders {
+		dst.Del(key)
+	}
+}
+
+/*
+*
+setForwardedHeaders tells the service who the client is, since the service
+only sees the gateway's address: the client's IP is appended to
+X-Forwarded-For, after any addresses earlier proxies put there, and
+X-Forwarded-Proto and X-Forwarded-Host are set to the scheme and host the
+client used. A client can send any X-Forwarded-For it likes, so only the
+last address, added by the gateway, can be trusted.
+*/
+func setForwardedHeaders(out, in *http.Request) {
+	if ip, _, err := net.SplitHostPort(in.RemoteAddr); err == nil {
+		if prior := in.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+			ip = strings.Join(prior, ", ") + ", " + ip
+		}
+		out.Header.Set("X-Forwarded-For", ip)
+	}
+	proto := "http"
+	if in.TLS != nil {
+		proto = "https"
+	}
+	out.Header.Set("X-Forwarded-Proto", proto)
+	out.Header.Set("X-Forwarded-Host", in.Host)
+}
+
+// routeFor returns the longest route that path falls under
+func routeFor(path string) (route string, ok bool) {
+	for prefix := range routes {
+		if len(prefix) <= len(route) {
+			continue
+		}
+		base := strings.TrimSuffix(prefix, "/")
+		if path == prefix || path == base || strings.HasPrefix(path, base+"/") {
+			route = prefix
+		}
+	}
+	return route, route != ""
+}
+
+// RateLimit allows RPS requests per second on average, with bursts of up to Burst
+type RateLimit struct {
+	RPS   float64
+	Burst int
+}
+
+// rateLimits sets the limit of individual routes; routes not listed here get
+// defaultRateLimit. Each route has its own limiter, so a flood of requests
+// to one service does not use up the allowance of the others.
+var rateLimits = map[string]RateLimit{
+	"/service-a": {RPS: 5, Burst: 10},
+	"/service-b": {RPS: 1, Burst: 5},
+}
+
+// defaultRateLimit applies to routes without an entry in rateLimits
+var defaultRateLimit = RateLimit{RPS: 10, Burst: 20}
+
+// newRouteLimiters creates one limiter per route. The map is only read
+// afterwards, and rate.Limiter is safe for concurrent use.
+func newRouteLimiters() map[string]*rate.Limiter {
+	limiters := make(map[string]*rate.Limiter, len(routes))
+	for route := range routes {
+		limit, ok := rateLimits[route]
+		if !ok {
+			limit = defaultRateLimit
+		}
+		limiters[route] = rate.NewLimiter(rate.Limit(limit.RPS), limit.Burst)
+	}
+	return limiters
+}
+
+/*
+*
+RateLimiterMiddleware checks the request against the limiter of its route.
+When the route's limit is exceeded it responds with 429 Too Many Requests
+and a Retry-After header giving the seconds until a request would be
+allowed again. Requests that match no route are passed on and get their 404
+from the proxy.
+*/
+func RateLimiterMiddleware(limiters map[string]*rate.Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := routeFor(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		reservation := limiters[route].Reserve()
+		if !reservation.OK() {
+			// A burst of 0 never allows a request, so there is no time to retry at
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		if delay := reservation.Delay(); delay > 0 {
+			// Give the token back; this request is rejected, not delayed
+			reservation.Cancel()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // ProxyHandler handles incoming requests and forwards them to appropriate microservices
+/**
+The route's path is stripped, so /service-a/users/1 is sent to the service
+as /users/1 (see matchRoute). The outgoing request keeps the method, query
+string, headers and body of the incoming one, so a POST /service-a with a
+JSON body reaches the service as a POST with that body, and gets the
+X-Forwarded-* headers (see setForwardedHeaders). The service's
+status, headers and body are passed back unchanged. When the route has
+several upstreams, failed attempts move on to the next one (see forward in
+failover.go) and 502 is returned only when every attempt failed, or 503
+when every upstream is unhealthy or has an open circuit. GET and HEAD
+answers may be served from the response cache (see cache.go).
+*/
 func ProxyHandler(w http.ResponseWriter, r *http.Request) {
 	// Match the request path with the corresponding service
-	targetURL, exists := routes[r.URL.Path]
+	route, path, exists := matchRoute(r.URL.Path)
 	if !exists {
 		http.Error(w, "Service not found", http.StatusNotFound)
 		return
 	}
 
+	// Answer from the cache when possible (see cache.go)
+	key, cacheable := cacheKey(r)
+	if cacheable {
+		if entry, ok := cache.get(key, time.Now()); ok {
+			serveCached(w, entry, time.Now())
+			return
+		}
+	}
+
 	// Forward the request to the target service
-	resp, err := http.Get(targetURL)
+	resp, err := forward(r, route, path)
+	if errors.Is(err, errBodyTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, errNoUpstream) {
+		http.Error(w, fmt.Sprintf("Service unavailable: %s", err.Error()), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error forwarding request: %s", err.Error()), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error forwarding request: %s", err.Error()), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Return the response from the microservice
-	body, _ := ioutil.ReadAll(resp.Body)
+	// Return the response from the microservice; the gateway's CORS
+	// headers replace the service's (see cors.go)
+	dropCORSHeaders(resp.Header)
+	copyHeaders(w.Header(), resp.Header)
+	if cacheable {
+		storeResponse(w, resp, key)
+		return
+	}
 	w.WriteHeader(resp.StatusCode)
-	w.Write(body)
+	io.Copy(w, resp.Body)
 }
 
 func main() {
+	// Wrap the ProxyHandler with the JWT AuthMiddleware (see auth.go), the
+	// per-route RateLimiter middleware and, outermost so that preflights
+	// need no token and every response gets its headers, CORS (see cors.go)
+	handler := CORSMiddleware(corsConfig, RateLimiterMiddleware(newRouteLimiters(), AuthMiddleware(jwtSecret(), http.HandlerFunc(ProxyHandler))))
+
 	// Set up HTTP routes
-	http.HandleFunc("/", ProxyHandler)
+	http.Handle("/", handler)
+
+	// Circuit breaker states and health of the upstreams (see breaker.go)
+	http.HandleFunc("/gateway/status", gatewayStatus)
+
+	// Check the upstreams in the background (see health.go)
+	go runHealthChecks()
 
 	// Start the API Gateway
 	fmt.Println("API Gateway running on port 8080")
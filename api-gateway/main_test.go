@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+// useRoutes replaces the route table for the length of a test
+func useRoutes(t *testing.T, table map[string][]string) {
+	t.Helper()
+	saved := routes
+	routes = table
+	t.Cleanup(func() { routes = saved })
+}
+
+func TestMatchRoute(t *testing.T) {
+	useRoutes(t, map[string][]string{
+		"/service-a":     {"http://a"},
+		"/service-a/v2":  {"http://a-v2"},
+		"/service-ab":    {"http://ab"},
+		"/service-c/":    {"http://c"},
+		"/service-b/api": {"http://b"},
+	})
+
+	tests := []struct {
+		path      string
+		wantRoute string
+		wantRest  string
+		wantOK    bool
+	}{
+		// A route matches itself and the paths below it
+		{"/service-a", "/service-a", "/", true},
+		{"/service-a/", "/service-a", "/", true},
+		{"/service-a/x", "/service-a", "/x", true},
+		{"/service-a/x/y", "/service-a", "/x/y", true},
+
+		// Overlapping names: a prefix of the name is not a parent path
+		{"/service-ab", "/service-ab", "/", true},
+		{"/service-ab/users/1", "/service-ab", "/users/1", true},
+		{"/service-abc", "", "", false},
+
+		// The longest matching route wins
+		{"/service-a/v2", "/service-a/v2", "/", true},
+		{"/service-a/v2/users", "/service-a/v2", "/users", true},
+		{"/service-a/v23", "/service-a", "/v23", true},
+
+		// A route with a trailing slash behaves like one without
+		{"/service-c", "/service-c/", "/", true},
+		{"/service-c/x", "/service-c/", "/x", true},
+
+		// Nested routes do not match their parents
+		{"/service-b", "", "", false},
+		{"/service-b/api/items", "/service-b/api", "/items", true},
+
+		{"/", "", "", false},
+		{"/unknown/service-a", "", "", false},
+	}
+	for _, tt := range tests {
+		route, rest, ok := matchRoute(tt.path)
+		if route != tt.wantRoute || rest != tt.wantRest || ok != tt.wantOK {
+			t.Errorf("matchRoute(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.path, route, rest, ok, tt.wantRoute, tt.wantRest, tt.wantOK)
+		}
+		if route, ok := routeFor(tt.path); route != tt.wantRoute || ok != tt.wantOK {
+			t.Errorf("routeFor(%q) = %q, %v; want %q, %v", tt.path, route, ok, tt.wantRoute, tt.wantOK)
+		}
+	}
+}
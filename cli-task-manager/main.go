@@ -10,15 +10,39 @@ go build -o task-manager
 Add a task:
 ./task-manager add "Buy groceries"
 
+Add a task with a due date (YYYY-MM-DD or RFC3339):
+./task-manager add "Pay rent" --due 2024-12-01
+./task-manager add "Call the bank" --due 2024-12-01T15:00:00+01:00
+
+Add a task with a priority (low, medium or high), or change it later:
+./task-manager add "Fix the roof" --priority high
+./task-manager priority 1 low
+
 List tasks:
 ./task-manager list
 
+List tasks from high to low priority:
+./task-manager list --sort priority
+
 Mark a task as done:
 ./task-manager done 1
 
 Delete a task:
 ./task-manager delete 1
 
+Search task descriptions (case-insensitive, optionally as a regular expression):
+./task-manager search groceries
+./task-manager search --regex "^buy (milk|bread)"
+
+Remove every task:
+./task-manager clear
+
+Undo the last delete or clear, if nothing else has changed since:
+./task-manager undo
+
+Show a summary of the task list:
+./task-manager stats
+
 IMPORTANT
 .\task-manager add "Buy groceries"
 Rename-Item task-manager task-manager.exe
@@ -32,22 +56,34 @@ package main
 encoding/json: For encoding and decoding the tasks to and from JSON format.
 fmt: For formatted I/O operations like printing to the console.
 os: For basic operating system operations (like file reading/writing).
+sort: For listing tasks by priority.
 strconv: For converting string inputs to integer IDs.
+regexp, strings: For matching search queries against task descriptions.
+time: For parsing due dates and telling whether a task is overdue.
 */
 import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 /*
 *
-Defines a Task struct with three fields:
+Defines a Task struct with five fields:
 
 ID: An integer representing the task ID.
 Description: A string for the task description.
 Completed: A boolean indicating whether the task is completed or not.
+DueDate: An optional due date, as given when adding the task (YYYY-MM-DD or
+RFC3339). It is left out of the JSON when empty, so tasks saved before due
+dates existed load unchanged.
+Priority: low, medium or high. Left out of the JSON when not set; such tasks
+count as medium when sorting.
 JSON tags (json:"id", json:"description", json:"completed") are used to
 specify how each field should be stored when encoding or decoding from JSON
 format.
@@ -56,11 +92,110 @@ type Task struct {
 	ID          int    `json:"id"`
 	Description string `json:"description"`
 	Completed   bool   `json:"completed"`
+	DueDate     string `json:"due_date,omitempty"`
+	Priority    string `json:"priority,omitempty"`
+}
+
+// priorityRanks orders the priority levels; a higher rank is listed first
+var priorityRanks = map[string]int{"low": 1, "medium": 2, "high": 3}
+
+// Check a priority given on the command line and return it in lower case
+func parsePriority(value string) (string, error) {
+	level := strings.ToLower(value)
+	if _, ok := priorityRanks[level]; !ok {
+		return "", fmt.Errorf("invalid priority %q: use low, medium or high", value)
+	}
+	return level, nil
+}
+
+// Rank a task's priority, counting tasks without one as medium
+func priorityRank(task Task) int {
+	if rank, ok := priorityRanks[task.Priority]; ok {
+		return rank
+	}
+	return priorityRanks["medium"]
 }
 
 // Specifies the filename (tasks.json) where the tasks are stored.
 const taskFile = "tasks.json"
 
+// undoFile holds the task list as it was before the last delete or clear.
+const undoFile = "tasks.undo.json"
+
+// lastIDFile holds the highest task ID given out so far.
+const lastIDFile = "tasks.lastid"
+
+/*
+*
+undoState is written to undoFile before a destructive operation:
+
+Operation: A description of what was done, shown when undoing (e.g. "delete task 3").
+Tasks: The full task list before the operation.
+
+Only the most recent operation is kept; each delete or clear replaces it.
+Any other change (add, done, priority) discards it, because writing the old
+list back would silently lose that change.
+*/
+type undoState struct {
+	Operation string `json:"operation"`
+	Tasks     []Task `json:"tasks"`
+}
+
+// dateOnly is the layout of due dates given without a time
+const dateOnly = "2006-01-02"
+
+// Parse a due date
+/**
+Accepts a plain date (2024-12-01) or an RFC3339 timestamp
+(2024-12-01T15:00:00+01:00) and returns the moment the task becomes overdue.
+A plain date is due at the end of that day in local time, so a task due
+today is not overdue until tomorrow.
+*/
+func parseDueDate(value string) (time.Time, error) {
+	if day, err := time.ParseInLocation(dateOnly, value, time.Local); err == nil {
+		return day.AddDate(0, 0, 1), nil
+	}
+	if due, err := time.Parse(time.RFC3339, value); err == nil {
+		return due, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid due date %q: use YYYY-MM-DD (e.g. 2024-12-01) or RFC3339 (e.g. 2024-12-01T15:00:00Z)", value)
+}
+
+// Report whether a pending task is past its due date
+func isOverdue(task Task, now time.Time) bool {
+	if task.Completed || task.DueDate == "" {
+		return false
+	}
+	due, err := parseDueDate(task.DueDate)
+	return err == nil && !now.Before(due)
+}
+
+// Format a task as one line of list or search output
+/**
+[3] Pay rent - Pending (high priority, due 2024-12-01, OVERDUE)
+*/
+func formatTask(task Task, now time.Time) string {
+	status := "Pending"
+	if task.Completed {
+		status = "Done"
+	}
+	line := fmt.Sprintf("[%d] %s - %s", task.ID, task.Description, status)
+	var details []string
+	if task.Priority != "" {
+		details = append(details, task.Priority+" priority")
+	}
+	if task.DueDate != "" {
+		details = append(details, "due "+task.DueDate)
+	}
+	if isOverdue(task, now) {
+		details = append(details, "OVERDUE")
+	}
+	if len(details) > 0 {
+		line += " (" + strings.Join(details, ", ") + ")"
+	}
+	return line
+}
+
 // Load tasks from file
 /**
 Purpose: This function loads tasks from the tasks.json file.
@@ -100,30 +235,135 @@ func saveTasks(tasks []Task) error {
 	return nil
 }
 
+// Work out the ID of a new task
+/**
+IDs are never reused: "done" and "delete" take an ID, and a reused one would
+hit a different task than the user meant, or two at once after an undo.
+So the new ID is one more than the highest ID ever given out, which is kept
+in lastIDFile, or than the highest ID in tasks if that is higher (e.g. for a
+task list saved before lastIDFile existed).
+*/
+func nextTaskID(tasks []Task) (int, error) {
+	last := 0
+	data, err := os.ReadFile(lastIDFile)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read last ID file: %w", err)
+	}
+	if err == nil {
+		last, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse last ID file: %w", err)
+		}
+	}
+	for _, task := range tasks {
+		if task.ID > last {
+			last = task.ID
+		}
+	}
+	return last + 1, nil
+}
+
+// Remember the highest task ID given out
+func saveLastID(id int) error {
+	if err := os.WriteFile(lastIDFile, []byte(strconv.Itoa(id)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to save last ID file: %w", err)
+	}
+	return nil
+}
+
+// Save a backup of the current tasks before a destructive operation
+func saveUndo(operation string, tasks []Task) error {
+	data, err := json.MarshalIndent(undoState{Operation: operation, Tasks: tasks}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal undo state: %w", err)
+	}
+	if err := os.WriteFile(undoFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to save undo file: %w", err)
+	}
+	return nil
+}
+
+// Forget the undo state once tasks.json has changed in another way
+func discardUndo() error {
+	if err := os.Remove(undoFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove undo file: %w", err)
+	}
+	return nil
+}
+
+// Undo the last destructive operation
+/**
+Reads undoFile, writes its task list back to tasks.json and removes undoFile,
+so the same operation cannot be undone twice.
+*/
+func undoLast() error {
+	data, err := os.ReadFile(undoFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Println("Nothing to undo.")
+			return nil
+		}
+		return fmt.Errorf("failed to read undo file: %w", err)
+	}
+	var state undoState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse undo file: %w", err)
+	}
+	if err := saveTasks(state.Tasks); err != nil {
+		return err
+	}
+	if err := os.Remove(undoFile); err != nil {
+		return fmt.Errorf("failed to remove undo file: %w", err)
+	}
+	fmt.Printf("Undid %s (%d tasks restored).\n", state.Operation, len(state.Tasks))
+	return nil
+}
+
 // Add a new task
 /**
 Loads existing tasks.
-Calculates a new ID (incrementing the existing number of tasks).
-Appends a new task to the list.
+Calculates a new ID that no task has had before (see nextTaskID).
+Appends a new task to the list, with the due date and priority if given.
 Saves the updated list of tasks back to tasks.json.
+The due date is checked before anything is loaded or saved, so an invalid
+one leaves tasks.json untouched; the priority is checked by the caller.
 */
-func addTask(description string) error {
+func addTask(description, dueDate, priority string) error {
+	if dueDate != "" {
+		if _, err := parseDueDate(dueDate); err != nil {
+			return err
+		}
+	}
 	tasks, err := loadTasks()
 	if err != nil {
 		return err
 	}
-	id := len(tasks) + 1
-	tasks = append(tasks, Task{ID: id, Description: description, Completed: false})
+	id, err := nextTaskID(tasks)
+	if err != nil {
+		return err
+	}
+	tasks = append(tasks, Task{ID: id, Description: description, Completed: false, DueDate: dueDate, Priority: priority})
 	err = saveTasks(tasks)
 	if err != nil {
 		return err
 	}
+	if err := saveLastID(id); err != nil {
+		return err
+	}
+	if err := discardUndo(); err != nil {
+		return err
+	}
 	fmt.Println("Task added successfully!")
 	return nil
 }
 
 // List all tasks
-func listTasks() error {
+/**
+Tasks are listed in the order they were added. With byPriority they are
+listed from high to low priority instead; tasks of the same priority keep
+the order they were added in.
+*/
+func listTasks(byPriority bool) error {
 	tasks, err := loadTasks()
 	if err != nil {
 		return err
@@ -132,13 +372,59 @@ func listTasks() error {
 		fmt.Println("No tasks found.")
 		return nil
 	}
+	if byPriority {
+		sort.SliceStable(tasks, func(i, j int) bool {
+			return priorityRank(tasks[i]) > priorityRank(tasks[j])
+		})
+	}
 	fmt.Println("Tasks:")
+	now := time.Now()
 	for _, task := range tasks {
-		status := "Pending"
-		if task.Completed {
-			status = "Done"
+		fmt.Println(formatTask(task, now))
+	}
+	return nil
+}
+
+// Search tasks by description
+/**
+Lists every task whose description matches the query, ignoring case.
+By default the query is a plain substring; with useRegex it is compiled
+as a regular expression (prefixed with (?i) so it is also case-insensitive).
+*/
+func searchTasks(query string, useRegex bool) error {
+	tasks, err := loadTasks()
+	if err != nil {
+		return err
+	}
+
+	var matches func(string) bool
+	if useRegex {
+		re, err := regexp.Compile("(?i)" + query)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression: %w", err)
+		}
+		matches = re.MatchString
+	} else {
+		lowered := strings.ToLower(query)
+		matches = func(description string) bool {
+			return strings.Contains(strings.ToLower(description), lowered)
 		}
-		fmt.Printf("[%d] %s - %s\n", task.ID, task.Description, status)
+	}
+
+	found := 0
+	now := time.Now()
+	for _, task := range tasks {
+		if !matches(task.Description) {
+			continue
+		}
+		if found == 0 {
+			fmt.Println("Matching tasks:")
+		}
+		found++
+		fmt.Println(formatTask(task, now))
+	}
+	if found == 0 {
+		fmt.Printf("No tasks match %q.\n", query)
 	}
 	return nil
 }
@@ -164,16 +450,49 @@ func markTaskDone(id int) error {
 	if err != nil {
 		return err
 	}
+	if err := discardUndo(); err != nil {
+		return err
+	}
 	fmt.Printf("Task %d marked as done.\n", id)
 	return nil
 }
 
+// Change the priority of a task
+func setPriority(id int, priority string) error {
+	tasks, err := loadTasks()
+	if err != nil {
+		return err
+	}
+	found := false
+	for i, task := range tasks {
+		if task.ID == id {
+			tasks[i].Priority = priority
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("task with ID %d not found", id)
+	}
+	err = saveTasks(tasks)
+	if err != nil {
+		return err
+	}
+	if err := discardUndo(); err != nil {
+		return err
+	}
+	fmt.Printf("Task %d set to %s priority.\n", id, priority)
+	return nil
+}
+
 // Delete a task
 func deleteTask(id int) error {
 	tasks, err := loadTasks()
 	if err != nil {
 		return err
 	}
+	// Keep a copy for undo; removing from tasks below shifts its elements in place
+	original := append([]Task(nil), tasks...)
 	found := false
 	for i, task := range tasks {
 		if task.ID == id {
@@ -185,34 +504,161 @@ func deleteTask(id int) error {
 	if !found {
 		return fmt.Errorf("task with ID %d not found", id)
 	}
+	if err := saveUndo(fmt.Sprintf("delete task %d", id), original); err != nil {
+		return err
+	}
 	err = saveTasks(tasks)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Task %d deleted successfully.\n", id)
+	fmt.Printf("Task %d deleted successfully. Run \"undo\" to restore it.\n", id)
+	return nil
+}
+
+// Delete every task
+func clearTasks() error {
+	tasks, err := loadTasks()
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		fmt.Println("No tasks to clear.")
+		return nil
+	}
+	if err := saveUndo("clear", tasks); err != nil {
+		return err
+	}
+	if err := saveTasks([]Task{}); err != nil {
+		return err
+	}
+	fmt.Printf("Cleared %d tasks. Run \"undo\" to restore them.\n", len(tasks))
+	return nil
+}
+
+// Print a summary of the task list
+/**
+Prints the total number of tasks, how many are done, pending and overdue,
+how many have each priority, and the completion rate as a compact table:
+
+Total      5
+Done       2
+Pending    3
+Overdue    1
+High       1
+Medium     3
+Low        1
+Completed  40.0%
+
+Tasks without a priority count as medium, as they do when sorting.
+Tasks have no tags yet, so per-tag counts are not part of the summary.
+*/
+func showStats() error {
+	tasks, err := loadTasks()
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		fmt.Println("No tasks found.")
+		return nil
+	}
+
+	done, overdue := 0, 0
+	byRank := make(map[int]int)
+	now := time.Now()
+	for _, task := range tasks {
+		if task.Completed {
+			done++
+		}
+		if isOverdue(task, now) {
+			overdue++
+		}
+		byRank[priorityRank(task)]++
+	}
+	rate := float64(done) / float64(len(tasks)) * 100
+
+	fmt.Printf("%-10s %d\n", "Total", len(tasks))
+	fmt.Printf("%-10s %d\n", "Done", done)
+	fmt.Printf("%-10s %d\n", "Pending", len(tasks)-done)
+	fmt.Printf("%-10s %d\n", "Overdue", overdue)
+	fmt.Printf("%-10s %d\n", "High", byRank[priorityRanks["high"]])
+	fmt.Printf("%-10s %d\n", "Medium", byRank[priorityRanks["medium"]])
+	fmt.Printf("%-10s %d\n", "Low", byRank[priorityRanks["low"]])
+	fmt.Printf("%-10s %.1f%%\n", "Completed", rate)
 	return nil
 }
 
 // Main function
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: cli-task-manager [add|list|done|delete] [args]")
+		fmt.Println("Usage: cli-task-manager [add|list|search|done|priority|delete|clear|undo|stats] [args]")
 		return
 	}
 
 	command := os.Args[1]
 	switch command {
 	case "add":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: cli-task-manager add <task description>")
+		var description []string
+		dueDate, priority := "", ""
+		for i := 2; i < len(os.Args); i++ {
+			arg := os.Args[i]
+			switch {
+			case arg == "--due" && i+1 < len(os.Args):
+				i++
+				dueDate = os.Args[i]
+			case strings.HasPrefix(arg, "--due="):
+				dueDate = strings.TrimPrefix(arg, "--due=")
+			case arg == "--priority" && i+1 < len(os.Args):
+				i++
+				priority = os.Args[i]
+			case strings.HasPrefix(arg, "--priority="):
+				priority = strings.TrimPrefix(arg, "--priority=")
+			default:
+				description = append(description, arg)
+			}
+		}
+		if len(description) == 0 {
+			fmt.Println("Usage: cli-task-manager add <task description> [--due YYYY-MM-DD|RFC3339] [--priority low|medium|high]")
 			return
 		}
-		description := os.Args[2]
-		if err := addTask(description); err != nil {
+		if priority != "" {
+			level, err := parsePriority(priority)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			priority = level
+		}
+		if err := addTask(strings.Join(description, " "), dueDate, priority); err != nil {
 			fmt.Println("Error:", err)
 		}
 	case "list":
-		if err := listTasks(); err != nil {
+		byPriority := false
+		switch args := strings.Join(os.Args[2:], " "); args {
+		case "":
+		case "--sort priority", "--sort=priority":
+			byPriority = true
+		default:
+			fmt.Println("Usage: cli-task-manager list [--sort priority]")
+			return
+		}
+		if err := listTasks(byPriority); err != nil {
+			fmt.Println("Error:", err)
+		}
+	case "search":
+		useRegex := false
+		var query []string
+		for _, arg := range os.Args[2:] {
+			if arg == "--regex" {
+				useRegex = true
+				continue
+			}
+			query = append(query, arg)
+		}
+		if len(query) == 0 {
+			fmt.Println("Usage: cli-task-manager search [--regex] <query>")
+			return
+		}
+		if err := searchTasks(strings.Join(query, " "), useRegex); err != nil {
 			fmt.Println("Error:", err)
 		}
 	case "done":
@@ -228,6 +674,24 @@ func main() {
 		if err := markTaskDone(id); err != nil {
 			fmt.Println("Error:", err)
 		}
+	case "priority":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: cli-task-manager priority <task ID> <low|medium|high>")
+			return
+		}
+		id, err := strconv.Atoi(os.Args[2])
+		if err != nil || id <= 0 {
+			fmt.Println("Invalid task ID. Please enter a positive number.")
+			return
+		}
+		level, err := parsePriority(os.Args[3])
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if err := setPriority(id, level); err != nil {
+			fmt.Println("Error:", err)
+		}
 	case "delete":
 		if len(os.Args) < 3 {
 			fmt.Println("Usage: cli-task-manager delete <task ID>")
@@ -241,8 +705,20 @@ func main() {
 		if err := deleteTask(id); err != nil {
 			fmt.Println("Error:", err)
 		}
+	case "clear":
+		if err := clearTasks(); err != nil {
+			fmt.Println("Error:", err)
+		}
+	case "undo":
+		if err := undoLast(); err != nil {
+			fmt.Println("Error:", err)
+		}
+	case "stats":
+		if err := showStats(); err != nil {
+			fmt.Println("Error:", err)
+		}
 	default:
 		fmt.Println("Unknown command:", command)
-		fmt.Println("Usage: cli-task-manager [add|list|done|delete] [args]")
+		fmt.Println("Usage: cli-task-manager [add|list|search|done|priority|delete|clear|undo|stats] [args]")
 	}
 }
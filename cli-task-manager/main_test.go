@@ -0,0 +1,195 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// inTempDir runs the test in an empty directory, so tasks.json and the
+// other task files of the repository are left alone
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// taskIDs returns the IDs of the saved tasks, failing on duplicates
+func taskIDs(t *testing.T) []int {
+	t.Helper()
+	tasks, err := loadTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[int]bool)
+	var ids []int
+	for _, task := range tasks {
+		if seen[task.ID] {
+			t.Errorf("ID %d is used twice in %v", task.ID, tasks)
+		}
+		seen[task.ID] = true
+		ids = append(ids, task.ID)
+	}
+	return ids
+}
+
+func mustAdd(t *testing.T, description string) {
+	t.Helper()
+	if err := addTask(description, "", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Deleting a task must not free its ID for the next task
+func TestAddAfterDeleteDoesNotReuseIDs(t *testing.T) {
+	inTempDir(t)
+	mustAdd(t, "one")
+	mustAdd(t, "two")
+	mustAdd(t, "three")
+	if err := deleteTask(2); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, "four")
+
+	ids := taskIDs(t)
+	want := []int{1, 3, 4}
+	if len(ids) != len(want) {
+		t.Fatalf("got IDs %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("got IDs %v, want %v", ids, want)
+		}
+	}
+}
+
+// The last task's ID is not reused either, nor are IDs after a clear, and
+// a task brought back by undo keeps an ID no other task has
+func TestIDsAreNeverReused(t *testing.T) {
+	inTempDir(t)
+	mustAdd(t, "one")
+	mustAdd(t, "two")
+	if err := deleteTask(2); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, "three") // 3, not 2 again
+	if err := deleteTask(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := undoLast(); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, "four") // 4, not 3 again
+	if err := clearTasks(); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, "five")
+
+	if ids := taskIDs(t); len(ids) != 1 || ids[0] != 5 {
+		t.Errorf("after clear got IDs %v, want [5]", ids)
+	}
+	if err := undoLast(); err != nil {
+		t.Fatal(err)
+	}
+	taskIDs(t)
+}
+
+// Task lists saved before tasks.lastid existed continue after their highest ID
+func TestNextIDWithoutLastIDFile(t *testing.T) {
+	inTempDir(t)
+	if err := saveTasks([]Task{{ID: 7, Description: "old"}, {ID: 2, Description: "older"}}); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, "new")
+
+	ids := taskIDs(t)
+	if ids[len(ids)-1] != 8 {
+		t.Errorf("got IDs %v, want the new task to have ID 8", ids)
+	}
+}
+
+// Undo restores the list from before the last delete or clear, so it is
+// refused once anything else has changed, instead of dropping that change
+func TestUndoAfterLaterChanges(t *testing.T) {
+	inTempDir(t)
+	mustAdd(t, "one")
+	mustAdd(t, "two")
+	if err := deleteTask(1); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, "three")
+	if err := markTaskDone(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := undoLast(); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := loadTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 || tasks[0].ID != 2 || tasks[1].ID != 3 || !tasks[1].Completed {
+		t.Errorf("after undo got %+v, want tasks 2 and 3 with 3 done", tasks)
+	}
+}
+
+// Undo right after a delete still brings the task back
+func TestUndoDelete(t *testing.T) {
+	inTempDir(t)
+	mustAdd(t, "one")
+	if err := setPriority(1, "high"); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteTask(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := undoLast(); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, err := loadTasks(); err != nil || len(tasks) != 1 || tasks[0].Priority != "high" {
+		t.Errorf("after undo got %+v, %v, want task 1 with high priority", tasks, err)
+	}
+}
+
+// captureStdout returns what run prints
+func captureStdout(t *testing.T, run func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	runErr := run()
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if runErr != nil {
+		t.Fatal(runErr)
+	}
+	return string(out)
+}
+
+// Tasks without a priority are counted as medium
+func TestStatsCountsPriorities(t *testing.T) {
+	inTempDir(t)
+	for _, priority := range []string{"high", "", "medium", "low", "high"} {
+		if err := addTask("task", "", priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := captureStdout(t, showStats)
+	for _, row := range []string{"High       2", "Medium     2", "Low        1"} {
+		if !strings.Contains(out, row+"\n") {
+			t.Errorf("stats missing %q:\n%s", row, out)
+		}
+	}
+}
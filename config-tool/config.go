@@ -11,25 +11,70 @@ type Config struct {
 	AppName string `json:"app_name"`
 	Port    int    `json:"port"`
 	Debug   bool   `json:"debug"`
+
+	// AllowedHosts and Features show how arrays and objects are merged (see merge.go)
+	AllowedHosts []string        `json:"allowed_hosts"`
+	Features     map[string]bool `json:"features"`
+
+	// Sources lists the files that were merged, in the order they were applied
+	Sources []string `json:"-"`
 }
 
-// LoadConfig loads and merges default and environment-specific configs.
-func LoadConfig(env string) (*Config, error) {
+/*
+*
+LoadConfig loads and merges default and environment-specific configs,
+then layers any named profiles on top.
+
+Merge order (later files win):
+ 1. config/default.json
+ 2. config/<env>.json
+ 3. config/profiles/<profile>.json, once per profile in the order given
+
+Each file may be stored encrypted as <name>.json.enc instead (see crypto.go).
+
+Every file is merged on top of the layers before it with mergeLayer (see
+merge.go for how scalars, objects and arrays combine), and the final result is
+decoded into the Config struct.
+*/
+func LoadConfig(env string, profiles ...string) (*Config, error) {
 	basePath := "./config"
-	defaultConfigPath := filepath.Join(basePath, "default.json")
-	envConfigPath := filepath.Join(basePath, fmt.Sprintf("%s.json", env))
+	defaultConfigPath := resolveConfigPath(filepath.Join(basePath, "default.json"))
+	envConfigPath := resolveConfigPath(filepath.Join(basePath, fmt.Sprintf("%s.json", env)))
 
-	config := &Config{}
+	merged := make(map[string]interface{})
+	var sources []string
 
 	// Load default config
-	if err := loadFile(defaultConfigPath, config); err != nil {
+	if err := loadFile(defaultConfigPath, merged); err != nil {
 		return nil, fmt.Errorf("failed to load default config: %w", err)
 	}
+	sources = append(sources, defaultConfigPath)
 
 	// Load environment-specific config
-	if err := loadFile(envConfigPath, config); err != nil {
+	if err := loadFile(envConfigPath, merged); err != nil {
 		return nil, fmt.Errorf("failed to load %s config: %w", env, err)
 	}
+	sources = append(sources, envConfigPath)
+
+	// Load profiles last so they override both default and environment values
+	for _, profile := range profiles {
+		profilePath := resolveConfigPath(filepath.Join(basePath, "profiles", fmt.Sprintf("%s.json", profile)))
+		if err := loadFile(profilePath, merged); err != nil {
+			return nil, fmt.Errorf("failed to load %s profile: %w", profile, err)
+		}
+		sources = append(sources, profilePath)
+	}
+
+	// Decode the merged layers into the typed config
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid merged config: %w", err)
+	}
+	config.Sources = sources
 
 	return config, nil
 }
@@ -38,32 +83,45 @@ func LoadConfig(env string) (*Config, error) {
 Parameters:
 
 filePath string: The path to the JSON file you want to load.
-config *Config: A pointer to a Config struct where the data will be loaded.
+merged map[string]interface{}: The layers loaded so far; the file is merged into it.
 Return Value:
 
 It returns an error. If something goes wrong, it provides details about the issue.
 
 */
-// Helper to load a file into the config struct
-func loadFile(filePath string, config *Config) error {
+// Helper to load a file and merge it into the layers below it
+func loadFile(filePath string, merged map[string]interface{}) error {
 
-	// Opens the file at filePath for reading using os.Open.
-	file, err := os.Open(filePath)
+	// Reads the whole file at filePath using os.ReadFile.
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	/** Creates a new JSON decoder for the file. The decoder will read the JSON
-	data from the file stream.
+	// Encrypted files are recognised by their marker line and decrypted in memory
+	if isEncrypted(data) {
+		if data, err = decryptConfig(data); err != nil {
+			return err
+		}
+	}
 
-	Uses the Decode method to parse the JSON data and populate the config struct.
+	/** Uses json.Unmarshal to parse the JSON data into a generic map, so arrays
+	and objects can be merged with the layers below instead of overwritten.
 	If decoding fails (e.g., due to invalid JSON structure), it returns the decoding error.
 	*/
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(config); err != nil {
+	var layer map[string]interface{}
+	if err := json.Unmarshal(data, &layer); err != nil {
+		return err
+	}
+
+	directives, err := parseMergeDirectives(layer)
+	if err != nil {
+		return err
+	}
+	if err := validateDirectives(layer, directives); err != nil {
 		return err
 	}
+	mergeLayer(merged, layer, directives, "")
 
 	return nil
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+*
+Encryption at rest:
+Config files holding secrets can be stored encrypted with AES-256-GCM. An
+encrypted file starts with a marker line followed by the base64 of the random
+nonce and the ciphertext:
+
+	config-tool:aes-256-gcm:v1
+	<base64(nonce || ciphertext)>
+
+Encrypted files use the extension ".json.enc". LoadConfig looks for
+<name>.json first and falls back to <name>.json.enc, and any file starting
+with the marker is decrypted in memory before it is merged, so plain and
+encrypted layers can be mixed freely.
+
+The 32-byte key is read, base64 encoded, from the CONFIG_KEY environment
+variable or from the file named by CONFIG_KEY_FILE. Generate one with
+-gen-key and encrypt a plaintext file with -encrypt <file>.
+*/
+const (
+	encryptedMarker    = "config-tool:aes-256-gcm:v1"
+	encryptedExtension = ".enc"
+)
+
+// loadKey reads the encryption key from CONFIG_KEY or CONFIG_KEY_FILE
+func loadKey() ([]byte, error) {
+	encoded := os.Getenv("CONFIG_KEY")
+	if encoded == "" {
+		path := os.Getenv("CONFIG_KEY_FILE")
+		if path == "" {
+			return nil, errors.New("no encryption key: set CONFIG_KEY or CONFIG_KEY_FILE")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading key file: %w", err)
+		}
+		encoded = string(data)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// isEncrypted reports whether file contents start with the encryption marker
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedMarker+"\n"))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptConfig returns the plaintext JSON of an encrypted config file
+func decryptConfig(data []byte) ([]byte, error) {
+	key, err := loadKey()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := bytes.TrimSpace(data[len(encryptedMarker)+1:])
+	sealed, err := base64.StdEncoding.DecodeString(string(payload))
+	if err != nil {
+		return nil, fmt.Errorf("encrypted config is not valid base64: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted config is truncated")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("decrypting config failed: wrong key or corrupted file")
+	}
+	return plaintext, nil
+}
+
+// encryptConfig seals plaintext JSON into the encrypted file format
+func encryptConfig(plaintext []byte) ([]byte, error) {
+	key, err := loadKey()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return []byte(encryptedMarker + "\n" + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// encryptFile writes path + ".enc" with the encrypted contents of path.
+// The plaintext file is left in place for the user to remove.
+func encryptFile(path string) (string, error) {
+	plaintext, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if isEncrypted(plaintext) {
+		return "", fmt.Errorf("%s is already encrypted", path)
+	}
+	sealed, err := encryptConfig(plaintext)
+	if err != nil {
+		return "", err
+	}
+	out := path + encryptedExtension
+	if err := os.WriteFile(out, sealed, 0600); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// generateKey returns a new random key, base64 encoded for CONFIG_KEY
+func generateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// resolveConfigPath returns path, or its encrypted variant when only that exists
+func resolveConfigPath(path string) string {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(path + encryptedExtension); err == nil {
+			return path + encryptedExtension
+		}
+	}
+	return path
+}
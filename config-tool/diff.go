@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FieldDiff describes one config field in two environments
+type FieldDiff struct {
+	Field   string      `json:"field"`
+	Left    interface{} `json:"left"`
+	Right   interface{} `json:"right"`
+	Differs bool        `json:"differs"`
+}
+
+/*
+*
+DiffConfigs compares two effective configs field by field.
+
+Both configs are converted to their JSON form first, so the comparison uses
+the same field names as the config files and nested objects are compared
+key by key (reported as "parent.child"). Fields missing on one side are
+reported with a nil value.
+*/
+func DiffConfigs(left, right *Config) ([]FieldDiff, error) {
+	leftFields, err := flattenConfig(left)
+	if err != nil {
+		return nil, err
+	}
+	rightFields, err := flattenConfig(right)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for name := range leftFields {
+		names[name] = true
+	}
+	for name := range rightFields {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diffs []FieldDiff
+	for _, name := range sorted {
+		l, r := leftFields[name], rightFields[name]
+		diffs = append(diffs, FieldDiff{
+			Field:   name,
+			Left:    l,
+			Right:   r,
+			Differs: !reflect.DeepEqual(l, r),
+		})
+	}
+	return diffs, nil
+}
+
+// flattenConfig turns a config into a map of dotted field names to values
+func flattenConfig(config *Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{})
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		if obj, ok := value.(map[string]interface{}); ok && len(obj) > 0 {
+			for key, child := range obj {
+				walk(prefix+"."+key, child)
+			}
+			return
+		}
+		fields[strings.TrimPrefix(prefix, ".")] = value
+	}
+	walk("", tree)
+	return fields, nil
+}
+
+// diffEnvironments loads two environments and prints their differences
+func diffEnvironments(leftEnv, rightEnv string, profiles []string, asJSON bool) error {
+	left, err := LoadConfig(leftEnv, profiles...)
+	if err != nil {
+		return err
+	}
+	right, err := LoadConfig(rightEnv, profiles...)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := DiffConfigs(left, right)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]interface{}{
+			"left":   leftEnv,
+			"right":  rightEnv,
+			"fields": diffs,
+		})
+	}
+
+	// Differing fields are marked with "*" so they stand out
+	changed := 0
+	fmt.Printf("  %-20s %-20s %s\n", "FIELD", strings.ToUpper(leftEnv), strings.ToUpper(rightEnv))
+	for _, diff := range diffs {
+		marker := " "
+		if diff.Differs {
+			marker = "*"
+			changed++
+		}
+		fmt.Printf("%s %-20s %-20s %s\n", marker, diff.Field, formatValue(diff.Left), formatValue(diff.Right))
+	}
+	fmt.Printf("\n%d of %d fields differ between %s and %s\n", changed, len(diffs), leftEnv, rightEnv)
+	return nil
+}
+
+// formatValue renders a config value compactly for the diff table
+func formatValue(value interface{}) string {
+	if value == nil {
+		return "(unset)"
+	}
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
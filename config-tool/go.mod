@@ -1,3 +1,7 @@
 module config-tool
 
 go 1.23.4
+
+require github.com/fsnotify/fsnotify v1.8.0
+
+require golang.org/x/sys v0.28.0 // indirect
@@ -1,25 +1,141 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// profileList collects --profile flags. The flag can be repeated or given a
+// comma-separated list, e.g. --profile highmem --profile debug or --profile highmem,debug
+type profileList []string
+
+func (p *profileList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *profileList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*p = append(*p, name)
+		}
+	}
+	return nil
+}
+
 func main() {
+	var profiles profileList
+	flag.Var(&profiles, "profile", "Profile from config/profiles to layer on top (repeatable, applied in order)")
+	watch := flag.Bool("watch", false, "Keep running and print the config again whenever its files change")
+	diff := flag.Bool("diff", false, "Compare two environments field by field: -diff <env1> <env2>")
+	asJSON := flag.Bool("json", false, "Print -diff output as JSON")
+	encrypt := flag.String("encrypt", "", "Encrypt a plaintext config file to <file>.enc using CONFIG_KEY or CONFIG_KEY_FILE")
+	execCommand := flag.String("exec", "", "Run this command and restart or signal it whenever the config changes")
+	reload := flag.String("reload", "restart", "How -exec applies a new config: restart or sighup")
+	stopTimeout := flag.Duration("stop-timeout", 10*time.Second, "How long -exec waits for the child to stop before killing it")
+	genKey := flag.Bool("gen-key", false, "Print a new random encryption key for CONFIG_KEY")
+	flag.Parse()
+
+	if *genKey {
+		key, err := generateKey()
+		if err != nil {
+			log.Fatalf("Error generating key: %v", err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	if *encrypt != "" {
+		out, err := encryptFile(*encrypt)
+		if err != nil {
+			log.Fatalf("Error encrypting %s: %v", *encrypt, err)
+		}
+		fmt.Printf("Encrypted %s to %s. Remove the plaintext file once the encrypted one is in place.\n", *encrypt, out)
+		return
+	}
+
+	if *diff {
+		if flag.NArg() != 2 {
+			log.Fatalf("Usage: config-tool -diff [-json] <env1> <env2>")
+		}
+		if err := diffEnvironments(flag.Arg(0), flag.Arg(1), profiles, *asJSON); err != nil {
+			log.Fatalf("Error comparing configs: %v", err)
+		}
+		return
+	}
+
 	// Get environment from arguments or use "development" as default
 	env := "development"
-	if len(os.Args) > 1 {
-		env = os.Args[1]
+	if flag.NArg() > 0 {
+		env = flag.Arg(0)
+	}
+
+	if *execCommand != "" {
+		if err := superviseCommand(env, profiles, *execCommand, *reload, *stopTimeout); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	if *watch {
+		watchConfig(env, profiles)
+		return
+	}
+
+	config, err := LoadConfig(env, profiles...)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
 	}
 
-	config, err := LoadConfig(env)
+	printConfig(env, config)
+}
+
+// watchConfig prints the config, then prints it again after every reload until interrupted
+func watchConfig(env string, profiles []string) {
+	watcher, err := NewConfigWatcher(env, profiles...)
 	if err != nil {
 		log.Fatalf("Error loading config: %v", err)
 	}
 
+	updates := watcher.Subscribe()
+	printConfig(env, watcher.Current())
+
+	// Close the watcher on Ctrl+C, which also closes the updates channel
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		watcher.Close()
+	}()
+
+	for config := range updates {
+		fmt.Println("\nConfiguration changed, reloaded.")
+		printConfig(env, config)
+	}
+}
+
+func printConfig(env string, config *Config) {
 	fmt.Printf("Loaded Configuration for %s:\n", env)
 	fmt.Printf("App Name: %s\n", config.AppName)
 	fmt.Printf("Port: %d\n", config.Port)
 	fmt.Printf("Debug Mode: %v\n", config.Debug)
+	fmt.Printf("Allowed Hosts: %s\n", strings.Join(config.AllowedHosts, ", "))
+
+	features := make([]string, 0, len(config.Features))
+	for name, enabled := range config.Features {
+		features = append(features, fmt.Sprintf("%s=%v", name, enabled))
+	}
+	sort.Strings(features)
+	fmt.Printf("Features: %s\n", strings.Join(features, ", "))
+
+	fmt.Println("Merge order:")
+	for i, source := range config.Sources {
+		fmt.Printf("  %d. %s\n", i+1, source)
+	}
 }
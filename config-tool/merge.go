@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+*
+Merge semantics:
+Each config file is a layer merged on top of the result of the layers before it.
+How a value is merged depends on its type:
+
+Scalars (strings, numbers, booleans) replace the previous value.
+
+Objects (maps and nested structs) are merged key by key: keys in the new layer
+are merged recursively, keys it leaves out keep their old value. Setting a key
+to null removes it.
+
+Arrays replace the previous array by default. A layer can ask for its array to
+be appended instead with a "$merge" block naming the field:
+
+	{
+	  "$merge": {"allowed_hosts": "append"},
+	  "allowed_hosts": ["dev.local"]
+	}
+
+"$merge" keys are dotted paths for nested fields (e.g. "database.replicas"),
+and the strategy only applies to the file that declares it, so every layer
+states its own intent.
+*/
+const mergeDirectiveKey = "$merge"
+
+// SliceMerge is how an array in a layer is combined with the array below it
+type SliceMerge string
+
+const (
+	SliceReplace SliceMerge = "replace"
+	SliceAppend  SliceMerge = "append"
+)
+
+// parseMergeDirectives reads and removes the "$merge" block of a layer
+func parseMergeDirectives(layer map[string]interface{}) (map[string]SliceMerge, error) {
+	raw, ok := layer[mergeDirectiveKey]
+	if !ok {
+		return nil, nil
+	}
+	delete(layer, mergeDirectiveKey)
+
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%q must be an object of field paths to strategies", mergeDirectiveKey)
+	}
+	directives := make(map[string]SliceMerge, len(block))
+	for path, value := range block {
+		strategy, _ := value.(string)
+		switch SliceMerge(strategy) {
+		case SliceReplace, SliceAppend:
+			directives[path] = SliceMerge(strategy)
+		default:
+			return nil, fmt.Errorf("%s %q: unknown strategy %v (use %q or %q)", mergeDirectiveKey, path, value, SliceReplace, SliceAppend)
+		}
+	}
+	return directives, nil
+}
+
+// mergeLayer merges src into dst in place following the rules above.
+// path is the dotted path of dst, "" at the top level.
+func mergeLayer(dst, src map[string]interface{}, directives map[string]SliceMerge, path string) {
+	for key, value := range src {
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+
+		switch srcValue := value.(type) {
+		case map[string]interface{}:
+			if dstValue, ok := dst[key].(map[string]interface{}); ok {
+				mergeLayer(dstValue, srcValue, directives, fieldPath)
+				continue
+			}
+		case []interface{}:
+			if dstValue, ok := dst[key].([]interface{}); ok && directives[fieldPath] == SliceAppend {
+				dst[key] = append(dstValue, srcValue...)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// validateDirectives reports "$merge" paths that name a field which is not an array
+func validateDirectives(layer map[string]interface{}, directives map[string]SliceMerge) error {
+	for path := range directives {
+		var value interface{} = layer
+		for _, part := range strings.Split(path, ".") {
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				value = nil
+				break
+			}
+			value = obj[part]
+		}
+		if _, ok := value.([]interface{}); !ok {
+			return fmt.Errorf("%s %q: field is not an array in this file", mergeDirectiveKey, path)
+		}
+	}
+	return nil
+}
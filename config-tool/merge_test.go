@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decode parses a JSON object the way loadFile does
+func decode(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	var value map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	return value
+}
+
+func TestMergeLayer(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  string
+		layer string
+		want  string
+	}{
+		{
+			name:  "scalars replace",
+			base:  `{"port": 8080, "debug": false, "name": "app"}`,
+			layer: `{"port": 9090, "debug": true}`,
+			want:  `{"port": 9090, "debug": true, "name": "app"}`,
+		},
+		{
+			name:  "slices replace by default",
+			base:  `{"allowed_hosts": ["a", "b"], "port": 8080}`,
+			layer: `{"allowed_hosts": ["c"]}`,
+			want:  `{"allowed_hosts": ["c"], "port": 8080}`,
+		},
+		{
+			name:  "slices replace when asked",
+			base:  `{"allowed_hosts": ["a", "b"]}`,
+			layer: `{"$merge": {"allowed_hosts": "replace"}, "allowed_hosts": ["c"]}`,
+			want:  `{"allowed_hosts": ["c"]}`,
+		},
+		{
+			name:  "slices append",
+			base:  `{"allowed_hosts": ["a", "b"], "ports": [1]}`,
+			layer: `{"$merge": {"allowed_hosts": "append"}, "allowed_hosts": ["c"], "ports": [2]}`,
+			want:  `{"allowed_hosts": ["a", "b", "c"], "ports": [2]}`,
+		},
+		{
+			name:  "append without a slice below sets it",
+			base:  `{"port": 8080}`,
+			layer: `{"$merge": {"allowed_hosts": "append"}, "allowed_hosts": ["c"]}`,
+			want:  `{"port": 8080, "allowed_hosts": ["c"]}`,
+		},
+		{
+			name:  "maps merge key by key",
+			base:  `{"database": {"host": "db", "port": 5432, "pool": {"min": 1, "max": 10}}}`,
+			layer: `{"database": {"port": 6543, "pool": {"max": 50}}}`,
+			want:  `{"database": {"host": "db", "port": 6543, "pool": {"min": 1, "max": 50}}}`,
+		},
+		{
+			name:  "map replaces a scalar",
+			base:  `{"features": "none"}`,
+			layer: `{"features": {"beta": true}}`,
+			want:  `{"features": {"beta": true}}`,
+		},
+		{
+			name:  "null removes a key",
+			base:  `{"port": 8080, "debug": true}`,
+			layer: `{"debug": null}`,
+			want:  `{"port": 8080}`,
+		},
+		{
+			name:  "null removes a nested key",
+			base:  `{"database": {"host": "db", "password": "secret"}}`,
+			layer: `{"database": {"password": null}}`,
+			want:  `{"database": {"host": "db"}}`,
+		},
+		{
+			name:  "dotted path appends a nested slice",
+			base:  `{"database": {"replicas": ["r1"], "host": "db"}}`,
+			layer: `{"$merge": {"database.replicas": "append"}, "database": {"replicas": ["r2"]}}`,
+			want:  `{"database": {"replicas": ["r1", "r2"], "host": "db"}}`,
+		},
+		{
+			name:  "directive applies only to its own path",
+			base:  `{"replicas": ["top"], "database": {"replicas": ["r1"]}}`,
+			layer: `{"$merge": {"replicas": "append"}, "replicas": ["more"], "database": {"replicas": ["r2"]}}`,
+			want:  `{"replicas": ["top", "more"], "database": {"replicas": ["r2"]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, layer := decode(t, tt.base), decode(t, tt.layer)
+			directives, err := parseMergeDirectives(layer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validateDirectives(layer, directives); err != nil {
+				t.Fatal(err)
+			}
+			mergeLayer(dst, layer, directives, "")
+			if want := decode(t, tt.want); !reflect.DeepEqual(dst, want) {
+				t.Errorf("got %v, want %v", dst, want)
+			}
+		})
+	}
+}
+
+func TestParseMergeDirectives(t *testing.T) {
+	tests := []struct {
+		name    string
+		layer   string
+		want    map[string]SliceMerge
+		wantErr string
+	}{
+		{
+			name:  "no block",
+			layer: `{"port": 8080}`,
+		},
+		{
+			name:  "strategies by path",
+			layer: `{"$merge": {"allowed_hosts": "append", "database.replicas": "replace"}}`,
+			want:  map[string]SliceMerge{"allowed_hosts": SliceAppend, "database.replicas": SliceReplace},
+		},
+		{
+			name:    "block is not an object",
+			layer:   `{"$merge": ["allowed_hosts"]}`,
+			wantErr: "must be an object",
+		},
+		{
+			name:    "unknown strategy",
+			layer:   `{"$merge": {"allowed_hosts": "prepend"}}`,
+			wantErr: "unknown strategy prepend",
+		},
+		{
+			name:    "strategy is not a string",
+			layer:   `{"$merge": {"allowed_hosts": true}}`,
+			wantErr: "unknown strategy true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layer := decode(t, tt.layer)
+			got, err := parseMergeDirectives(layer)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) || (len(tt.want) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if _, ok := layer[mergeDirectiveKey]; ok {
+				t.Errorf("%s block left in the layer", mergeDirectiveKey)
+			}
+		})
+	}
+}
+
+func TestValidateDirectives(t *testing.T) {
+	tests := []struct {
+		name    string
+		layer   string
+		paths   []string
+		wantErr bool
+	}{
+		{"top-level array", `{"allowed_hosts": ["a"]}`, []string{"allowed_hosts"}, false},
+		{"dotted path to an array", `{"database": {"replicas": ["r1"]}}`, []string{"database.replicas"}, false},
+		{"scalar", `{"port": 8080}`, []string{"port"}, true},
+		{"object", `{"database": {"replicas": ["r1"]}}`, []string{"database"}, true},
+		{"missing field", `{"allowed_hosts": ["a"]}`, []string{"hosts"}, true},
+		{"path through a scalar", `{"database": "db"}`, []string{"database.replicas"}, true},
+		{"null", `{"allowed_hosts": null}`, []string{"allowed_hosts"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directives := make(map[string]SliceMerge)
+			for _, path := range tt.paths {
+				directives[path] = SliceAppend
+			}
+			err := validateDirectives(decode(t, tt.layer), directives)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+/*
+*
+Supervising a process:
+With -exec, config-tool runs a command and keeps it running with the current
+config. The config files are watched as with -watch, and after every
+successful reload the child is either restarted (-reload restart, the
+default) or sent SIGHUP (-reload sighup) so it can re-read its config itself.
+A reload that fails keeps the previous config and leaves the child alone.
+
+The command runs through the shell (sh -c, or cmd /C on Windows) with
+CONFIG_ENV set to the environment name. Starting it with "exec", as in
+-exec 'exec ./server', lets signals reach the program rather than the shell.
+
+If the child exits on its own it is started again after restartDelay.
+On SIGINT or SIGTERM the child is stopped (SIGTERM, then killed after
+-stop-timeout) before config-tool exits.
+*/
+
+// restartDelay is how long to wait before restarting a child that exited
+const restartDelay = time.Second
+
+// child is a running command and a channel that receives its exit status
+type child struct {
+	cmd    *exec.Cmd
+	exited chan error
+}
+
+func startChild(command, env string) (*child, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "CONFIG_ENV="+env)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &child{cmd: cmd, exited: make(chan error, 1)}
+	go func() { c.exited <- cmd.Wait() }()
+	log.Printf("Started %q (pid %d)", command, cmd.Process.Pid)
+	return c, nil
+}
+
+// stop asks the child to terminate and kills it if it is still running
+// after timeout
+func (c *child) stop(timeout time.Duration) {
+	if err := c.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		// Windows cannot deliver SIGTERM; the process may also be gone already
+		c.cmd.Process.Kill()
+	}
+	select {
+	case <-c.exited:
+	case <-time.After(timeout):
+		log.Printf("Child %d did not stop within %s, killing it", c.cmd.Process.Pid, timeout)
+		c.cmd.Process.Kill()
+		<-c.exited
+	}
+}
+
+// superviseCommand runs command and restarts or signals it whenever the
+// config is reloaded, until config-tool is interrupted
+func superviseCommand(env string, profiles []string, command, reload string, stopTimeout time.Duration) error {
+	if reload != "restart" && reload != "sighup" {
+		return fmt.Errorf("unknown -reload %q (use restart or sighup)", reload)
+	}
+
+	watcher, err := NewConfigWatcher(env, profiles...)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	updates := watcher.Subscribe()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	proc, err := startChild(command, env)
+	if err != nil {
+		return err
+	}
+
+	var restart <-chan time.Time
+	for {
+		// A nil channel blocks, so exits are only awaited while a child runs
+		var exited chan error
+		if proc != nil {
+			exited = proc.exited
+		}
+
+		select {
+		case _, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			switch {
+			case proc == nil:
+				// Waiting to restart after an exit; start right away instead
+				log.Println("Configuration changed, starting child")
+			case reload == "sighup":
+				log.Printf("Configuration changed, sending SIGHUP to %d", proc.cmd.Process.Pid)
+				if err := proc.cmd.Process.Signal(syscall.SIGHUP); err != nil {
+					log.Printf("Sending SIGHUP failed: %v", err)
+				}
+				continue
+			default:
+				log.Println("Configuration changed, restarting child")
+				proc.stop(stopTimeout)
+			}
+			restart = nil
+			if proc, err = startChild(command, env); err != nil {
+				log.Printf("Starting child failed: %v", err)
+				restart = time.After(restartDelay)
+			}
+
+		case err := <-exited:
+			log.Printf("Child exited (%v), restarting in %s", exitDescription(err), restartDelay)
+			proc = nil
+			restart = time.After(restartDelay)
+
+		case <-restart:
+			restart = nil
+			if proc, err = startChild(command, env); err != nil {
+				log.Printf("Starting child failed: %v", err)
+				restart = time.After(restartDelay)
+			}
+
+		case sig := <-sigs:
+			log.Printf("Received %s, stopping child", sig)
+			if proc != nil {
+				proc.stop(stopTimeout)
+			}
+			return nil
+		}
+	}
+}
+
+func exitDescription(err error) string {
+	if err == nil {
+		return "status 0"
+	}
+	return err.Error()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+/*
+*
+ConfigWatcher keeps a Config up to date while the program runs.
+
+It watches the config directory (and config/profiles) with fsnotify. When one
+of the files that make up the current config changes, the whole config is
+loaded again with LoadConfig. If that succeeds the new *Config is sent to every
+subscriber; if it fails the error is logged and the previous config is kept.
+
+Editors often write a file in several steps, so events are debounced and the
+reload happens once things have been quiet for reloadDelay.
+*/
+type ConfigWatcher struct {
+	env      string
+	profiles []string
+
+	mu          sync.Mutex
+	current     *Config
+	subscribers []chan *Config
+	closed      bool
+
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// reloadDelay is how long to wait after the last file event before reloading
+const reloadDelay = 200 * time.Millisecond
+
+// NewConfigWatcher loads the config once and starts watching its files
+func NewConfigWatcher(env string, profiles ...string) (*ConfigWatcher, error) {
+	config, err := LoadConfig(env, profiles...)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// Watch directories rather than files so editors that replace the file
+	// (write to a temp file, then rename) are still noticed
+	dirs := make(map[string]bool)
+	for _, source := range config.Sources {
+		dirs[filepath.Dir(source)] = true
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	cw := &ConfigWatcher{
+		env:      env,
+		profiles: profiles,
+		current:  config,
+		watcher:  watcher,
+		done:     make(chan struct{}),
+	}
+	go cw.run()
+	return cw, nil
+}
+
+// Current returns the most recently loaded config
+func (cw *ConfigWatcher) Current() *Config {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return cw.current
+}
+
+/*
+*
+Subscribe returns a channel that receives the new config after every
+successful reload. The channel holds only the latest config: a slow reader
+never blocks the watcher, it just skips straight to the newest version.
+The channel is closed when the watcher is closed.
+*/
+func (cw *ConfigWatcher) Subscribe() <-chan *Config {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	ch := make(chan *Config, 1)
+	if cw.closed {
+		close(ch)
+		return ch
+	}
+	cw.subscribers = append(cw.subscribers, ch)
+	return ch
+}
+
+// Close stops watching and closes every subscriber channel
+func (cw *ConfigWatcher) Close() error {
+	cw.mu.Lock()
+	if cw.closed {
+		cw.mu.Unlock()
+		return nil
+	}
+	cw.closed = true
+	cw.mu.Unlock()
+
+	err := cw.watcher.Close()
+	<-cw.done
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	for _, ch := range cw.subscribers {
+		close(ch)
+	}
+	cw.subscribers = nil
+	return err
+}
+
+// run waits for file events and reloads once they settle
+func (cw *ConfigWatcher) run() {
+	defer close(cw.done)
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case event, ok := <-cw.watcher.Events:
+			if !ok {
+				return
+			}
+			if cw.isSource(event.Name) && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				reload = time.After(reloadDelay)
+			}
+		case err, ok := <-cw.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Config watcher error: %v", err)
+		case <-reload:
+			reload = nil
+			cw.reload()
+		}
+	}
+}
+
+// isSource reports whether path is one of the files merged into the config
+func (cw *ConfigWatcher) isSource(path string) bool {
+	for _, source := range cw.Current().Sources {
+		if filepath.Clean(source) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload loads the config again and notifies subscribers on success
+func (cw *ConfigWatcher) reload() {
+	config, err := LoadConfig(cw.env, cw.profiles...)
+	if err != nil {
+		log.Printf("Config reload failed, keeping previous config: %v", err)
+		return
+	}
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	cw.current = config
+	for _, ch := range cw.subscribers {
+		// Replace any config the subscriber has not read yet
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- config
+	}
+}
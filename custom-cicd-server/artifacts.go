@@ -0,0 +1,127 @@
+package main
+
+/**
+Build artifacts:
+The pipeline config can list files a build produces that should be kept for
+download, as glob patterns relative to the server's working directory:
+
+artifacts: ["bin/*", "coverage.out"]
+artifact_retention: 72h    # default 168h (7 days)
+
+After a successful build every matching regular file is copied into
+.ci-artifacts/<build id>/, listed in the build's status under "artifacts",
+and served at GET /artifacts/{id}/{name}. Files are stored by base name, so
+when two patterns match files with the same name the first one wins.
+
+Whenever a build finishes, artifact directories older than the retention
+period are deleted and removed from their builds' statuses. Saving artifacts
+is best-effort: a file that cannot be copied is logged and the build still
+succeeds.
+*/
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// artifactRoot holds one directory of saved artifacts per build
+const artifactRoot = ".ci-artifacts"
+
+// defaultArtifactRetention is how long artifacts are kept without artifact_retention
+const defaultArtifactRetention = 7 * 24 * time.Hour
+
+// saveArtifacts copies the files matching patterns into the build's artifact
+// directory and returns their names
+func saveArtifacts(patterns []string, buildID string) []string {
+	dir := filepath.Join(artifactRoot, buildID)
+	var names []string
+	saved := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Printf("Build %s: bad artifact pattern %q: %v", buildID, pattern, err)
+			continue
+		}
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			name := filepath.Base(path)
+			if saved[name] {
+				log.Printf("Build %s: artifact %s skipped, a file named %s was already saved", buildID, path, name)
+				continue
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				log.Printf("Build %s: artifacts not saved: %v", buildID, err)
+				return names
+			}
+			if err := copyFile(path, filepath.Join(dir, name), info.Mode().Perm()); err != nil {
+				log.Printf("Build %s: failed to save artifact %s: %v", buildID, path, err)
+				continue
+			}
+			saved[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		log.Printf("Build %s: saved %d artifact(s)", buildID, len(names))
+	}
+	return names
+}
+
+// pruneArtifacts deletes the artifact directories older than retention
+func pruneArtifacts(retention time.Duration) {
+	if retention <= 0 {
+		retention = defaultArtifactRetention
+	}
+	entries, err := os.ReadDir(artifactRoot)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !entry.IsDir() || time.Since(info.ModTime()) < retention {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(artifactRoot, entry.Name())); err != nil {
+			log.Printf("Failed to remove old artifacts of build %s: %v", entry.Name(), err)
+			continue
+		}
+		builds.SetArtifacts(entry.Name(), nil)
+		log.Printf("Removed artifacts of build %s (older than %s)", entry.Name(), retention)
+	}
+}
+
+// downloadArtifact serves one saved artifact of a build
+func downloadArtifact(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, name := vars["id"], vars["name"]
+
+	// Both parts become path elements, so refuse anything that could leave artifactRoot
+	if id != filepath.Base(id) || name != filepath.Base(name) || id == ".." || name == ".." {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(filepath.Join(artifactRoot, id, name))
+	if err != nil {
+		http.Error(w, "Artifact not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.Error(w, "Artifact not found", http.StatusNotFound)
+		return
+	}
+
+	// ServeContent sets Content-Type from the extension, or by sniffing the content
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
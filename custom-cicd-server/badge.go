@@ -0,0 +1,103 @@
+package main
+
+/**
+Build badges:
+GET /badge/{pipeline} returns an SVG badge with the status of the most recent
+build of that pipeline, ready to embed in a README:
+
+	![build](http://ci.example.com/badge/default)
+
+Build status  -> badge text   color
+Success       -> passing      green
+Failed        -> failing      red
+In Progress   -> running      yellow
+Queued        -> queued       yellow
+Interrupted   -> interrupted  grey
+(no builds)   -> unknown      grey
+
+The badge is always returned with 200 so markdown renderers show "unknown"
+instead of a broken image. Cache-Control: no-cache makes GitHub's image proxy
+and browsers revalidate, so the badge follows new builds.
+*/
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// badgeStyles maps a build status to the badge message and color
+var badgeStyles = map[string]struct{ message, color string }{
+	"Success":     {"passing", "#4c1"},
+	"Failed":      {"failing", "#e05d44"},
+	"In Progress": {"running", "#dfb317"},
+	"Queued":      {"queued", "#dfb317"},
+	"Interrupted": {"interrupted", "#9f9f9f"},
+	"Cancelled":   {"cancelled", "#9f9f9f"},
+}
+
+// latestBuild returns the most recently started build of a pipeline
+func latestBuild(pipeline string) (BuildStatus, bool) {
+	var latest BuildStatus
+	found := false
+	for _, build := range builds.All() {
+		if build.Pipeline != pipeline {
+			continue
+		}
+		if !found || build.StartedAt.After(latest.StartedAt) {
+			latest = build
+			found = true
+		}
+	}
+	return latest, found
+}
+
+// buildBadge serves the status badge for a pipeline
+func buildBadge(w http.ResponseWriter, r *http.Request) {
+	pipeline := mux.Vars(r)["pipeline"]
+
+	message, color := "unknown", "#9f9f9f"
+	if build, ok := latestBuild(pipeline); ok {
+		if style, ok := badgeStyles[build.Status]; ok {
+			message, color = style.message, style.color
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, max-age=0")
+	w.Header().Set("Expires", "0")
+	fmt.Fprint(w, renderBadge("build", message, color))
+}
+
+// textWidth roughly estimates the rendered width of text in 11px Verdana
+func textWidth(text string) int {
+	return len(text)*7 + 10
+}
+
+// renderBadge draws a two-part badge in the flat style used by shields.io
+func renderBadge(label, message, color string) string {
+	labelWidth := textWidth(label)
+	messageWidth := textWidth(message)
+	width := labelWidth + messageWidth
+	label, message = html.EscapeString(label), html.EscapeString(message)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">
+<title>%[4]s: %[5]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect width="%[2]d" height="20" fill="#555"/>
+<rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/>
+<rect width="%[1]d" height="20" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[7]d" y="15" fill="#010101" fill-opacity=".3">%[4]s</text>
+<text x="%[7]d" y="14">%[4]s</text>
+<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[5]s</text>
+<text x="%[8]d" y="14">%[5]s</text>
+</g>
+</svg>
+`, width, labelWidth, messageWidth, label, message, color, labelWidth/2, labelWidth+messageWidth/2)
+}
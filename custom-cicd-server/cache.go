@@ -0,0 +1,179 @@
+package main
+
+/**
+Dependency cache:
+Builds often spend most of their time downloading the same dependencies.
+The pipeline config can declare directories to keep between builds:
+
+cache:
+  key_files: ["go.sum"]
+  paths: [".cache/go-mod"]
+
+The cache key is a SHA-256 hash of the key files, so the cache is reused
+until a lockfile changes. Before the steps run, a saved copy for the key is
+restored into paths. After a successful build the paths are saved under the
+key if nothing is stored for it yet. A missing cache or a failed restore/save
+is only logged; the build carries on without the cache.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// cacheRoot is where saved caches live, one directory per cache key
+const cacheRoot = ".ci-cache"
+
+// CacheConfig declares which paths to preserve and which files decide the key
+type CacheConfig struct {
+	KeyFiles []string `yaml:"key_files"`
+	Paths    []string `yaml:"paths"`
+}
+
+// enabled reports whether the pipeline declared anything to cache
+func (c CacheConfig) enabled() bool {
+	return len(c.Paths) > 0
+}
+
+// cacheKey hashes the contents of the key files into a directory-safe key
+func cacheKey(cache CacheConfig) (string, error) {
+	hash := sha256.New()
+	for _, path := range cache.KeyFiles {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("reading cache key file %s: %w", path, err)
+		}
+		fmt.Fprintf(hash, "%s\n", path)
+		_, err = io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	// Include the paths so changing what is cached starts a new cache
+	for _, path := range cache.Paths {
+		fmt.Fprintf(hash, "path:%s\n", path)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
+
+// restoreCache copies a saved cache for the current key back into place
+func restoreCache(cache CacheConfig, buildID string) {
+	key, err := cacheKey(cache)
+	if err != nil {
+		log.Printf("Build %s: cache disabled: %v", buildID, err)
+		return
+	}
+
+	keyDir := filepath.Join(cacheRoot, key)
+	if _, err := os.Stat(keyDir); err != nil {
+		log.Printf("Build %s: cache miss for key %s", buildID, key)
+		return
+	}
+
+	for i, path := range cache.Paths {
+		saved := filepath.Join(keyDir, strconv.Itoa(i))
+		if _, err := os.Stat(saved); err != nil {
+			continue
+		}
+		if err := copyDir(saved, path); err != nil {
+			log.Printf("Build %s: failed to restore cache for %s: %v", buildID, path, err)
+		}
+	}
+	log.Printf("Build %s: restored cache for key %s", buildID, key)
+}
+
+// saveCache stores the cached paths under the current key if not already saved
+func saveCache(cache CacheConfig, buildID string) {
+	key, err := cacheKey(cache)
+	if err != nil {
+		log.Printf("Build %s: cache not saved: %v", buildID, err)
+		return
+	}
+
+	keyDir := filepath.Join(cacheRoot, key)
+	if _, err := os.Stat(keyDir); err == nil {
+		return
+	}
+
+	// Save into a temporary directory and rename it, so a concurrent build
+	// never restores a half-written cache
+	if err := os.MkdirAll(cacheRoot, 0755); err != nil {
+		log.Printf("Build %s: cache not saved: %v", buildID, err)
+		return
+	}
+	tmpDir, err := os.MkdirTemp(cacheRoot, key+".tmp-")
+	if err != nil {
+		log.Printf("Build %s: cache not saved: %v", buildID, err)
+		return
+	}
+
+	for i, path := range cache.Paths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := copyDir(path, filepath.Join(tmpDir, strconv.Itoa(i))); err != nil {
+			log.Printf("Build %s: cache not saved: %v", buildID, err)
+			os.RemoveAll(tmpDir)
+			return
+		}
+	}
+
+	if err := os.Rename(tmpDir, keyDir); err != nil {
+		// Another build saved the same key first
+		os.RemoveAll(tmpDir)
+		return
+	}
+	log.Printf("Build %s: saved cache for key %s", buildID, key)
+}
+
+// copyDir recursively copies the directory tree at src into dst
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,121 @@
+package main
+
+/**
+Parallel steps:
+A step can list the steps it depends on in "needs". Once every step it needs
+has succeeded it may start, so steps that do not depend on each other run at
+the same time, up to max_parallel (default 4) at once:
+
+max_parallel: 4
+pipeline:
+  - name: "Lint"
+    cmd: ["go", "vet", "./..."]
+  - name: "Test"
+    cmd: ["go", "test", "./..."]
+  - name: "Build"
+    needs: ["Lint", "Test"]
+    cmd: ["go", "build", "./..."]
+
+Here Lint and Test run together and Build runs after both. In a pipeline
+where no step uses needs, every step needs the one before it, so existing
+pipelines keep running one step at a time in file order.
+
+When a step fails no further steps are started; those already running are
+allowed to finish and the build fails. Unknown or duplicate step names and
+dependency cycles are rejected when the config is loaded.
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultMaxParallel is how many steps may run at once without max_parallel
+const defaultMaxParallel = 4
+
+// stepDependencies returns, for each step, the indexes of the steps it needs
+func stepDependencies(steps []PipelineStep) ([][]int, error) {
+	deps := make([][]int, len(steps))
+
+	usesNeeds := false
+	for _, step := range steps {
+		if len(step.Needs) > 0 {
+			usesNeeds = true
+		}
+	}
+	if !usesNeeds {
+		for i := 1; i < len(steps); i++ {
+			deps[i] = []int{i - 1}
+		}
+		return deps, nil
+	}
+
+	index := make(map[string]int, len(steps))
+	for i, step := range steps {
+		if _, dup := index[step.Name]; dup {
+			return nil, fmt.Errorf("step name %q is used twice; names must be unique when needs is used", step.Name)
+		}
+		index[step.Name] = i
+	}
+	for i, step := range steps {
+		for _, name := range step.Needs {
+			j, ok := index[name]
+			if !ok {
+				return nil, fmt.Errorf("step %s needs unknown step %q", step.Name, name)
+			}
+			deps[i] = append(deps[i], j)
+		}
+	}
+
+	if cycle := findCycle(steps, deps); cycle != nil {
+		return nil, fmt.Errorf("dependency cycle between steps: %s", strings.Join(cycle, " -> "))
+	}
+	return deps, nil
+}
+
+// findCycle returns the names along a dependency cycle, or nil if there is none
+func findCycle(steps []PipelineStep, deps [][]int) []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(steps))
+	var path []int
+
+	var visit func(i int) []string
+	visit = func(i int) []string {
+		state[i] = visiting
+		path = append(path, i)
+		for _, j := range deps[i] {
+			switch state[j] {
+			case visiting:
+				// The cycle is the part of the path from j onwards, back to j
+				var names []string
+				for k := len(path) - 1; k >= 0; k-- {
+					names = append([]string{steps[path[k]].Name}, names...)
+					if path[k] == j {
+						break
+					}
+				}
+				return append(names, steps[j].Name)
+			case unvisited:
+				if cycle := visit(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		return nil
+	}
+
+	for i := range steps {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
@@ -49,19 +49,34 @@ YAML file.
 
 gopkg.in/yaml.v3: Used to parse the YAML configuration file.
 
-os/exec: Used to execute commands in the shell
-(like running build or test commands).
-
 time: Used for generating unique build IDs based on timestamps.
 
+os/signal, syscall, context: Used to catch SIGINT/SIGTERM and shut the
+server down gracefully, giving running builds time to finish.
+
+sync, sync/atomic: Used to wait for running builds and to track shutdown.
+
+errors: Used to recognise steps that ran out of time.
+
 */
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os/exec"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"io/ioutil"
 
@@ -72,78 +87,407 @@ import (
 
 // BuildStatus represents the status of a build
 type BuildStatus struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
-	Logs   string `json:"logs"`
+	ID        string    `json:"id"`
+	Pipeline  string    `json:"pipeline"`
+	Status    string    `json:"status"`
+	Logs      string    `json:"logs"`
+	StartedAt time.Time `json:"started_at"`
+
+	// Artifacts names the files downloadable from /artifacts/{id}/{name}
+	Artifacts []string `json:"artifacts,omitempty"`
 }
 
-// In-memory store for build statuses (for simplicity)
-var buildStatuses = make(map[string]BuildStatus)
+// defaultPipeline names builds triggered without ?pipeline=
+const defaultPipeline = "default"
+
+// updateBuild sets a build's status and logs, keeping its pipeline and start time
+func updateBuild(id, status, logs string) {
+	builds.Update(id, status, logs)
+}
+
+// builds holds the build statuses, persisted to statusFile (see store.go)
+var builds *buildStore
+
+// shutdownTimeout is how long running builds get to finish on shutdown
+// before they are marked as interrupted
+const shutdownTimeout = 30 * time.Second
+
+var (
+	// buildsWG lets shutdown wait for running builds to finish
+	buildsWG sync.WaitGroup
+
+	// shuttingDown is set once a termination signal is received
+	shuttingDown atomic.Bool
+
+	// buildCancels holds the cancel function of every running build, by ID
+	buildCancels   = make(map[string]context.CancelFunc)
+	buildCancelsMu sync.Mutex
+)
 
 // PipelineStep defines a step in the pipeline
 type PipelineStep struct {
 	Name string   `yaml:"name"`
 	Cmd  []string `yaml:"cmd"`
+
+	// Type selects the StepExecutor that runs the step (default "shell")
+	Type string `yaml:"type"`
+
+	// With holds the settings of non-shell step types, e.g. a docker tag
+	With map[string]string `yaml:"with"`
+
+	// Retries is how many extra attempts a step gets after it fails
+	Retries int `yaml:"retries"`
+
+	// RetryDelay is how long to wait before the first retry, e.g. "5s"
+	RetryDelay time.Duration `yaml:"retry_delay"`
+
+	// RetryBackoff multiplies the delay after every retry, e.g. 2 doubles
+	// it each time (default 1: the delay stays the same)
+	RetryBackoff float64 `yaml:"retry_backoff"`
+
+	// RetryOnTimeout also retries attempts that hit the step's timeout
+	RetryOnTimeout bool `yaml:"retry_on_timeout"`
+
+	// Timeout kills the step after this long, e.g. "10m" (0 = no limit)
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Env adds variables to the server's environment for this step's command
+	Env map[string]string `yaml:"env"`
+
+	// Dir is the working directory of the step's command (default: the server's)
+	Dir string `yaml:"dir"`
+
+	// Needs names the steps that must succeed before this one starts
+	Needs []string `yaml:"needs"`
 }
 
 // PipelineConfig defines the structure of the YAML file
 type PipelineConfig struct {
 	Pipeline []PipelineStep `yaml:"pipeline"`
+	Cache    CacheConfig    `yaml:"cache"`
+	Notify   NotifyConfig   `yaml:"notify"`
+	Webhook  WebhookConfig  `yaml:"webhook"`
+
+	// Timeout fails the whole build after this long, e.g. "1h" (0 = no limit)
+	Timeout time.Duration `yaml:"timeout"`
+
+	// MaxParallel limits how many steps run at once (default 4)
+	MaxParallel int `yaml:"max_parallel"`
+
+	// Artifacts lists glob patterns of files to keep after a successful
+	// build, for ArtifactRetention (default 7 days); see artifacts.go
+	Artifacts         []string      `yaml:"artifacts"`
+	ArtifactRetention time.Duration `yaml:"artifact_retention"`
 }
 
 func main() {
+	// Load the statuses of earlier builds so they survive a restart
+	store, err := loadBuildStore(statusFile)
+	if err != nil {
+		log.Fatalf("Failed to load build statuses from %s: %v", statusFile, err)
+	}
+	builds = store
+	buildSlots = make(chan struct{}, maxConcurrentBuilds())
+
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: newRouter(),
+	}
+
+	// Start the server
+	go func() {
+		log.Println("Starting CI/CD server on port 8080")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	// Wait for a termination signal
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+	shuttingDown.Store(true)
+	log.Println("Shutting down CI/CD server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting new requests
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
+	}
+
+	// Give in-progress builds until the deadline to finish
+	done := make(chan struct{})
+	go func() {
+		buildsWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("All builds finished")
+	case <-ctx.Done():
+		markInterrupted()
+	}
+}
+
+// newRouter registers the server's routes
+func newRouter() *mux.Router {
 	r := mux.NewRouter()
 
 	// Route to trigger builds
 	r.HandleFunc("/build", triggerBuild).Methods("POST")
 
+	// GitHub push webhook (see webhook.go)
+	r.HandleFunc("/webhook", githubWebhook).Methods("POST")
+
 	// Route to check build status
 	r.HandleFunc("/status/{id}", checkStatus).Methods("GET")
 
-	// Start the server
-	log.Println("Starting CI/CD server on port 8080")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	// Route to download a file saved by a build
+	r.HandleFunc("/artifacts/{id}/{name}", downloadArtifact).Methods("GET")
+
+	// Route to list builds, e.g. /builds?status=Failed&sort=newest
+	r.HandleFunc("/builds", listBuilds).Methods("GET")
+
+	// Route to stop a running build
+	r.HandleFunc("/cancel/{id}", cancelBuild).Methods("POST")
+
+	// SVG badge with the latest build status of a pipeline
+	r.HandleFunc("/badge/{pipeline}", buildBadge).Methods("GET")
+
+	// Liveness and readiness probes
+	r.HandleFunc("/health", healthCheck).Methods("GET")
+	r.HandleFunc("/ready", readyCheck).Methods("GET")
+	return r
+}
+
+// markInterrupted records every build that is still running or queued as
+// interrupted so a restart leaves a trace of what was cut short
+func markInterrupted() {
+	for _, build := range builds.All() {
+		if build.Status != "In Progress" && build.Status != "Queued" {
+			continue
+		}
+		log.Printf("Build %s interrupted by shutdown", build.ID)
+		updateBuild(build.ID, "Interrupted", build.Logs+"\nBuild interrupted by server shutdown")
+	}
+}
+
+// healthCheck reports that the process is alive
+func healthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// readyCheck reports whether the server can accept new builds: the pipeline
+// configuration must load and the build queue must not be saturated (see
+// queueSaturated in queue.go)
+func readyCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	reason := ""
+	if shuttingDown.Load() {
+		reason = "shutting down"
+	} else if _, err := LoadConfig("config.yaml"); err != nil {
+		reason = fmt.Sprintf("pipeline configuration not loadable: %v", err)
+	} else if queued, slots := queuedBuilds.Load(), cap(buildSlots); queueSaturated(queued, slots) {
+		reason = fmt.Sprintf("%d builds queued for %d build slots, all in use", queued, slots)
+	}
+
+	if reason != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "not ready", "reason": reason})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
 }
 
 // triggerBuild handles build requests
 func triggerBuild(w http.ResponseWriter, r *http.Request) {
+	if shuttingDown.Load() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
 	log.Println("Triggering build...")
 
 	// Load pipeline configuration
 	config, err := LoadConfig("config.yaml")
 	if err != nil {
-		http.Error(w, "Failed to load pipeline configuration", http.StatusInternalServerError)
+		configError(w, err)
 		return
 	}
 
+	// Builds are grouped by pipeline name for the status badge
+	pipeline := r.URL.Query().Get("pipeline")
+	if pipeline == "" {
+		pipeline = defaultPipeline
+	}
+
+	buildID := startBuild(config, pipeline)
+
+	// Return the build ID to the user
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":  "Build triggered",
+		"id":       buildID,
+		"pipeline": pipeline,
+	})
+}
+
+// startBuild records a new build of pipeline and runs it in the background
+// once a build slot is free (see queue.go), returning its ID
+func startBuild(config *PipelineConfig, pipeline string) string {
 	// Generate a unique ID for the build
 	buildID := generateUUID()
 
 	// Create a placeholder for build status
-	buildStatuses[buildID] = BuildStatus{
-		ID:     buildID,
-		Status: "In Progress",
-		Logs:   "",
-	}
+	builds.Set(BuildStatus{
+		ID:        buildID,
+		Pipeline:  pipeline,
+		Status:    "Queued",
+		Logs:      "",
+		StartedAt: time.Now(),
+	})
+
+	// Register the build's cancel function for POST /cancel/{id}
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	buildCancelsMu.Lock()
+	buildCancels[buildID] = cancel
+	buildCancelsMu.Unlock()
 
 	// Execute the pipeline in a separate goroutine
+	buildsWG.Add(1)
+	queuedBuilds.Add(1)
 	go func(id string) {
-		err := ExecutePipeline(config.Pipeline, id)
+		defer buildsWG.Done()
+		defer func() {
+			buildCancelsMu.Lock()
+			delete(buildCancels, id)
+			buildCancelsMu.Unlock()
+			cancel()
+		}()
+
+		// Wait for a free slot; a queued build can still be cancelled
+		select {
+		case buildSlots <- struct{}{}:
+			queuedBuilds.Add(-1)
+		case <-cancelCtx.Done():
+			queuedBuilds.Add(-1)
+			updateBuild(id, "Cancelled", "Build cancelled while queued")
+			notifyBuild(config.Notify, id)
+			return
+		}
+		defer func() { <-buildSlots }()
+
+		if shuttingDown.Load() {
+			updateBuild(id, "Interrupted", "Build not started: server shutting down")
+			return
+		}
+		updateBuild(id, "In Progress", "")
+
+		if config.Cache.enabled() {
+			restoreCache(config.Cache, id)
+		}
+
+		ctx := cancelCtx
+		if config.Timeout > 0 {
+			var cancelTimeout context.CancelFunc
+			ctx, cancelTimeout = context.WithTimeout(ctx, config.Timeout)
+			defer cancelTimeout()
+		}
+
+		err := ExecutePipeline(ctx, config.Pipeline, config.MaxParallel, id)
 		status := "Success"
-		if err != nil {
+		if err != nil && cancelCtx.Err() != nil {
+			status = "Cancelled"
+		} else if err != nil {
 			status = "Failed"
+		} else {
+			if config.Cache.enabled() {
+				saveCache(config.Cache, id)
+			}
+			if len(config.Artifacts) > 0 {
+				builds.SetArtifacts(id, saveArtifacts(config.Artifacts, id))
+			}
 		}
-		buildStatuses[id] = BuildStatus{
-			ID:     id,
-			Status: status,
-			Logs:   fmt.Sprintf("Pipeline completed with status: %s", status),
+		pruneArtifacts(config.ArtifactRetention)
+		logs := fmt.Sprintf("Pipeline completed with status: %s", status)
+		if build, ok := builds.Get(id); ok && build.Logs != "" {
+			// Keep the step results, including a failing step's output,
+			// for /status and the notification
+			logs = build.Logs + "\n" + logs
 		}
+		updateBuild(id, status, logs)
+		notifyBuild(config.Notify, id)
 	}(buildID)
+	return buildID
+}
+
+// listBuilds returns every build as a JSON array. ?status= keeps only builds
+// with that status (any letter case) and ?pipeline= only those of one
+// pipeline; ?sort=newest (the default) or ?sort=oldest orders them by start time.
+// The X-Queue-Depth header tells how many builds are waiting to start.
+func listBuilds(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	pipeline := query.Get("pipeline")
+	order := query.Get("sort")
+	if order != "" && order != "newest" && order != "oldest" {
+		http.Error(w, "sort must be newest or oldest", http.StatusBadRequest)
+		return
+	}
+
+	list := []BuildStatus{}
+	for _, build := range builds.All() {
+		if status != "" && !strings.EqualFold(build.Status, status) {
+			continue
+		}
+		if pipeline != "" && build.Pipeline != pipeline {
+			continue
+		}
+		list = append(list, build)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if order == "oldest" {
+			return list[i].StartedAt.Before(list[j].StartedAt)
+		}
+		return list[i].StartedAt.After(list[j].StartedAt)
+	})
+
+	// The number of builds waiting for a slot, whatever the filters
+	w.Header().Set("X-Queue-Depth", strconv.FormatInt(queuedBuilds.Load(), 10))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// cancelBuild stops a running or queued build: its context is canceled,
+// which kills the running steps' processes or takes it out of the queue,
+// and it ends with the status Cancelled
+func cancelBuild(w http.ResponseWriter, r *http.Request) {
+	buildID := mux.Vars(r)["id"]
+
+	build, exists := builds.Get(buildID)
+	if !exists {
+		http.Error(w, "Build ID not found", http.StatusNotFound)
+		return
+	}
+
+	buildCancelsMu.Lock()
+	cancel, running := buildCancels[buildID]
+	buildCancelsMu.Unlock()
+	if !running || (build.Status != "In Progress" && build.Status != "Queued") {
+		http.Error(w, fmt.Sprintf("Build already finished with status %s", build.Status), http.StatusConflict)
+		return
+	}
+
+	log.Printf("Cancelling build %s", buildID)
+	cancel()
 
-	// Return the build ID to the user
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Build triggered",
+		"message": "Build cancelled",
 		"id":      buildID,
 	})
 }
@@ -153,7 +497,7 @@ func checkStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	buildID := vars["id"]
 
-	status, exists := buildStatuses[buildID]
+	status, exists := builds.Get(buildID)
 	if !exists {
 		http.Error(w, "Build ID not found", http.StatusNotFound)
 		return
@@ -179,42 +523,238 @@ func LoadConfig(filepath string) (*PipelineConfig, error) {
 	var config PipelineConfig
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", errInvalidConfig, err)
+	}
+
+	// Reject malformed steps before any build starts
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidConfig, err)
 	}
 
 	return &config, nil
 }
 
-// ExecutePipeline runs the steps in the pipeline and logs their output
-func ExecutePipeline(steps []PipelineStep, buildID string) error {
-	// Iterate through each step in the pipeline
-	for _, step := range steps {
-		log.Printf("Executing step: %s", step.Name)
-		cmd := exec.Command(step.Cmd[0], step.Cmd[1:]...)
-		output, err := cmd.CombinedOutput()
+// errInvalidConfig wraps every error caused by the content of the config
+// file, so handlers can answer 400 rather than 500 for them
+var errInvalidConfig = errors.New("invalid pipeline configuration")
+
+// Validate checks the pipeline for mistakes that would otherwise only show
+// up, or panic, once a build runs: an empty pipeline, steps without a name
+// or without a cmd, negative retries or timeouts, unknown step types,
+// broken dependencies and incomplete notification settings
+func (c *PipelineConfig) Validate() error {
+	if len(c.Pipeline) == 0 {
+		return errors.New("pipeline has no steps")
+	}
+	for i, step := range c.Pipeline {
+		if strings.TrimSpace(step.Name) == "" {
+			return fmt.Errorf("step %d: name is required", i+1)
+		}
+		if _, err := executorFor(step); err != nil {
+			return err
+		}
+		if (step.Type == "" || step.Type == defaultStepType) && len(step.Cmd) == 0 {
+			return fmt.Errorf("step %s: cmd is required", step.Name)
+		}
+		if step.Retries < 0 || step.RetryDelay < 0 || step.RetryBackoff < 0 {
+			return fmt.Errorf("step %s: retries, retry_delay and retry_backoff must not be negative", step.Name)
+		}
+		if step.Timeout < 0 {
+			return fmt.Errorf("step %s: timeout must not be negative", step.Name)
+		}
+	}
+	for _, pattern := range c.Artifacts {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("artifact pattern %q: %v", pattern, err)
+		}
+	}
+	if c.Timeout < 0 || c.MaxParallel < 0 {
+		return errors.New("timeout and max_parallel must not be negative")
+	}
+	if _, err := stepDependencies(c.Pipeline); err != nil {
+		return err
+	}
+	return c.Notify.validate()
+}
+
+// configError answers a failed LoadConfig: 400 with the reason for a
+// malformed config, 500 when the file could not be read
+func configError(w http.ResponseWriter, err error) {
+	log.Printf("Failed to load pipeline configuration: %v", err)
+	if errors.Is(err, errInvalidConfig) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Failed to load pipeline configuration", http.StatusInternalServerError)
+}
+
+// stepResult is what a step reports back to ExecutePipeline: either that it
+// finished, or (retrying) that an attempt failed and it runs again in retryIn
+type stepResult struct {
+	index    int
+	attempt  int
+	output   []byte
+	err      error
+	retrying bool
+	retryIn  time.Duration
+}
+
+// ExecutePipeline runs the steps in the pipeline and logs their output.
+// ctx carries the build timeout; each step may add its own. Steps start as
+// soon as the steps they need have succeeded, with at most maxParallel
+// running at once (see dag.go). A failing step is run again up to its
+// retries, waiting retry_delay (growing by retry_backoff) in between. The
+// build's logs collect one line per failed attempt and finished step, in the
+// order they happened.
+func ExecutePipeline(ctx context.Context, steps []PipelineStep, maxParallel int, buildID string) error {
+	deps, err := stepDependencies(steps)
+	if err != nil {
+		updateBuild(buildID, "Failed", err.Error())
+		return err
+	}
+	if maxParallel <= 0 {
+		maxParallel = defaultMaxParallel
+	}
+
+	// waiting counts the unfinished dependencies of each step, and
+	// dependents lists the steps to check when a step succeeds
+	waiting := make([]int, len(steps))
+	dependents := make([][]int, len(steps))
+	var ready []int
+	for i := range steps {
+		waiting[i] = len(deps[i])
+		for _, j := range deps[i] {
+			dependents[j] = append(dependents[j], i)
+		}
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	results := make(chan stepResult)
+	running := 0
+	var firstErr error
+	var stepLogs []string
+	for {
+		// Start every ready step the pool has room for, unless a step failed
+		for firstErr == nil && len(ready) > 0 && running < maxParallel {
+			i := ready[0]
+			ready = ready[1:]
+			running++
+			go runStepAttempts(ctx, steps[i], i, results)
+		}
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		step := steps[result.index]
+		attempts := step.Retries + 1
+
+		// Record a failed attempt; the step is still running
+		if result.retrying {
+			log.Printf("Step %s attempt %d/%d failed: %s\nOutput: %s", step.Name, result.attempt, attempts, result.err, string(result.output))
+			message := fmt.Sprintf("Step %s attempt %d/%d failed (%v), retrying in %s",
+				step.Name, result.attempt, attempts, result.err, result.retryIn)
+			if output := strings.TrimSpace(string(result.output)); output != "" {
+				message += ": " + output
+			}
+			stepLogs = append(stepLogs, message)
+			updateBuild(buildID, "In Progress", strings.Join(stepLogs, "\n"))
+			continue
+		}
+		running--
 
 		// If there's an error, log the error and update build status with failure
-		if err != nil {
-			log.Printf("Error in step %s: %s\nOutput: %s", step.Name, err, string(output))
-			buildStatuses[buildID] = BuildStatus{
-				ID:     buildID,
-				Status: "Failed",
-				Logs:   fmt.Sprintf("Step %s failed: %s", step.Name, string(output)),
+		if result.err != nil {
+			log.Printf("Error in step %s: %s\nOutput: %s", step.Name, result.err, string(result.output))
+			message := fmt.Sprintf("Step %s failed: %s", step.Name, string(result.output))
+			if errors.Is(result.err, context.DeadlineExceeded) {
+				message = result.err.Error() + "\n" + string(result.output)
+			} else if errors.Is(result.err, context.Canceled) {
+				message = fmt.Sprintf("Step %s cancelled\n%s", step.Name, string(result.output))
 			}
-			return err
+			stepLogs = append(stepLogs, message)
+			updateBuild(buildID, "In Progress", strings.Join(stepLogs, "\n"))
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
 		}
 
 		// Log the successful output of the step
-		log.Printf("Output of step %s: %s", step.Name, string(output))
+		log.Printf("Output of step %s: %s", step.Name, string(result.output))
 
 		// Update logs in the build status for this step
-		buildStatuses[buildID] = BuildStatus{
-			ID:     buildID,
-			Status: "In Progress",
-			Logs:   fmt.Sprintf("Step %s completed successfully", step.Name),
+		message := fmt.Sprintf("Step %s completed successfully", step.Name)
+		if result.attempt > 1 {
+			message += fmt.Sprintf(" (attempt %d/%d)", result.attempt, attempts)
+		}
+		stepLogs = append(stepLogs, message)
+		updateBuild(buildID, "In Progress", strings.Join(stepLogs, "\n"))
+
+		for _, next := range dependents[result.index] {
+			waiting[next]--
+			if waiting[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	return firstErr
+}
+
+// runStepAttempts runs a step until it succeeds or is out of retries,
+// reporting every failed attempt that will be retried and the final result
+func runStepAttempts(ctx context.Context, step PipelineStep, index int, results chan<- stepResult) {
+	executor, err := executorFor(step)
+	if err != nil {
+		results <- stepResult{index: index, attempt: 1, err: err}
+		return
+	}
+
+	attempts := step.Retries + 1
+	delay := step.RetryDelay
+	for attempt := 1; ; attempt++ {
+		log.Printf("Executing step: %s", step.Name)
+		output, err := executeStep(ctx, executor, step)
+		// Nothing is retried once the build itself was cancelled or timed out
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !retryable(step, err) {
+			results <- stepResult{index: index, attempt: attempt, output: output, err: err}
+			return
+		}
+
+		results <- stepResult{index: index, attempt: attempt, output: output, err: err, retrying: true, retryIn: delay}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			results <- stepResult{index: index, attempt: attempt, output: output, err: ctx.Err()}
+			return
+		}
+		if step.RetryBackoff > 0 {
+			delay = time.Duration(float64(delay) * step.RetryBackoff)
+		}
+	}
+}
+
+// executeStep runs one step under its timeout. A timeout is reported as
+// "step X timed out after N" (or "build timed out" when the build's own
+// deadline was hit first), wrapping context.DeadlineExceeded.
+func executeStep(ctx context.Context, executor StepExecutor, step PipelineStep) ([]byte, error) {
+	stepCtx := ctx
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithTimeout(ctx, step.Timeout)
+		defer cancel()
+	}
+
+	output, err := executor.Execute(stepCtx, step)
+	if err != nil && stepCtx.Err() == context.DeadlineExceeded {
+		if ctx.Err() != nil {
+			return output, fmt.Errorf("step %s stopped: build timed out: %w", step.Name, ctx.Err())
 		}
+		return output, fmt.Errorf("step %s timed out after %s: %w", step.Name, step.Timeout, stepCtx.Err())
 	}
-	return nil
+	return output, err
 }
 
 /**
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Cancelling a running build kills its step and ends it Cancelled; unknown
+// builds get 404 and finished ones 409
+func TestCancelBuild(t *testing.T) {
+	router := setupServer(t, `
+pipeline:
+  - name: "Sleep"
+    cmd: ["sleep", "30"]
+`)
+	id := triggerTestBuild(t, router)
+	waitForStatus(t, id, "In Progress")
+
+	start := time.Now()
+	if rec := serve(t, router, http.MethodPost, "/cancel/"+id); rec.Code != http.StatusOK {
+		t.Fatalf("POST /cancel/%s: got %d %s", id, rec.Code, rec.Body)
+	}
+	build := waitForStatus(t, id, "Cancelled", "Failed", "Success")
+	if build.Status != "Cancelled" {
+		t.Errorf("cancelled build ended %q, logs %q", build.Status, build.Logs)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("cancel took %s, the sleep step was not killed", elapsed)
+	}
+	buildsWG.Wait()
+
+	if rec := serve(t, router, http.MethodPost, "/cancel/no-such-build"); rec.Code != http.StatusNotFound {
+		t.Errorf("cancel unknown build: got %d, want 404", rec.Code)
+	}
+	rec := serve(t, router, http.MethodPost, "/cancel/"+id)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("cancel finished build: got %d, want 409", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "Cancelled") {
+		t.Errorf("cancel finished build: body %q does not name its status", rec.Body)
+	}
+}
+
+// A build that finished on its own cannot be cancelled either
+func TestCancelSucceededBuild(t *testing.T) {
+	router := setupServer(t, quickPipeline)
+	id := triggerTestBuild(t, router)
+	waitForStatus(t, id, "Success")
+	buildsWG.Wait()
+
+	if rec := serve(t, router, http.MethodPost, "/cancel/"+id); rec.Code != http.StatusConflict {
+		t.Errorf("cancel succeeded build: got %d, want 409", rec.Code)
+	}
+}
+
+func TestPipelineConfigValidate(t *testing.T) {
+	build := PipelineStep{Name: "Build", Cmd: []string{"go", "build", "./..."}}
+	tests := []struct {
+		name    string
+		config  PipelineConfig
+		wantErr string // empty for a valid config
+	}{
+		{
+			name:    "empty pipeline",
+			config:  PipelineConfig{},
+			wantErr: "pipeline has no steps",
+		},
+		{
+			name:    "empty step name",
+			config:  PipelineConfig{Pipeline: []PipelineStep{build, {Name: "  ", Cmd: []string{"true"}}}},
+			wantErr: "step 2: name is required",
+		},
+		{
+			name:    "empty cmd",
+			config:  PipelineConfig{Pipeline: []PipelineStep{{Name: "Test"}}},
+			wantErr: "step Test: cmd is required",
+		},
+		{
+			name:    "unknown step type",
+			config:  PipelineConfig{Pipeline: []PipelineStep{{Name: "Deploy", Type: "ftp"}}},
+			wantErr: `unknown type "ftp"`,
+		},
+		{
+			name:    "negative retries",
+			config:  PipelineConfig{Pipeline: []PipelineStep{{Name: "Flaky", Cmd: []string{"true"}, Retries: -1}}},
+			wantErr: "must not be negative",
+		},
+		{
+			name: "unknown need",
+			config: PipelineConfig{Pipeline: []PipelineStep{
+				build,
+				{Name: "Test", Cmd: []string{"go", "test"}, Needs: []string{"Lint"}},
+			}},
+			wantErr: `needs unknown step "Lint"`,
+		},
+		{
+			name:    "bad artifact pattern",
+			config:  PipelineConfig{Pipeline: []PipelineStep{build}, Artifacts: []string{"bin/["}},
+			wantErr: "artifact pattern",
+		},
+		{
+			name:   "valid config",
+			config: PipelineConfig{Pipeline: []PipelineStep{build, {Name: "Test", Cmd: []string{"go", "test", "./..."}}}},
+		},
+		{
+			name: "valid non-shell step without cmd",
+			config: PipelineConfig{Pipeline: []PipelineStep{
+				build,
+				{Name: "Notify", Type: "http_notify", With: map[string]string{"url": "http://localhost/hook"}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("got error %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// A malformed config.yaml is refused with 400 and starts no build
+func TestTriggerBuildInvalidConfig(t *testing.T) {
+	router := setupServer(t, `
+pipeline:
+  - name: "Build"
+`)
+	rec := serve(t, router, http.MethodPost, "/build")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /build: got %d, want 400", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "cmd is required") {
+		t.Errorf("POST /build: body %q does not give the reason", rec.Body)
+	}
+	if n := len(builds.All()); n != 0 {
+		t.Errorf("%d builds started, want none", n)
+	}
+}
+
+// /ready fails once as many builds are queued as there are slots, and
+// recovers when the queue drains
+func TestReadyReportsSaturatedQueue(t *testing.T) {
+	router := setupServer(t, `
+pipeline:
+  - name: "Sleep"
+    cmd: ["sleep", "30"]
+`)
+	if rec := serve(t, router, http.MethodGet, "/ready"); rec.Code != http.StatusOK {
+		t.Fatalf("idle server: got %d %s", rec.Code, rec.Body)
+	}
+
+	// Fill every slot, then queue as many builds again
+	var ids []string
+	for i := 0; i < 2*defaultConcurrentBuilds; i++ {
+		ids = append(ids, triggerTestBuild(t, router))
+	}
+	for _, id := range ids {
+		waitForStatus(t, id, "In Progress", "Queued")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for queuedBuilds.Load() < defaultConcurrentBuilds && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec := serve(t, router, http.MethodGet, "/ready")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "queued") {
+		t.Errorf("saturated queue: got %d %s, want 503 naming the queue", rec.Code, rec.Body)
+	}
+
+	for _, id := range ids {
+		serve(t, router, http.MethodPost, "/cancel/"+id)
+	}
+	buildsWG.Wait()
+	if rec := serve(t, router, http.MethodGet, "/ready"); rec.Code != http.StatusOK {
+		t.Errorf("drained queue: got %d %s", rec.Code, rec.Body)
+	}
+}
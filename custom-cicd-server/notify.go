@@ -0,0 +1,158 @@
+package main
+
+/**
+Build notifications:
+The pipeline config can ask for a message when a build finishes:
+
+notify:
+  on: failure          # success, failure or always (the default)
+  slack:
+    webhook_url: "https://hooks.slack.com/services/..."   # or SLACK_WEBHOOK_URL
+  email:
+    smtp_addr: "smtp.example.com:587"
+    username: "ci@example.com"        # password from SMTP_PASSWORD
+    from: "ci@example.com"
+    to: ["team@example.com"]
+
+The message holds the build ID, pipeline, status, duration and the last
+lines of the build logs. Delivery is best-effort: a failed notification is
+logged and never changes the build's status.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// notifyLogLines is how many lines of the build logs a notification includes
+const notifyLogLines = 20
+
+// NotifyConfig selects when and where build notifications are sent
+type NotifyConfig struct {
+	On    string       `yaml:"on"`
+	Slack *SlackNotify `yaml:"slack"`
+	Email *EmailNotify `yaml:"email"`
+}
+
+// SlackNotify posts notifications to a Slack incoming webhook
+type SlackNotify struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+// EmailNotify sends notifications over SMTP
+type EmailNotify struct {
+	SMTPAddr string   `yaml:"smtp_addr"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// validate rejects notification settings that could never be delivered
+func (n NotifyConfig) validate() error {
+	switch n.On {
+	case "", "always", "success", "failure":
+	default:
+		return fmt.Errorf("notify: unknown on %q (use success, failure or always)", n.On)
+	}
+	if n.Email != nil {
+		if n.Email.SMTPAddr == "" || n.Email.From == "" || len(n.Email.To) == 0 {
+			return fmt.Errorf("notify: email needs smtp_addr, from and to")
+		}
+	}
+	return nil
+}
+
+// wants reports whether a build that ended with status should be notified
+func (n NotifyConfig) wants(status string) bool {
+	switch n.On {
+	case "success":
+		return status == "Success"
+	case "failure":
+		return status == "Failed"
+	}
+	return true
+}
+
+// notifyBuild sends the configured notifications for a finished build
+func notifyBuild(config NotifyConfig, id string) {
+	if config.Slack == nil && config.Email == nil {
+		return
+	}
+	build, ok := builds.Get(id)
+	if !ok || !config.wants(build.Status) {
+		return
+	}
+
+	subject := fmt.Sprintf("Build %s of %s: %s", build.ID, build.Pipeline, build.Status)
+	body := fmt.Sprintf("Build:    %s\nPipeline: %s\nStatus:   %s\nDuration: %s\n\n%s\n",
+		build.ID, build.Pipeline, build.Status, time.Since(build.StartedAt).Round(time.Second), logTail(build.Logs))
+
+	if config.Slack != nil {
+		if err := notifySlack(*config.Slack, subject+"\n```"+body+"```"); err != nil {
+			log.Printf("Build %s: Slack notification failed: %v", id, err)
+		}
+	}
+	if config.Email != nil {
+		if err := notifyEmail(*config.Email, subject, body); err != nil {
+			log.Printf("Build %s: email notification failed: %v", id, err)
+		}
+	}
+}
+
+// logTail returns the last notifyLogLines lines of logs
+func logTail(logs string) string {
+	lines := strings.Split(strings.TrimRight(logs, "\n"), "\n")
+	if len(lines) > notifyLogLines {
+		lines = lines[len(lines)-notifyLogLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func notifySlack(slack SlackNotify, text string) error {
+	webhook := slack.WebhookURL
+	if webhook == "" {
+		webhook = os.Getenv("SLACK_WEBHOOK_URL")
+	}
+	if webhook == "" {
+		return fmt.Errorf("no webhook_url or SLACK_WEBHOOK_URL")
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	_, err = sendRequest(context.Background(), http.MethodPost, webhook, "application/json", body)
+	return err
+}
+
+// notifyEmail sends a plain-text mail; smtp.SendMail upgrades to TLS when
+// the server offers STARTTLS
+func notifyEmail(email EmailNotify, subject, body string) error {
+	password := email.Password
+	if password == "" {
+		password = os.Getenv("SMTP_PASSWORD")
+	}
+	var auth smtp.Auth
+	if email.Username != "" {
+		host, _, err := net.SplitHostPort(email.SMTPAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", email.Username, password, host)
+	}
+
+	msg := "From: " + email.From + "\r\n" +
+		"To: " + strings.Join(email.To, ", ") + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+	return smtp.SendMail(email.SMTPAddr, auth, email.From, email.To, []byte(msg))
+}
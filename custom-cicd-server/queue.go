@@ -0,0 +1,57 @@
+package main
+
+/**
+Build queue:
+Every triggered build gets its own goroutine, but only a limited number of
+them run their pipeline at the same time; the rest wait with the status
+"Queued" and start, oldest first as far as the Go scheduler allows, when a
+running build finishes. This keeps a burst of pushes from starting dozens
+of compilers at once.
+
+The limit is set with the MAX_CONCURRENT_BUILDS environment variable
+(default 2) when the server starts. It is a server setting rather than part
+of config.yaml because config.yaml is re-read for every build.
+
+A queued build can be cancelled with POST /cancel/{id} before it starts.
+GET /builds reports how many builds are waiting in the X-Queue-Depth header.
+/ready reports the server as not ready once as many builds are waiting as
+there are slots, i.e. a new build would wait for a whole round of builds,
+so a load balancer can send new work to another server.
+*/
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// defaultConcurrentBuilds is how many builds run at once without MAX_CONCURRENT_BUILDS
+const defaultConcurrentBuilds = 2
+
+var (
+	// buildSlots is the semaphore limiting running builds: a build sends to
+	// it before running its pipeline and receives from it when done
+	buildSlots chan struct{}
+
+	// queuedBuilds counts builds waiting for a slot
+	queuedBuilds atomic.Int64
+)
+
+// queueSaturated reports whether queued builds have reached the slot count
+func queueSaturated(queued int64, slots int) bool {
+	return queued >= int64(slots)
+}
+
+// maxConcurrentBuilds reads the build limit from MAX_CONCURRENT_BUILDS
+func maxConcurrentBuilds() int {
+	value := os.Getenv("MAX_CONCURRENT_BUILDS")
+	if value == "" {
+		return defaultConcurrentBuilds
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Fatalf("MAX_CONCURRENT_BUILDS must be a positive number, got %q", value)
+	}
+	return n
+}
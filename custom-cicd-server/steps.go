@@ -0,0 +1,223 @@
+package main
+
+/**
+Step types:
+Every step has a type that selects the StepExecutor running it. Steps without
+a type run their cmd as before. Other types take their settings from "with":
+
+pipeline:
+  - name: "Image"
+    type: docker_build
+    with: {tag: "myapp:latest", context: ".", dockerfile: "Dockerfile"}
+  - name: "Notify"
+    type: slack
+    with: {text: "myapp image built"}   # webhook_url or SLACK_WEBHOOK_URL
+
+Built-in types:
+
+shell        runs cmd (the default)
+docker_build runs docker build with tag, context and dockerfile
+http_notify  sends body to url with method (POST by default)
+slack        posts text to a Slack incoming webhook
+
+A new step type is added by implementing StepExecutor and registering it in
+stepExecutors. Failed steps of every type are retried when the step sets
+retries (see ExecutePipeline); cancellation and commands that do not exist
+are not retried since another attempt would fail the same way. Timeouts are
+not retried either, unless the step sets retry_on_timeout, e.g. for a
+download that sometimes hangs:
+
+  - name: "Fetch"
+    cmd: ["curl", "-fsSO", "https://example.com/tool.tar.gz"]
+    timeout: 1m
+    retries: 2
+    retry_on_timeout: true
+
+A build that was cancelled or hit its own timeout retries nothing.
+
+Command-based steps run in dir (relative to the server's working directory)
+with env added to the server's environment:
+
+  - name: "Test"
+    dir: "checkout/myapp"
+    env: {GOFLAGS: "-mod=vendor", CGO_ENABLED: "0"}
+    cmd: ["go", "test", "./..."]
+
+Executors receive a context that is canceled when the step or build timeout
+expires; commands are killed and requests aborted when that happens.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// StepExecutor runs one type of pipeline step and returns its output
+type StepExecutor interface {
+	Execute(ctx context.Context, step PipelineStep) ([]byte, error)
+}
+
+// defaultStepType is used for steps that do not set a type
+const defaultStepType = "shell"
+
+// stepExecutors maps a step's type to the executor that runs it
+var stepExecutors = map[string]StepExecutor{
+	"shell":        shellExecutor{},
+	"docker_build": dockerBuildExecutor{},
+	"http_notify":  httpNotifyExecutor{},
+	"slack":        slackExecutor{},
+}
+
+// executorFor returns the executor for a step's type
+func executorFor(step PipelineStep) (StepExecutor, error) {
+	stepType := step.Type
+	if stepType == "" {
+		stepType = defaultStepType
+	}
+	executor, ok := stepExecutors[stepType]
+	if !ok {
+		return nil, fmt.Errorf("step %s: unknown type %q", step.Name, stepType)
+	}
+	return executor, nil
+}
+
+// shellExecutor runs the step's cmd
+type shellExecutor struct{}
+
+func (shellExecutor) Execute(ctx context.Context, step PipelineStep) ([]byte, error) {
+	if len(step.Cmd) == 0 {
+		return nil, fmt.Errorf("step %s: no cmd given", step.Name)
+	}
+	return runCommand(ctx, step, step.Cmd)
+}
+
+// dockerBuildExecutor builds an image with the docker CLI
+type dockerBuildExecutor struct{}
+
+func (dockerBuildExecutor) Execute(ctx context.Context, step PipelineStep) ([]byte, error) {
+	args := []string{"docker", "build"}
+	if tag := step.With["tag"]; tag != "" {
+		args = append(args, "-t", tag)
+	}
+	if dockerfile := step.With["dockerfile"]; dockerfile != "" {
+		args = append(args, "-f", dockerfile)
+	}
+	buildContext := step.With["context"]
+	if buildContext == "" {
+		buildContext = "."
+	}
+	return runCommand(ctx, step, append(args, buildContext))
+}
+
+// httpNotifyExecutor sends a request to a URL, e.g. to trigger a deployment
+type httpNotifyExecutor struct{}
+
+func (httpNotifyExecutor) Execute(ctx context.Context, step PipelineStep) ([]byte, error) {
+	url := step.With["url"]
+	if url == "" {
+		return nil, fmt.Errorf("step %s: http_notify needs a url", step.Name)
+	}
+	method := strings.ToUpper(step.With["method"])
+	if method == "" {
+		method = http.MethodPost
+	}
+	contentType := step.With["content_type"]
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	return sendRequest(ctx, method, url, contentType, []byte(step.With["body"]))
+}
+
+// slackExecutor posts a message to a Slack incoming webhook
+type slackExecutor struct{}
+
+func (slackExecutor) Execute(ctx context.Context, step PipelineStep) ([]byte, error) {
+	webhook := step.With["webhook_url"]
+	if webhook == "" {
+		webhook = os.Getenv("SLACK_WEBHOOK_URL")
+	}
+	if webhook == "" {
+		return nil, fmt.Errorf("step %s: slack needs webhook_url or SLACK_WEBHOOK_URL", step.Name)
+	}
+	body, err := json.Marshal(map[string]string{"text": step.With["text"]})
+	if err != nil {
+		return nil, err
+	}
+	return sendRequest(ctx, http.MethodPost, webhook, "application/json", body)
+}
+
+// notifyClient is used by the HTTP-based step types
+var notifyClient = &http.Client{Timeout: 30 * time.Second}
+
+// sendRequest sends body to url and fails on a non-2xx response
+func sendRequest(ctx context.Context, method, url, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	output, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return output, fmt.Errorf("%s %s returned %s", method, url, resp.Status)
+	}
+	return output, nil
+}
+
+// stepEnv returns the server's environment with the step's variables added,
+// or nil (inherit the environment unchanged) when the step sets none
+func stepEnv(step PipelineStep) []string {
+	if len(step.Env) == 0 {
+		return nil
+	}
+	env := os.Environ()
+	for name, value := range step.Env {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+// killWaitDelay is how long a killed command's children may keep its output
+// open before the step gives up waiting for them
+const killWaitDelay = 5 * time.Second
+
+// runCommand runs a command in the step's directory and environment. When
+// the context ends the command is killed and the context's error returned.
+func runCommand(ctx context.Context, step PipelineStep, command []string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.WaitDelay = killWaitDelay
+	cmd.Dir = step.Dir
+	cmd.Env = stepEnv(step)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return output, ctx.Err()
+	}
+	return output, err
+}
+
+// retryable reports whether a failed step is worth another attempt. A step
+// that timed out is only retried when it sets retry_on_timeout.
+func retryable(step PipelineStep, err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return step.RetryOnTimeout
+	}
+	return !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, exec.ErrNotFound) &&
+		!errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	timeout := fmt.Errorf("step Slow timed out after 1s: %w", context.DeadlineExceeded)
+	tests := []struct {
+		name string
+		step PipelineStep
+		err  error
+		want bool
+	}{
+		{"failed command", PipelineStep{}, errors.New("exit status 1"), true},
+		{"timeout", PipelineStep{}, timeout, false},
+		{"timeout with retry_on_timeout", PipelineStep{RetryOnTimeout: true}, timeout, true},
+		{"cancelled", PipelineStep{RetryOnTimeout: true}, context.Canceled, false},
+		{"command not found", PipelineStep{}, &exec.Error{Name: "nope", Err: exec.ErrNotFound}, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.step, tt.err); got != tt.want {
+			t.Errorf("%s: retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// A step that times out runs again only with retry_on_timeout
+func TestStepTimeoutRetries(t *testing.T) {
+	for _, retryOnTimeout := range []bool{false, true} {
+		t.Run(fmt.Sprintf("retry_on_timeout=%v", retryOnTimeout), func(t *testing.T) {
+			router := setupServer(t, fmt.Sprintf(`
+pipeline:
+  - name: "Slow"
+    cmd: ["sleep", "5"]
+    timeout: 100ms
+    retries: 1
+    retry_on_timeout: %v
+`, retryOnTimeout))
+			id := triggerTestBuild(t, router)
+			build := waitForStatus(t, id, "Failed", "Success")
+			if build.Status != "Failed" {
+				t.Fatalf("build ended %q, want Failed", build.Status)
+			}
+
+			retried := strings.Contains(build.Logs, "attempt 1/2 failed")
+			if retried != retryOnTimeout {
+				t.Errorf("retried: %v, want %v; logs:\n%s", retried, retryOnTimeout, build.Logs)
+			}
+			if !strings.Contains(build.Logs, "timed out after 100ms") {
+				t.Errorf("logs do not report the timeout:\n%s", build.Logs)
+			}
+		})
+	}
+}
+
+// When the build itself times out, retry_on_timeout does not start another attempt
+func TestBuildTimeoutIsNotRetried(t *testing.T) {
+	router := setupServer(t, `
+timeout: 100ms
+pipeline:
+  - name: "Slow"
+    cmd: ["sleep", "5"]
+    retries: 3
+    retry_on_timeout: true
+`)
+	start := time.Now()
+	id := triggerTestBuild(t, router)
+	build := waitForStatus(t, id, "Failed", "Success")
+	if build.Status != "Failed" || strings.Contains(build.Logs, "retrying") {
+		t.Errorf("build ended %q with logs:\n%s", build.Status, build.Logs)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("build took %s after its 100ms timeout", elapsed)
+	}
+}
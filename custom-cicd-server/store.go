@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/**
+Build store:
+Build statuses are kept in memory and written to statusFile (builds.json)
+after every change, so /status/{id} and the badges still know about older
+builds after the server restarts. The file is a JSON object keyed by build
+ID; it is written to a temporary file first and then renamed over the old
+one, so a crash mid-write never leaves a truncated file behind.
+
+Builds found "In Progress" or "Queued" at startup were cut short by a crash
+or kill without a clean shutdown, and are marked "Interrupted".
+
+Builds update their statuses from their own goroutines while the /status
+and /badge handlers read them, so every access goes through the store's
+RWMutex: readers share it, writers (which also save the file) take it alone.
+*/
+
+// statusFile is where build statuses are persisted
+const statusFile = "builds.json"
+
+type buildStore struct {
+	path string
+
+	mu     sync.RWMutex
+	builds map[string]BuildStatus
+}
+
+// loadBuildStore reads the statuses saved at path; a missing file starts an empty store
+func loadBuildStore(path string) (*buildStore, error) {
+	store := &buildStore{path: path, builds: make(map[string]BuildStatus)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.builds); err != nil {
+		return nil, err
+	}
+
+	interrupted := false
+	for id, build := range store.builds {
+		if build.Status == "In Progress" || build.Status == "Queued" {
+			build.Status = "Interrupted"
+			build.Logs += "\nBuild interrupted by server restart"
+			store.builds[id] = build
+			interrupted = true
+		}
+	}
+	if interrupted {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.save()
+	}
+	return store, nil
+}
+
+// Get returns the status of one build
+func (s *buildStore) Get(id string) (BuildStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	build, ok := s.builds[id]
+	return build, ok
+}
+
+// All returns a copy of every build status
+func (s *buildStore) All() []BuildStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	builds := make([]BuildStatus, 0, len(s.builds))
+	for _, build := range s.builds {
+		builds = append(builds, build)
+	}
+	return builds
+}
+
+// Set stores a build status and persists the store
+func (s *buildStore) Set(build BuildStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.builds[build.ID] = build
+	s.save()
+}
+
+// Update sets a build's status and logs, keeping its pipeline and start time.
+// The read and write happen under one lock so concurrent updates cannot
+// overwrite each other's fields.
+func (s *buildStore) Update(id, status, logs string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	build := s.builds[id]
+	build.ID = id
+	build.Status = status
+	build.Logs = logs
+	s.builds[id] = build
+	s.save()
+}
+
+// SetArtifacts records the names of a build's saved artifacts
+func (s *buildStore) SetArtifacts(id string, names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	build, ok := s.builds[id]
+	if !ok {
+		return
+	}
+	build.Artifacts = names
+	s.builds[id] = build
+	s.save()
+}
+
+// save writes the store to disk; s.mu must be held. A failed write is
+// logged and the in-memory status kept, so builds carry on regardless.
+func (s *buildStore) save() {
+	data, err := json.MarshalIndent(s.builds, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding build statuses: %v", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".builds-*.json")
+	if err != nil {
+		log.Printf("Error saving build statuses: %v", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Error saving build statuses: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// quickPipeline is a config.yaml whose single step finishes at once
+const quickPipeline = `
+pipeline:
+  - name: "Quick"
+    cmd: ["true"]
+`
+
+/*
+*
+setupServer runs the test in a temporary directory holding configYAML as
+config.yaml, with a fresh build store and build queue, so builds.json and
+.ci-artifacts are never written next to the sources. It returns the server's
+router.
+*/
+func setupServer(t *testing.T, configYAML string) http.Handler {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// Let every build finish before its directory is removed
+		buildsWG.Wait()
+		os.Chdir(wd)
+	})
+
+	if err := os.WriteFile("config.yaml", []byte(configYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := loadBuildStore(statusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builds = store
+	buildSlots = make(chan struct{}, defaultConcurrentBuilds)
+	return newRouter()
+}
+
+// serve sends a request to the router and returns the recorded response
+func serve(t *testing.T, router http.Handler, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+// triggerTestBuild triggers a build through POST /build and returns its ID.
+// It reports failures with t.Errorf, so it may be called from any goroutine.
+func triggerTestBuild(t *testing.T, router http.Handler) string {
+	t.Helper()
+	rec := serve(t, router, http.MethodPost, "/build")
+	if rec.Code != http.StatusOK {
+		t.Errorf("POST /build: got %d %s", rec.Code, rec.Body)
+		return ""
+	}
+	var response map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Errorf("POST /build: %v", err)
+	}
+	return response["id"]
+}
+
+// waitForStatus polls the store until the build has one of the statuses
+func waitForStatus(t *testing.T, id string, statuses ...string) BuildStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		build, _ := builds.Get(id)
+		for _, status := range statuses {
+			if build.Status == status {
+				return build
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("build %s: status %q, want one of %q", id, build.Status, statuses)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Builds update the store from their own goroutines while handlers read it;
+// run with -race to catch unguarded access
+func TestConcurrentBuildsAndStatusReads(t *testing.T) {
+	router := setupServer(t, `
+pipeline:
+  - name: "One"
+    cmd: ["true"]
+  - name: "Two"
+    cmd: ["true"]
+  - name: "Three"
+    cmd: ["true"]
+`)
+
+	const triggers = 20
+	ids := make(chan string, triggers)
+	var wg sync.WaitGroup
+	for i := 0; i < triggers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := triggerTestBuild(t, router)
+			ids <- id
+
+			// Poll the build's status while it and the others are running
+			for {
+				rec := serve(t, router, http.MethodGet, "/status/"+id)
+				if rec.Code != http.StatusOK {
+					t.Errorf("GET /status/%s: got %d", id, rec.Code)
+					return
+				}
+				var build BuildStatus
+				if err := json.Unmarshal(rec.Body.Bytes(), &build); err != nil {
+					t.Errorf("GET /status/%s: %v", id, err)
+					return
+				}
+				if build.Status == "Success" || build.Status == "Failed" {
+					return
+				}
+			}
+		}()
+	}
+
+	// List every build and read the badge at the same time
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			serve(t, router, http.MethodGet, "/builds")
+			serve(t, router, http.MethodGet, "/badge/"+defaultPipeline)
+		}
+	}()
+	wg.Wait()
+	close(ids)
+
+	for id := range ids {
+		if build := waitForStatus(t, id, "Success", "Failed"); build.Status != "Success" {
+			t.Errorf("build %s: status %q, logs %q", id, build.Status, build.Logs)
+		}
+	}
+	if n := len(builds.All()); n != triggers {
+		t.Errorf("store holds %d builds, want %d", n, triggers)
+	}
+}
+
+// A build's final status is in builds.json, so every build must be there
+func TestConcurrentBuildsAreSaved(t *testing.T) {
+	router := setupServer(t, quickPipeline)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			triggerTestBuild(t, router)
+		}()
+	}
+	wg.Wait()
+	buildsWG.Wait()
+
+	data, err := os.ReadFile(statusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]BuildStatus
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	for id, build := range saved {
+		if build.Status != "Success" {
+			t.Errorf("%s saved as %q", id, build.Status)
+		}
+	}
+	if len(saved) != 10 {
+		t.Errorf("%s holds %d builds, want 10", statusFile, len(saved))
+	}
+}
+
+// Build statuses survive a restart: a new store loaded from builds.json
+// still serves them through /status/{id}
+func TestStatusSurvivesRestart(t *testing.T) {
+	router := setupServer(t, quickPipeline)
+	id := triggerTestBuild(t, router)
+	waitForStatus(t, id, "Success", "Failed")
+	buildsWG.Wait()
+
+	// Restart: forget the store and load it again from disk
+	store, err := loadBuildStore(statusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builds = store
+
+	rec := serve(t, newRouter(), http.MethodGet, "/status/"+id)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /status/%s after restart: got %d %s", id, rec.Code, rec.Body)
+	}
+	var build BuildStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &build); err != nil {
+		t.Fatal(err)
+	}
+	if build.ID != id || build.Status != "Success" || build.Pipeline != defaultPipeline {
+		t.Errorf("after restart got %+v, want build %s of %s with status Success", build, id, defaultPipeline)
+	}
+}
+
+// Builds that were running when the server stopped are marked Interrupted
+// on the next start, both in memory and in builds.json
+func TestRunningBuildInterruptedByRestart(t *testing.T) {
+	setupServer(t, quickPipeline)
+	builds.Set(BuildStatus{ID: "running", Pipeline: defaultPipeline, Status: "In Progress", StartedAt: time.Now()})
+	builds.Set(BuildStatus{ID: "queued", Pipeline: defaultPipeline, Status: "Queued", StartedAt: time.Now()})
+	builds.Set(BuildStatus{ID: "done", Pipeline: defaultPipeline, Status: "Failed", StartedAt: time.Now()})
+
+	for restart := 1; restart <= 2; restart++ {
+		store, err := loadBuildStore(statusFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"running": "Interrupted", "queued": "Interrupted", "done": "Failed"}
+		for id, status := range want {
+			if build, ok := store.Get(id); !ok || build.Status != status {
+				t.Errorf("restart %d: build %s has status %q, want %q", restart, id, build.Status, status)
+			}
+		}
+	}
+}
+
+// A missing builds.json starts an empty store, a corrupt one is an error
+func TestLoadBuildStoreFile(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := loadBuildStore(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	if n := len(store.All()); n != 0 {
+		t.Errorf("missing file: got %d builds, want an empty store", n)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBuildStore(corrupt); err == nil {
+		t.Error("corrupt file: got no error")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+/**
+GitHub webhook:
+POST /webhook accepts GitHub push events so builds start on every push.
+In the repository settings add a webhook with the payload URL
+http://<server>:8080/webhook, content type application/json, and a secret.
+The same secret must be in the GITHUB_WEBHOOK_SECRET environment variable of
+the server; it is kept out of config.yaml on purpose.
+
+Every delivery is checked against the X-Hub-Signature-256 header, an
+HMAC-SHA256 of the raw body keyed with the secret, and rejected with 401 if
+it does not match (or if no secret is configured). Only pushes to the branch
+set in config.yaml start a build:
+
+webhook:
+  branch: main      # the default
+
+The build is named after the repository (e.g. "app" for octo/app), so
+/badge/app shows its status, and its ID is returned so GitHub's delivery
+log shows it.
+A "ping" event (sent when the webhook is created) is answered with 200;
+other events are accepted and ignored.
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// defaultWebhookBranch is built when config.yaml does not name a branch
+const defaultWebhookBranch = "main"
+
+// maxWebhookBody is the largest payload accepted; GitHub caps them at 25MB
+const maxWebhookBody = 25 << 20
+
+// WebhookConfig selects which pushes trigger a build
+type WebhookConfig struct {
+	Branch string `yaml:"branch"`
+}
+
+// pushEvent holds the fields of a GitHub push payload that are used here
+type pushEvent struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Repository struct {
+		Name string `json:"name"`
+	} `json:"repository"`
+}
+
+// validSignature checks a X-Hub-Signature-256 header ("sha256=<hex>") against body
+func validSignature(secret, header string, body []byte) bool {
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// githubWebhook starts a build for a signed push to the configured branch
+func githubWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	secret := os.Getenv("GITHUB_WEBHOOK_SECRET")
+	if secret == "" || !validSignature(secret, r.Header.Get("X-Hub-Signature-256"), body) {
+		log.Printf("Rejected webhook delivery %s: bad signature", r.Header.Get("X-GitHub-Delivery"))
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "ping":
+		json.NewEncoder(w).Encode(map[string]string{"message": "pong"})
+		return
+	case "push":
+	default:
+		json.NewEncoder(w).Encode(map[string]string{"message": "Ignored event " + event})
+		return
+	}
+
+	var push pushEvent
+	if err := json.Unmarshal(body, &push); err != nil {
+		http.Error(w, "Invalid push payload", http.StatusBadRequest)
+		return
+	}
+
+	if shuttingDown.Load() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	config, err := LoadConfig("config.yaml")
+	if err != nil {
+		configError(w, err)
+		return
+	}
+
+	branch := config.Webhook.Branch
+	if branch == "" {
+		branch = defaultWebhookBranch
+	}
+	if push.Ref != "refs/heads/"+branch {
+		json.NewEncoder(w).Encode(map[string]string{"message": "Ignored push to " + push.Ref})
+		return
+	}
+
+	pipeline := push.Repository.Name
+	if pipeline == "" {
+		pipeline = defaultPipeline
+	}
+	log.Printf("Triggering build for push of %s to %s", push.After, push.Ref)
+	buildID := startBuild(config, pipeline)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":  "Build triggered",
+		"id":       buildID,
+		"pipeline": pipeline,
+		"commit":   push.After,
+	})
+}
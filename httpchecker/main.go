@@ -3,45 +3,591 @@ package main
 /**
 The net/http package in Go provides HTTP client and server implementations,
 allowing you to work with HTTP requests and responses.
+
+Run with -h for the list of flags. Schema validation, body matching, request
+tracing and the JSON/CSV output are described at the top of schema.go,
+match.go, trace.go and output.go.
 */
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
-// Function to check the HTTP status of a URL
-func checkStatus(url string) {
+// target is a URL to check and, optionally, the schema its JSON body must match
+type target struct {
+	URL    string
+	Schema *jsonSchema
+}
+
+// loadTargets reads the URLs to check from a JSON file (see schema.go)
+func loadTargets(path string) ([]target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []struct {
+		URL    string          `json:"url"`
+		Schema json.RawMessage `json:"schema"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	targets := make([]target, 0, len(entries))
+	for _, entry := range entries {
+		t := target{URL: entry.URL}
+		if len(entry.Schema) > 0 {
+			if t.Schema, err = loadSchema(entry.Schema); err != nil {
+				return nil, fmt.Errorf("schema for %s: %v", entry.URL, err)
+			}
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// readURLList reads newline-separated URLs from path, or from stdin when
+// path is "-". Blank lines and lines starting with # are ignored, and lines
+// that are not absolute http(s) URLs are skipped with a warning on stderr.
+func readURLList(path string) ([]target, error) {
+	input := os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	var targets []target
+	scanner := bufio.NewScanner(input)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s line %d: skipping %q, not an http(s) URL\n", path, lineNo, line)
+			continue
+		}
+		targets = append(targets, target{URL: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	return targets, nil
+}
+
+// maxSchemaBody limits how much of a response is read for schema validation
+const maxSchemaBody = 10 << 20
+
+// checkBudget is the total time a URL check may take, retries included
+const checkBudget = 10 * time.Second
+
+// firstRetryDelay is the wait before the first retry; it doubles after each one
+const firstRetryDelay = 200 * time.Millisecond
+
+// Result is the outcome of checking one URL. StatusCode is 0 when no
+// response was received; Latency is the time until the response headers
+// of the last attempt arrived, or until it failed. Attempts counts the
+// requests made, retries included.
+type Result struct {
+	URL        string
+	StatusCode int
+	Latency    time.Duration
+	Err        error
+	Attempts   int
+
+	// FinalURL is where followed redirects ended, or "" if there were none
+	FinalURL string
+
+	// CertExpiry is when the server's certificate expires; zero without TLS
+	CertExpiry time.Time
+
+	// Timing breaks the last request down into phases; only set with -trace
+	Timing *phaseTiming
+
+	// index is the URL's position in the input, used to print results in a stable order
+	index int
+}
+
+// checkOptions holds the command line settings that affect every check
+type checkOptions struct {
+	retries int
+	trace   bool
+	method  string
+	headers http.Header
+	body    string
+
+	// noRedirect reports a redirect's own status instead of following it
+	noRedirect bool
+
+	// certWarnDays flags certificates expiring in fewer days than this
+	certWarnDays int
+
+	// match is the content 2xx bodies must have (see match.go)
+	match bodyMatch
+}
+
+// headerFlags collects repeated -header "Key: value" flags
+type headerFlags http.Header
+
+func (h headerFlags) String() string {
+	var pairs []string
+	for key, values := range h {
+		for _, value := range values {
+			pairs = append(pairs, key+": "+value)
+		}
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (h headerFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("want Key: value, got %q", value)
+	}
+	http.Header(h).Add(key, strings.TrimSpace(val))
+	return nil
+}
+
+// Function to check the HTTP status of a URL. When the target has a schema,
+// a 2xx body that is not JSON or violates the schema is reported in Err.
+// Network errors and 5xx answers are retried up to opts.retries times,
+// waiting 200ms, 400ms, 800ms, ... in between, as long as checkBudget
+// allows; 4xx answers, schema failures and requests that cannot be built
+// (a bad URL or method) are not. Nothing is printed; that is left to the
+// caller.
+func checkStatus(t target, opts checkOptions) Result {
+	deadline := time.Now().Add(checkBudget)
+	delay := firstRetryDelay
+	for attempt := 1; ; attempt++ {
+		req, err := newCheckRequest(t, opts)
+		if err != nil {
+			return Result{URL: t.URL, Err: err, Attempts: attempt}
+		}
+		res := checkOnce(req, t, time.Until(deadline), opts)
+		res.Attempts = attempt
+		// Without a status code the error came from sending the request
+		transient := (res.Err != nil && res.StatusCode == 0) || res.StatusCode >= 500
+		if !transient || attempt > opts.retries || time.Now().Add(delay).After(deadline) {
+			return res
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// newCheckRequest builds the request for the target with the method,
+// headers and body of opts
+func newCheckRequest(t target, opts checkOptions) (*http.Request, error) {
+	var reqBody io.Reader
+	if opts.body != "" {
+		reqBody = strings.NewReader(opts.body)
+	}
+	req, err := http.NewRequest(opts.method, t.URL, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range opts.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	// Go sends the Host header from req.Host, not from req.Header
+	if host := opts.headers.Get("Host"); host != "" {
+		req.Host = host
+	}
+	return req, nil
+}
+
+// checkOnce sends req for the target, giving up after timeout, and with
+// opts.trace set records the timing of its phases
+func checkOnce(req *http.Request, t target, timeout time.Duration, opts checkOptions) Result {
 	// Set a timeout for the HTTP request
 	client := http.Client{
-		Timeout: 10 * time.Second, // 10 seconds timeout
+		Timeout: timeout,
+	}
+	if opts.noRedirect {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	res := Result{URL: t.URL}
+	if opts.trace {
+		res.Timing = &phaseTiming{}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), newTrace(res.Timing)))
 	}
 
-	// Send the HTTP GET request
-	resp, err := client.Get(url)
+	// Send the HTTP request
+	start := time.Now()
+	resp, err := client.Do(req)
+	res.Latency = time.Since(start)
 	if err != nil {
-		// If there's an error, print the error message
-		fmt.Printf("Error checking URL %s: %v\n", url, err)
-		return
+		res.Err = err
+		return res
 	}
 	defer resp.Body.Close()
+	res.StatusCode = resp.StatusCode
+	if final := resp.Request.URL.String(); final != t.URL {
+		res.FinalURL = final
+	}
+	// The leaf certificate comes first; plain http answers have no TLS state
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		res.CertExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
 
-	// Print the status code for the URL
-	fmt.Printf("URL: %s, Status Code: %d\n", url, resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || (t.Schema == nil && !opts.match.enabled()) {
+		return res
+	}
+
+	// Read the body once for both the content match and the schema
+	limit := opts.match.maxBytes
+	if t.Schema != nil {
+		limit = max(limit, maxSchemaBody)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		res.Err = fmt.Errorf("reading body: %v", err)
+		return res
+	}
+	if opts.match.enabled() {
+		if err := opts.match.check(data); err != nil {
+			res.Err = err
+			return res
+		}
+	}
+	if t.Schema == nil {
+		return res
+	}
+	var body interface{}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&body); err != nil {
+		res.Err = fmt.Errorf("schema check: body is not valid JSON: %v", err)
+	} else if violations := t.Schema.validate(body, "$"); len(violations) > 0 {
+		res.Err = fmt.Errorf("schema check: %s", strings.Join(violations, "; "))
+	}
+	return res
+}
+
+// statusClass groups a result into 2xx/3xx/4xx/5xx, "mismatch" if the body
+// lacked the expected content, or "error" if the request failed
+func statusClass(code int, err error) string {
+	if errors.Is(err, errBodyMismatch) {
+		return "mismatch"
+	}
+	if err != nil || code < 100 {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// progressBar draws "[#####-----] 12/40" on stderr, overwriting the same line.
+// It stays silent when stderr is not a terminal (e.g. redirected to a file),
+// so logs and pipes are not filled with carriage returns.
+type progressBar struct {
+	total   int
+	done    int
+	enabled bool
+}
+
+func newProgressBar(total int) *progressBar {
+	info, err := os.Stderr.Stat()
+	enabled := err == nil && info.Mode()&os.ModeCharDevice != 0
+	return &progressBar{total: total, enabled: enabled}
+}
+
+func (p *progressBar) increment() {
+	p.done++
+	if !p.enabled {
+		return
+	}
+	const width = 30
+	filled := width * p.done / p.total
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %d/%d", strings.Repeat("#", filled), strings.Repeat("-", width-filled), p.done, p.total)
+	if p.done == p.total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// up reports whether the URL counts as available: it answered without a 5xx
+func (r Result) up() bool {
+	return r.Err == nil && r.StatusCode < 500
+}
+
+// describe renders the result for the state change log, e.g. "up (200)" or "down (timeout)"
+func (r Result) describe() string {
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("down (%v)", r.Err)
+	case r.up():
+		return fmt.Sprintf("up (%d)", r.StatusCode)
+	default:
+		return fmt.Sprintf("down (%d)", r.StatusCode)
+	}
 }
 
 func main() {
-	// List of URLs to check
-	urls := []string{
-		"https://www.google.com",
-		"https://www.pixabay.com",
-		"https://www.github.com",
+	config := flag.String("config", "", "JSON file listing the URLs to check, each with an optional schema")
+	file := flag.String("file", "", "File with one URL per line to check (- reads stdin)")
+	interval := flag.Duration("interval", 0, "Keep checking every interval and print only status changes (0 = check once)")
+	concurrency := flag.Int("concurrency", defaultConcurrency, "Number of URLs checked at the same time")
+	retries := flag.Int("retries", 0, "Retry network errors and 5xx answers this many times, with exponential backoff")
+	trace := flag.Bool("trace", false, "Print the DNS, connect, TLS and first byte timing of each check")
+	method := flag.String("method", http.MethodGet, "HTTP method of the requests")
+	body := flag.String("body", "", "Body sent with every request")
+	noRedirect := flag.Bool("no-redirect", false, "Report the status of redirects (e.g. 301) instead of following them")
+	certWarnDays := flag.Int("cert-warn-days", defaultCertWarnDays, "Warn when an https certificate expires in fewer days than this")
+	output := flag.String("output", "text", "Output format: text, json or csv")
+	contains := flag.String("contains", "", "Fail 2xx checks whose body does not contain this text")
+	pattern := flag.String("regex", "", "Fail 2xx checks whose body does not match this regular expression")
+	maxBody := flag.Int64("max-body", defaultMaxBody, "Bytes of the body searched by -contains and -regex")
+	headers := headerFlags{}
+	flag.Var(headers, "header", "Header added to every request as \"Key: value\" (repeatable)")
+	flag.Parse()
+
+	if *output != "text" && *output != "json" && *output != "csv" {
+		fmt.Fprintf(os.Stderr, "-output must be text, json or csv, got %q\n", *output)
+		os.Exit(1)
+	}
+	if *maxBody < 1 {
+		fmt.Fprintln(os.Stderr, "-max-body must be at least 1")
+		os.Exit(1)
+	}
+	var regex *regexp.Regexp
+	if *pattern != "" {
+		var err error
+		if regex, err = regexp.Compile(*pattern); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -regex: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *output != "text" && *interval > 0 {
+		fmt.Fprintln(os.Stderr, "-interval prints state changes as text and cannot be combined with -output "+*output)
+		os.Exit(1)
+	}
+
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "-concurrency must be at least 1")
+		os.Exit(1)
+	}
+	if *retries < 0 {
+		fmt.Fprintln(os.Stderr, "-retries must not be negative")
+		os.Exit(1)
+	}
+
+	if *config != "" && *file != "" {
+		fmt.Fprintln(os.Stderr, "Use either -config or -file, not both")
+		os.Exit(1)
+	}
+
+	// List of URLs to check, unless a config file or URL list provides them
+	urls := []target{
+		{URL: "https://www.google.com"},
+		{URL: "https://www.pixabay.com"},
+		{URL: "https://www.github.com"},
+	}
+	if *config != "" {
+		targets, err := loadTargets(*config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", *config, err)
+			os.Exit(1)
+		}
+		urls = targets
+	}
+	if *file != "" {
+		targets, err := readURLList(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", *file, err)
+			os.Exit(1)
+		}
+		if len(targets) == 0 {
+			fmt.Fprintf(os.Stderr, "No URLs to check in %s\n", *file)
+			os.Exit(1)
+		}
+		urls = targets
+	}
+
+	// The first pass always prints the full report
+	var err error
+	opts := checkOptions{
+		retries: *retries,
+		trace:   *trace,
+		method:  strings.ToUpper(*method),
+		headers: http.Header(headers),
+		body:    *body,
+
+		noRedirect:   *noRedirect,
+		certWarnDays: *certWarnDays,
+		match:        bodyMatch{contains: *contains, regex: regex, maxBytes: *maxBody},
+	}
+	collected := checkAll(urls, *concurrency, opts, true)
+	switch *output {
+	case "json":
+		err = writeJSON(os.Stdout, collected)
+	case "csv":
+		err = writeCSV(os.Stdout, collected)
+	default:
+		printResults(collected, opts)
+		printSummary(collected)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *interval > 0 {
+		monitor(urls, collected, *concurrency, opts, *interval)
+	}
+}
+
+// monitor re-checks the URLs every interval and prints a timestamped line only
+// when a URL's state changes: it goes up or down, or answers with a different
+// status code. A URL that keeps failing with different errors is not reported
+// again until it recovers, so a steady outage does not flood the log.
+func monitor(urls []target, first []Result, concurrency int, opts checkOptions, interval time.Duration) {
+	last := make(map[string]Result)
+	for _, res := range first {
+		last[res.URL] = res
+	}
+	fmt.Printf("\nMonitoring %d URLs every %s, printing state changes only\n", len(urls), interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, res := range checkAll(urls, concurrency, opts, false) {
+			previous := last[res.URL]
+			last[res.URL] = res
+			if previous.up() == res.up() && previous.StatusCode == res.StatusCode {
+				continue
+			}
+			fmt.Printf("%s %s: %s -> %s\n", time.Now().Format(time.RFC3339), res.URL, previous.describe(), res.describe())
+		}
+	}
+}
+
+// defaultConcurrency is how many URLs are checked at once without -concurrency
+const defaultConcurrency = 10
+
+// checkAll checks the URLs with a pool of concurrency workers and returns
+// the results in the order of urls. With progress set, it draws the
+// progress bar while the checks run.
+func checkAll(urls []target, concurrency int, opts checkOptions, progress bool) []Result {
+	// The workers take URL indexes from jobs; results arrive as each check completes
+	jobs := make(chan int)
+	results := make(chan Result)
+	var wg sync.WaitGroup
+	for w := 0; w < min(concurrency, len(urls)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res := checkStatus(urls[i], opts)
+				res.index = i
+				results <- res
+			}
+		}()
+	}
+	go func() {
+		for i := range urls {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Collect results, advancing the progress bar on stderr
+	bar := newProgressBar(len(urls))
+	var collected []Result
+	for res := range results {
+		collected = append(collected, res)
+		if progress {
+			bar.increment()
+		}
+	}
+
+	// Return them in input order, so runs can be compared line by line
+	sort.Slice(collected, func(i, j int) bool { return collected[i].index < collected[j].index })
+	return collected
+}
+
+// printResults prints the text report, one line per URL
+func printResults(results []Result, opts checkOptions) {
+	for _, res := range results {
+		details := ""
+		if res.Attempts > 1 {
+			details = fmt.Sprintf(" after %d attempts", res.Attempts)
+		}
+		if res.FinalURL != "" {
+			details += ", redirected to " + res.FinalURL
+		}
+		if !res.CertExpiry.IsZero() {
+			details += ", " + describeCert(res.CertExpiry, opts.certWarnDays)
+		}
+		switch {
+		case errors.Is(res.Err, errBodyMismatch):
+			fmt.Printf("URL: %s, Status Code: %d, Latency: %s%s, %v\n", res.URL, res.StatusCode, res.Latency.Round(time.Millisecond), details, res.Err)
+		case res.Err != nil:
+			fmt.Printf("Error checking URL %s%s: %v\n", res.URL, details, res.Err)
+		default:
+			fmt.Printf("URL: %s, Status Code: %d, Latency: %s%s\n", res.URL, res.StatusCode, res.Latency.Round(time.Millisecond), details)
+		}
+		if res.Timing != nil {
+			fmt.Printf("  %s\n", res.Timing)
+		}
+	}
+}
+
+// defaultCertWarnDays is the -cert-warn-days default
+const defaultCertWarnDays = 14
+
+// describeCert renders a certificate's expiry, e.g. "certificate expires in
+// 80 days", flagging it when fewer than warnDays days are left. Expired
+// certificates never get here: the TLS handshake already fails with an error.
+func describeCert(expiry time.Time, warnDays int) string {
+	days := int(time.Until(expiry).Hours() / 24)
+	if days < warnDays {
+		return fmt.Sprintf("WARNING: certificate expires in %d days", days)
+	}
+	return fmt.Sprintf("certificate expires in %d days", days)
+}
+
+// printSummary prints how many URLs fell into each status class
+func printSummary(results []Result) {
+	counts := make(map[string]int)
+	for _, res := range results {
+		counts[statusClass(res.StatusCode, res.Err)]++
 	}
 
-	// Check the status of each URL
-	for _, url := range urls {
-		checkStatus(url)
+	fmt.Println("\nSummary:")
+	fmt.Printf("  %-8s %s\n", "Class", "Count")
+	for _, class := range []string{"1xx", "2xx", "3xx", "4xx", "5xx", "mismatch", "error"} {
+		// 1xx final responses are rare and mismatches need -contains or
+		// -regex, only show them when present
+		if (class == "1xx" || class == "mismatch") && counts[class] == 0 {
+			continue
+		}
+		fmt.Printf("  %-8s %d\n", class, counts[class])
 	}
+	fmt.Printf("  %-8s %d\n", "total", len(results))
 }
 
 /**
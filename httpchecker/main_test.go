@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// getOptions are the settings of a plain run without flags
+var getOptions = checkOptions{method: http.MethodGet}
+
+func TestCheckStatusOK(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	res := checkStatus(target{URL: srv.URL}, getOptions)
+	if res.Err != nil {
+		t.Fatalf("got error %v", res.Err)
+	}
+	if res.URL != srv.URL || res.StatusCode != http.StatusOK || res.Attempts != 1 {
+		t.Errorf("got URL %q, status %d, %d attempts; want %q, 200, 1", res.URL, res.StatusCode, res.Attempts, srv.URL)
+	}
+	if res.Latency <= 0 {
+		t.Errorf("latency %s not measured", res.Latency)
+	}
+	if res.FinalURL != "" || !res.CertExpiry.IsZero() || res.Timing != nil {
+		t.Errorf("got FinalURL %q, CertExpiry %s, Timing %v; want them unset", res.FinalURL, res.CertExpiry, res.Timing)
+	}
+	if !res.up() {
+		t.Error("a 200 result is not up")
+	}
+}
+
+func TestCheckStatusConnectionFailure(t *testing.T) {
+	// Nothing listens on the address of a closed server
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	res := checkStatus(target{URL: url}, getOptions)
+	if res.Err == nil {
+		t.Fatal("got no error for a refused connection")
+	}
+	if res.StatusCode != 0 || res.Attempts != 1 {
+		t.Errorf("got status %d, %d attempts; want 0, 1", res.StatusCode, res.Attempts)
+	}
+	if res.up() || statusClass(res.StatusCode, res.Err) != "error" {
+		t.Errorf("a refused connection is up or classed %q", statusClass(res.StatusCode, res.Err))
+	}
+}
+
+// 5xx answers are retried with -retries, 4xx answers are not
+func TestCheckStatusRetries(t *testing.T) {
+	tests := []struct {
+		status       int
+		wantAttempts int
+	}{
+		{http.StatusServiceUnavailable, 3},
+		{http.StatusNotFound, 1},
+	}
+	for _, tt := range tests {
+		var requests atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(tt.status)
+		}))
+
+		opts := getOptions
+		opts.retries = 2
+		res := checkStatus(target{URL: srv.URL}, opts)
+		srv.Close()
+
+		if res.StatusCode != tt.status || res.Attempts != tt.wantAttempts || int(requests.Load()) != tt.wantAttempts {
+			t.Errorf("%d: got status %d after %d attempts (%d requests), want %d attempts",
+				tt.status, res.StatusCode, res.Attempts, requests.Load(), tt.wantAttempts)
+		}
+	}
+}
+
+// A request that cannot be built fails at once instead of using up retries
+func TestCheckStatusBadRequestNotRetried(t *testing.T) {
+	tests := []struct {
+		url, method string
+	}{
+		{"http://example.com/%zz", http.MethodGet},
+		{"http://example.com/", "BAD METHOD"},
+	}
+	for _, tt := range tests {
+		opts := getOptions
+		opts.method = tt.method
+		opts.retries = 3
+		start := time.Now()
+		res := checkStatus(target{URL: tt.url}, opts)
+		if res.Err == nil || res.Attempts != 1 || time.Since(start) >= firstRetryDelay {
+			t.Errorf("%s %s: got error %v after %d attempts in %s, want a failure on the first",
+				tt.method, tt.url, res.Err, res.Attempts, time.Since(start))
+		}
+	}
+}
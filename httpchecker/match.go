@@ -0,0 +1,54 @@
+package main
+
+/**
+Body matching:
+A 200 does not mean the page is right; a broken deploy can answer 200 with
+an error page. -contains (plain text) and -regex (a Go regular expression)
+make a 2xx check fail unless the response body contains the given content:
+
+	httpchecker -file urls.txt -contains "Welcome" -regex "version: [0-9.]+"
+
+Only the first -max-body bytes (default 1MB) are read, so a huge download
+cannot stall the check; content after that is not searched. A failed match
+is reported as "body mismatch" and counted on its own line of the summary,
+apart from HTTP and network errors. Like schema failures it is not retried.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// defaultMaxBody is how much of a body is searched without -max-body
+const defaultMaxBody = 1 << 20
+
+// errBodyMismatch marks checks whose body lacked the expected content
+var errBodyMismatch = errors.New("body mismatch")
+
+// bodyMatch is the content a 2xx body must have
+type bodyMatch struct {
+	contains string
+	regex    *regexp.Regexp
+	maxBytes int64
+}
+
+// enabled reports whether -contains or -regex was given
+func (m bodyMatch) enabled() bool {
+	return m.contains != "" || m.regex != nil
+}
+
+// check returns an errBodyMismatch error unless body has the expected content
+func (m bodyMatch) check(body []byte) error {
+	if int64(len(body)) > m.maxBytes {
+		body = body[:m.maxBytes]
+	}
+	if m.contains != "" && !bytes.Contains(body, []byte(m.contains)) {
+		return fmt.Errorf("%w: %q not found in the first %d bytes", errBodyMismatch, m.contains, m.maxBytes)
+	}
+	if m.regex != nil && !m.regex.Match(body) {
+		return fmt.Errorf("%w: no match for /%s/ in the first %d bytes", errBodyMismatch, m.regex, m.maxBytes)
+	}
+	return nil
+}
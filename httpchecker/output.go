@@ -0,0 +1,110 @@
+package main
+
+/**
+Machine readable output:
+-output json prints the results as one JSON array, in input order:
+
+	[{"url":"https://www.github.com","status":200,"latency_ms":143,
+	  "error":"","attempts":1,"final_url":"","cert_expiry":"2025-03-01T12:00:00Z"}]
+
+-output csv prints a header row and one row per URL:
+
+	url,status,latency_ms,error
+	https://www.github.com,200,143,
+
+status is 0 when no response was received, and error is empty for URLs that
+passed. With -trace each entry of the JSON array also has a "timing_ms"
+object with the dns, connect, tls and first_byte times and whether the
+connection was reused. The progress bar still goes to stderr, so stdout holds only the
+results and can be piped straight into jq or a spreadsheet.
+*/
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// jsonResult is the JSON form of a Result
+type jsonResult struct {
+	URL        string      `json:"url"`
+	Status     int         `json:"status"`
+	LatencyMS  int64       `json:"latency_ms"`
+	Error      string      `json:"error"`
+	Attempts   int         `json:"attempts"`
+	FinalURL   string      `json:"final_url"`
+	CertExpiry *time.Time  `json:"cert_expiry,omitempty"`
+	Timing     *jsonTiming `json:"timing_ms,omitempty"`
+}
+
+// jsonTiming is the JSON form of a phaseTiming, in milliseconds
+type jsonTiming struct {
+	DNS       float64 `json:"dns"`
+	Connect   float64 `json:"connect"`
+	TLS       float64 `json:"tls"`
+	FirstByte float64 `json:"first_byte"`
+	Reused    bool    `json:"reused"`
+}
+
+// milliseconds converts d to fractional milliseconds, as phases are often under 1ms
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// errorText returns the result's error message, or "" if it passed
+func (r Result) errorText() string {
+	if r.Err == nil {
+		return ""
+	}
+	return r.Err.Error()
+}
+
+// writeJSON writes the results as an indented JSON array
+func writeJSON(w io.Writer, results []Result) error {
+	out := make([]jsonResult, 0, len(results))
+	for _, res := range results {
+		jr := jsonResult{
+			URL:       res.URL,
+			Status:    res.StatusCode,
+			LatencyMS: res.Latency.Milliseconds(),
+			Error:     res.errorText(),
+			Attempts:  res.Attempts,
+			FinalURL:  res.FinalURL,
+		}
+		if t := res.Timing; t != nil {
+			jr.Timing = &jsonTiming{
+				DNS:       milliseconds(t.DNS),
+				Connect:   milliseconds(t.Connect),
+				TLS:       milliseconds(t.TLS),
+				FirstByte: milliseconds(t.FirstByte),
+				Reused:    t.Reused,
+			}
+		}
+		if !res.CertExpiry.IsZero() {
+			expiry := res.CertExpiry
+			jr.CertExpiry = &expiry
+		}
+		out = append(out, jr)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// writeCSV writes a header row and one row per result
+func writeCSV(w io.Writer, results []Result) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"url", "status", "latency_ms", "error"})
+	for _, res := range results {
+		writer.Write([]string{
+			res.URL,
+			strconv.Itoa(res.StatusCode),
+			strconv.FormatInt(res.Latency.Milliseconds(), 10),
+			res.errorText(),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
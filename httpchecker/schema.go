@@ -0,0 +1,227 @@
+package main
+
+/**
+Schema validation:
+A URL in the -config file can carry a JSON Schema. Its response body must
+then be JSON that matches the schema, otherwise the check fails even with a
+200, which catches endpoints that answer but return a broken payload:
+
+	[
+	  {"url": "https://api.example.com/health",
+	   "schema": {"type": "object", "required": ["status"],
+	              "properties": {"status": {"enum": ["ok"]}}}},
+	  {"url": "https://api.example.com/users", "schema": "schemas/users.json"}
+	]
+
+The schema is given inline or as the path of a schema file. The validator
+supports the commonly used subset of JSON Schema: type, enum, const,
+properties, required, additionalProperties (true/false), items, minItems,
+maxItems, minLength, maxLength, pattern, minimum and maximum. Other keywords
+are ignored. Only 2xx responses are validated.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// jsonSchema is a parsed schema node
+type jsonSchema struct {
+	Type                 interface{}            `json:"type"` // a name or a list of names
+	Enum                 []interface{}          `json:"enum"`
+	Const                interface{}            `json:"const"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+
+	pattern *regexp.Regexp // Pattern, compiled by loadSchema
+}
+
+// loadSchema parses an inline schema object or reads it from the file named
+// by a JSON string
+func loadSchema(raw json.RawMessage) (*jsonSchema, error) {
+	var path string
+	if err := json.Unmarshal(raw, &path); err == nil {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		raw = data
+	}
+	var schema jsonSchema
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	if err := schema.compile("$"); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return &schema, nil
+}
+
+// compile compiles the patterns of the schema and its subschemas, so a bad
+// pattern is reported once at load time instead of on every response
+func (s *jsonSchema) compile(path string) error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: pattern %q: %v", path, s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			continue
+		}
+		if err := property.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(path + "[]")
+	}
+	return nil
+}
+
+// validate returns every violation of the schema found in value, each
+// prefixed with its location such as "$.users[2].email"
+func (s *jsonSchema) validate(value interface{}, path string) []string {
+	var violations []string
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := s.types(); len(types) > 0 && !matchesType(value, types) {
+		fail("expected %s, got %s", strings.Join(types, " or "), jsonType(value))
+		return violations
+	}
+	if s.Const != nil && !reflect.DeepEqual(value, s.Const) {
+		fail("expected %v", s.Const)
+	}
+	if len(s.Enum) > 0 && !containsValue(s.Enum, value) {
+		fail("%v is not one of %v", value, s.Enum)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				violations = append(violations, property.validate(v[name], path+"."+name)...)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				fail("unexpected property %q", name)
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("has %d items, minimum is %d", len(v), *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("has %d items, maximum is %d", len(v), *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				violations = append(violations, s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("string is shorter than %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("string is longer than %d", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("%q does not match %q", v, s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("%v is below the minimum %v", v, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("%v is above the maximum %v", v, *s.Maximum)
+		}
+	}
+	return violations
+}
+
+// types returns the allowed type names
+func (s *jsonSchema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var names []string
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func matchesType(value interface{}, types []string) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		// Every integer is also a number
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
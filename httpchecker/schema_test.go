@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// An invalid pattern anywhere in the schema is rejected when it is loaded
+func TestLoadSchemaRejectsInvalidPattern(t *testing.T) {
+	tests := []struct {
+		schema string
+		where  string
+	}{
+		{`{"type": "string", "pattern": "[a-z"}`, "$:"},
+		{`{"properties": {"email": {"pattern": "(unclosed"}}}`, "$.email:"},
+		{`{"items": {"properties": {"id": {"pattern": "*"}}}}`, "$[].id:"},
+	}
+	for _, tt := range tests {
+		_, err := loadSchema(json.RawMessage(tt.schema))
+		if err == nil || !strings.Contains(err.Error(), tt.where) {
+			t.Errorf("%s: got error %v, want one at %s", tt.schema, err, tt.where)
+		}
+	}
+}
+
+func TestSchemaPattern(t *testing.T) {
+	schema, err := loadSchema(json.RawMessage(`{"items": {"properties": {"email": {"pattern": "^[^@]+@[^@]+$"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body interface{}
+	json.Unmarshal([]byte(`[{"email": "a@example.com"}, {"email": "not an address"}]`), &body)
+
+	violations := schema.validate(body, "$")
+	if len(violations) != 1 || !strings.HasPrefix(violations[0], "$[1].email: ") {
+		t.Errorf("got violations %q, want one for $[1].email", violations)
+	}
+}
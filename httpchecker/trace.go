@@ -0,0 +1,97 @@
+package main
+
+/**
+Request tracing:
+With -trace every check also records how long each phase of its last
+request took, using the hooks of net/http/httptrace:
+
+	dns: resolving the host name
+	connect: opening the TCP connection
+	tls: the TLS handshake (https only)
+	first byte: from sending the request until the first byte of the answer
+
+and prints them under the result, e.g.
+
+	URL: https://www.github.com, Status Code: 200, Latency: 143ms
+	  dns 12ms, connect 20ms, tls 45ms, first byte 61ms
+
+When a kept-alive connection is reused (for example on a retry or in
+-interval mode) there is no dns, connect or tls phase, and the line says so.
+*/
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// phaseTiming holds the duration of each phase of a traced request
+type phaseTiming struct {
+	DNS, Connect, TLS, FirstByte time.Duration
+	Reused                       bool
+}
+
+// String renders the timing as "dns 12ms, connect 20ms, tls 45ms, first byte 61ms"
+func (p *phaseTiming) String() string {
+	var parts []string
+	if p.Reused {
+		parts = append(parts, "reused connection")
+	}
+	for _, phase := range []struct {
+		name string
+		d    time.Duration
+	}{{"dns", p.DNS}, {"connect", p.Connect}, {"tls", p.TLS}, {"first byte", p.FirstByte}} {
+		if phase.d > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", phase.name, roundPhase(phase.d)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// roundPhase rounds to milliseconds, keeping sub-millisecond phases (common
+// on local networks) readable instead of showing them as 0s
+func roundPhase(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+// newTrace returns the hooks that fill timing in; the hooks may be called from
+// several goroutines (e.g. when IPv4 and IPv6 are dialed at once), so the
+// timing is only safe to read after the request has finished
+func newTrace(timing *phaseTiming) *httptrace.ClientTrace {
+	var mu sync.Mutex
+	var dnsStart, connectStart, tlsStart, wroteRequest time.Time
+	record := func(start *time.Time, into *time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !start.IsZero() {
+			*into = time.Since(*start)
+		}
+	}
+	mark := func(at *time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		*at = time.Now()
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { record(&dnsStart, &timing.DNS) },
+		ConnectStart:      func(string, string) { mark(&connectStart) },
+		ConnectDone:       func(string, string, error) { record(&connectStart, &timing.Connect) },
+		TLSHandshakeStart: func() { mark(&tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { record(&tlsStart, &timing.TLS) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			timing.Reused = info.Reused
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { mark(&wroteRequest) },
+		GotFirstResponseByte: func() { record(&wroteRequest, &timing.FirstByte) },
+	}
+}
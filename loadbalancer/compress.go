@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+/*
+*
+Response compression:
+When enabled with -gzip, responses are gzipped on the way back to clients that
+send "Accept-Encoding: gzip". A response is left untouched when:
+
+- the upstream already set a Content-Encoding (no double compression)
+- its Content-Type is not in the configured list (e.g. images, archives)
+- it is smaller than minBytes and its length is known
+- it has no body (HEAD, 204, 304) or is an event stream
+
+Streaming responses keep working: every chunk read from the upstream is
+compressed and flushed straight away instead of waiting for a full gzip block.
+*/
+type compressionConfig struct {
+	types    []string // media types such as "application/json" or "text/*"
+	minBytes int64
+}
+
+func newCompressionConfig(types string, minBytes int64) *compressionConfig {
+	config := &compressionConfig{minBytes: minBytes}
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.TrimSpace(strings.ToLower(t)); t != "" {
+			config.types = append(config.types, t)
+		}
+	}
+	return config
+}
+
+// compressible reports whether a Content-Type header matches the configured types
+func (c *compressionConfig) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.types {
+		if t == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip reports whether the client listed gzip in Accept-Encoding
+func acceptsGzip(header http.Header) bool {
+	for _, part := range strings.Split(header.Get("Accept-Encoding"), ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(encoding), "gzip") && strings.TrimSpace(params) != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// modifyResponse is installed as the ReverseProxy's ModifyResponse hook and
+// swaps the body for a gzip stream when the response qualifies.
+func (c *compressionConfig) modifyResponse(resp *http.Response) error {
+	// resp.Request is the outgoing request, which carries the client's headers
+	if resp.Request == nil || !acceptsGzip(resp.Request.Header) {
+		return nil
+	}
+	if resp.Request.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent ||
+		resp.StatusCode == http.StatusNotModified || resp.StatusCode < 200 {
+		return nil
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if resp.Header.Get("Content-Encoding") != "" || !c.compressible(contentType) ||
+		strings.HasPrefix(contentType, "text/event-stream") {
+		return nil
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength < c.minBytes {
+		return nil
+	}
+
+	resp.Body = newGzipBody(resp.Body)
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Content-Encoding", "gzip")
+	resp.Header.Add("Vary", "Accept-Encoding")
+	// The upstream's ETag describes the uncompressed bytes
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		resp.Header.Set("ETag", "W/"+etag)
+	}
+	return nil
+}
+
+/*
+*
+gzipBody compresses an upstream body as it is read. Each upstream read is
+written to the gzip writer and flushed, so the client receives data as soon as
+the upstream sends it.
+*/
+type gzipBody struct {
+	src   io.ReadCloser
+	gz    *gzip.Writer
+	out   bytes.Buffer
+	chunk []byte
+	done  bool
+}
+
+func newGzipBody(src io.ReadCloser) *gzipBody {
+	body := &gzipBody{src: src, chunk: make([]byte, 32*1024)}
+	body.gz = gzip.NewWriter(&body.out)
+	return body
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	for b.out.Len() == 0 {
+		if b.done {
+			return 0, io.EOF
+		}
+		n, err := b.src.Read(b.chunk)
+		if n > 0 {
+			b.gz.Write(b.chunk[:n])
+			b.gz.Flush()
+		}
+		if err == io.EOF {
+			b.gz.Close()
+			b.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return b.out.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.src.Close()
+}
@@ -7,57 +7,121 @@ http: Provides functions to create and handle HTTP requests and responses.
 httputil: Contains utilities like the NewSingleHostReverseProxy function,
 which helps forward requests to backend servers.
 url: Provides utilities for URL parsing, which is used when defining the backend servers.
-sync: Provides the Mutex type, which is used to safely manage concurrent access to shared
-resources (like the round-robin index).
+sort, strings: Used to order pools by prefix length and match request paths against them.
+context, time, errors: Used to put a deadline on proxied requests and recognise timeout
+and body-size errors.
+flag: Reads the timeout and body size limits from the command line.
+crypto/tls, net: Used to serve HTTPS and redirect plain HTTP to it (see tls.go).
 */
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"sync"
+	"sort"
+	"strings"
+	"time"
 )
 
+/*
+*
+Pool: A named group of backend servers that share a route prefix (e.g. "/api/").
+Each pool has its own Strategy (round-robin index or hash ring), so pools are
+balanced independently.
+*/
+type Pool struct {
+	name     string
+	prefix   string
+	strategy Strategy
+}
+
+// StrategyFactory builds the balancing strategy for a pool's servers
+type StrategyFactory func(servers []string) Strategy
+
+/*
+*
+LoadBalancer: Holds the routed pools plus a default pool that receives every
+request whose path does not match any pool prefix.
+*/
 type LoadBalancer struct {
-	servers []string
-	mu      sync.Mutex
-	index   int
+	pools       []*Pool
+	defaultPool *Pool
+	newStrategy StrategyFactory
+
+	// requestTimeout bounds how long a proxied request may take (0 = no limit)
+	requestTimeout time.Duration
+
+	// maxBodyBytes is the largest request body accepted (0 = no limit)
+	maxBodyBytes int64
+
+	// compression gzips responses for clients that accept it (nil = off)
+	compression *compressionConfig
+
+	// flushInterval is how often buffered response data is flushed to the
+	// client (0 = the proxy's default buffering, negative = after every write)
+	flushInterval time.Duration
 }
 
 /*
 *
 NewLoadBalancer: A constructor function that initializes and returns a new LoadBalancer
-object with the provided list of servers.
+object with the provided list of servers as its default pool. newStrategy is used
+for the default pool and every pool added later; nil means round-robin.
 */
-func NewLoadBalancer(servers []string) *LoadBalancer {
-	return &LoadBalancer{servers: servers}
+func NewLoadBalancer(servers []string, newStrategy StrategyFactory) *LoadBalancer {
+	if newStrategy == nil {
+		newStrategy = func(servers []string) Strategy { return NewRoundRobin(servers) }
+	}
+	return &LoadBalancer{
+		defaultPool: &Pool{name: "default", prefix: "/", strategy: newStrategy(servers)},
+		newStrategy: newStrategy,
+	}
 }
 
-// GetNextServer returns the next backend server in a round-robin fashion
-/**
-GetNextServer: This function returns the next backend server in the list, using
-round-robin logic:
-lb.mu.Lock(): Locks the Mutex to ensure only one goroutine can access the index at a time.
+/*
+*
+AddPool: Registers a named pool of servers for requests whose path starts with prefix.
+Pools are kept sorted by prefix length, longest first, so the most specific
+prefix wins when prefixes overlap (e.g. "/api/v2/" before "/api/").
+*/
+func (lb *LoadBalancer) AddPool(name, prefix string, servers []string) {
+	lb.pools = append(lb.pools, &Pool{name: name, prefix: prefix, strategy: lb.newStrategy(servers)})
+	sort.SliceStable(lb.pools, func(i, j int) bool {
+		return len(lb.pools[i].prefix) > len(lb.pools[j].prefix)
+	})
+}
+
+// SelectPool returns the pool whose prefix matches the path, or the default pool
+func (lb *LoadBalancer) SelectPool(path string) *Pool {
+	for _, pool := range lb.pools {
+		if strings.HasPrefix(path, pool.prefix) {
+			return pool
+		}
+	}
+	return lb.defaultPool
+}
 
-defer lb.mu.Unlock(): Ensures that the lock is released after the function completes.
+// GetNextServer returns the backend server chosen by the pool's strategy
+/**
+GetNextServer: This function returns the backend server for the request, as
+chosen by the pool's Strategy:
 
-lb.index: Selects the current server using the index.
+RoundRobin: Takes the servers in turn, wrapping around at the end of the list.
 
-(lb.index + 1) % len(lb.servers): Increments the index and wraps it around to the start
+HashRing: Hashes the request key (path, header, ...) so the same key always
+lands on the same server.
 
-of the list when reaching the end (round-robin behavior).
 Logging: The selected server is logged for debugging purposes.
 */
-func (lb *LoadBalancer) GetNextServer() string {
-	lb.mu.Lock()
-	defer lb.mu.Unlock()
-
-	server := lb.servers[lb.index]
-	lb.index = (lb.index + 1) % len(lb.servers) // Round-robin logic
+func (p *Pool) GetNextServer(r *http.Request) string {
+	server := p.strategy.Select(r)
 
 	// Log the server being used for debugging
-	log.Printf("Selecting backend server: %s\n", server)
+	log.Printf("Selecting backend server from pool %s: %s\n", p.name, server)
 
 	return server
 }
@@ -67,8 +131,10 @@ func (lb *LoadBalancer) GetNextServer() string {
 ProxyHandler: This function handles HTTP requests coming to the load balancer and forwards
 them to the appropriate backend server.
 
-GetNextServer(): Calls the function we defined earlier to get the next server in the
-round-robin rotation.
+SelectPool(): Picks the pool by matching the request path against the pool prefixes.
+
+GetNextServer(): Calls the function we defined earlier to get the server picked by
+the pool's strategy (round-robin rotation or consistent hash of the request key).
 
 url.Parse(server): Parses the backend server URL so that we can create a reverse proxy.
 
@@ -77,10 +143,43 @@ to the selected backend server.
 
 proxy.ServeHTTP(w, r): This function actually proxies the incoming request (r) to the
 backend server and returns the response to the client.
+
+Limits: Bodies larger than maxBodyBytes are rejected with 413, and a context
+deadline of requestTimeout is attached to the request so a hung backend gets
+a 504 instead of holding the client connection forever.
+
+Compression: With -gzip, responses of the configured content types are gzipped
+for clients that accept it (see compress.go). -flush-interval controls how
+often the proxy flushes buffered response data to the client.
 */
 func (lb *LoadBalancer) ProxyHandler(w http.ResponseWriter, r *http.Request) {
-	// Get the next server
-	server := lb.GetNextServer()
+	// Reject oversized bodies up front when the size is known, and cap the
+	// reader for chunked bodies whose size is only discovered while streaming
+	if lb.maxBodyBytes > 0 {
+		if r.ContentLength > lb.maxBodyBytes {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, lb.maxBodyBytes)
+	}
+
+	// Give the whole proxied request a deadline
+	if lb.requestTimeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), lb.requestTimeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	// Pick the pool for this path, then the next server within it
+	pool := lb.SelectPool(r.URL.Path)
+	server := pool.GetNextServer(r)
+	if server == "" {
+		http.Error(w, "No backend servers available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Tell the backend whether the client connected over HTTPS
+	r.Header.Set("X-Forwarded-Proto", forwardedProto(r))
 
 	// Log the server selection (for debugging)
 	log.Printf("Forwarding request to: %s\n", server)
@@ -94,25 +193,111 @@ func (lb *LoadBalancer) ProxyHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Create the reverse proxy
 	proxy := httputil.NewSingleHostReverseProxy(url)
+	proxy.ErrorHandler = proxyErrorHandler
+	proxy.FlushInterval = lb.flushInterval
+	if lb.compression != nil {
+		proxy.ModifyResponse = lb.compression.modifyResponse
+	}
 
 	// Proxy the request to the backend server
 	proxy.ServeHTTP(w, r)
 }
 
+/*
+*
+proxyErrorHandler: Maps proxy failures to status codes. A request that ran past
+its deadline gets 504 Gateway Timeout, a body over the size limit gets
+413 Payload Too Large, and any other backend failure gets 502 Bad Gateway.
+*/
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Proxy error for %s: %v\n", r.URL.Path, err)
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "Backend timed out", http.StatusGatewayTimeout)
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, "Bad gateway", http.StatusBadGateway)
+	}
+}
+
 func main() {
+	timeout := flag.Duration("timeout", 30*time.Second, "Maximum time for a proxied request (0 disables)")
+	maxBody := flag.Int64("max-body", 10<<20, "Maximum request body size in bytes (0 disables)")
+	strategyName := flag.String("strategy", "round-robin", "Balancing strategy: round-robin or consistent-hash")
+	gzipEnabled := flag.Bool("gzip", false, "Gzip responses for clients that accept it, unless the upstream already compressed them")
+	gzipTypes := flag.String("gzip-types", "text/*,application/json,application/javascript,application/xml,image/svg+xml", "Comma-separated content types to gzip (type/* matches a whole family)")
+	gzipMinBytes := flag.Int64("gzip-min-bytes", 1024, "Skip gzip for responses with a known length below this many bytes")
+	flushInterval := flag.Duration("flush-interval", 0, "Flush buffered response data to clients this often (0 = default buffering, -1ns = flush immediately)")
+	tlsCert := flag.String("tls-cert", "", "Certificate file for HTTPS (enables TLS together with -tls-key)")
+	tlsKey := flag.String("tls-key", "", "Private key file for HTTPS")
+	tlsAddr := flag.String("tls-addr", ":8443", "Address for the HTTPS listener")
+	httpsRedirect := flag.Bool("https-redirect", false, "Redirect plain HTTP requests to HTTPS instead of proxying them")
+	keySource := flag.String("hash-key", "path", "Key for consistent-hash: path, ip, header:<name> or query:<name>")
+	flag.Parse()
+
+	// Check the strategy flags once up front so the factory below cannot fail
+	if _, err := NewStrategy(*strategyName, *keySource, nil); err != nil {
+		log.Fatal(err)
+	}
+	newStrategy := func(servers []string) Strategy {
+		strategy, _ := NewStrategy(*strategyName, *keySource, servers)
+		return strategy
+	}
+
 	// List of backend servers
 	backendServers := []string{
 		"http://localhost:8081",
 		"http://localhost:8082",
 	}
 
-	// Create a new load balancer
-	lb := NewLoadBalancer(backendServers)
+	// Create a new load balancer; backendServers handle unmatched paths
+	lb := NewLoadBalancer(backendServers, newStrategy)
+	lb.requestTimeout = *timeout
+	lb.maxBodyBytes = *maxBody
+	lb.flushInterval = *flushInterval
+	if *gzipEnabled {
+		lb.compression = newCompressionConfig(*gzipTypes, *gzipMinBytes)
+	}
+
+	// Route prefixes to their own pools, each balanced independently
+	lb.AddPool("api", "/api/", []string{
+		"http://localhost:8081",
+		"http://localhost:8082",
+	})
+	lb.AddPool("static", "/static/", []string{
+		"http://localhost:8083",
+	})
 
 	// Start the load balancer server
 	http.HandleFunc("/", lb.ProxyHandler)
 
-	// Run the load balancer on port 8080
-	fmt.Println("Load Balancer running on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	if *tlsCert == "" && *tlsKey == "" {
+		if *httpsRedirect {
+			log.Fatal("-https-redirect needs -tls-cert and -tls-key")
+		}
+		// Run the load balancer on port 8080
+		fmt.Println("Load Balancer running on port 8080...")
+		log.Fatal(http.ListenAndServe(":8080", nil))
+	}
+
+	// Terminate TLS on tlsAddr; port 8080 proxies or redirects to it
+	if *tlsCert == "" || *tlsKey == "" {
+		log.Fatal("-tls-cert and -tls-key must be given together")
+	}
+	tlsServer, err := newTLSServer(*tlsAddr, *tlsCert, *tlsKey, http.DefaultServeMux)
+	if err != nil {
+		log.Fatalf("Loading TLS certificate: %v", err)
+	}
+	var plainHandler http.Handler = http.DefaultServeMux
+	if *httpsRedirect {
+		plainHandler = redirectToHTTPS(*tlsAddr)
+	}
+	go func() {
+		log.Fatal(http.ListenAndServe(":8080", plainHandler))
+	}()
+	fmt.Printf("Load Balancer running on port 8080 and with TLS on %s...\n", *tlsAddr)
+	log.Fatal(tlsServer.ListenAndServeTLS("", ""))
 }
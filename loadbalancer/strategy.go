@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+*
+Strategy: Decides which backend server of a pool handles a request.
+Select returns "" when the strategy has no servers to choose from.
+*/
+type Strategy interface {
+	Select(r *http.Request) string
+}
+
+/*
+*
+RoundRobin: Hands out the servers one after another, wrapping around at the end
+of the list. The index is guarded by a Mutex because requests are served
+concurrently.
+*/
+type RoundRobin struct {
+	servers []string
+	mu      sync.Mutex
+	index   int
+}
+
+func NewRoundRobin(servers []string) *RoundRobin {
+	return &RoundRobin{servers: servers}
+}
+
+func (rr *RoundRobin) Select(r *http.Request) string {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	if len(rr.servers) == 0 {
+		return ""
+	}
+	server := rr.servers[rr.index]
+	rr.index = (rr.index + 1) % len(rr.servers) // Round-robin logic
+	return server
+}
+
+/*
+*
+KeyFunc: Extracts the hash key from a request. Requests with the same key are
+always sent to the same backend by the consistent-hashing strategy.
+*/
+type KeyFunc func(r *http.Request) string
+
+/*
+*
+ParseKeySource: Builds a KeyFunc from a flag value:
+
+path:          the request path (e.g. "/api/users/42")
+header:<Name>: the value of a request header (e.g. "header:X-User-ID")
+query:<name>:  the value of a query parameter (e.g. "query:session")
+ip:            the client IP address
+
+When a header or query parameter is missing, the client IP is used instead,
+so such requests are still spread over the ring but stay sticky per client.
+*/
+func ParseKeySource(source string) (KeyFunc, error) {
+	kind, name, _ := strings.Cut(source, ":")
+	switch kind {
+	case "path":
+		return func(r *http.Request) string { return r.URL.Path }, nil
+	case "ip":
+		return clientIP, nil
+	case "header":
+		if name == "" {
+			return nil, fmt.Errorf("key source %q needs a header name", source)
+		}
+		return func(r *http.Request) string {
+			if v := r.Header.Get(name); v != "" {
+				return v
+			}
+			return clientIP(r)
+		}, nil
+	case "query":
+		if name == "" {
+			return nil, fmt.Errorf("key source %q needs a parameter name", source)
+		}
+		return func(r *http.Request) string {
+			if v := r.URL.Query().Get(name); v != "" {
+				return v
+			}
+			return clientIP(r)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown key source %q (use path, ip, header:<name> or query:<name>)", source)
+}
+
+// clientIP returns the host part of the request's remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+/*
+*
+HashRing: A consistent-hashing strategy. Every server is placed on a ring of
+32-bit hashes at several points ("virtual nodes"), and a request goes to the
+first server found clockwise from the hash of its key.
+
+Adding or removing a server only moves the keys that land next to that server's
+points; keys owned by the other servers keep their backend, so per-key caches
+on the backends stay warm while the pool changes size. The virtual nodes spread
+each server around the ring so the load stays roughly even.
+*/
+type HashRing struct {
+	mu       sync.RWMutex
+	replicas int
+	keyFunc  KeyFunc
+	hashes   []uint32          // sorted points on the ring
+	owners   map[uint32]string // point -> server
+}
+
+// defaultReplicas is the number of virtual nodes per server
+const defaultReplicas = 100
+
+func NewHashRing(servers []string, replicas int, keyFunc KeyFunc) *HashRing {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	ring := &HashRing{replicas: replicas, keyFunc: keyFunc, owners: make(map[uint32]string)}
+	for _, server := range servers {
+		ring.Add(server)
+	}
+	return ring
+}
+
+// Add places a server on the ring
+func (h *HashRing) Add(server string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := 0; i < h.replicas; i++ {
+		point := hashKey(server + "#" + strconv.Itoa(i))
+		if _, taken := h.owners[point]; taken {
+			continue // extremely rare collision, keep the first owner
+		}
+		h.owners[point] = server
+		h.hashes = append(h.hashes, point)
+	}
+	sort.Slice(h.hashes, func(i, j int) bool { return h.hashes[i] < h.hashes[j] })
+}
+
+// Remove takes a server off the ring; its keys move to the next servers clockwise
+func (h *HashRing) Remove(server string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	kept := h.hashes[:0]
+	for _, point := range h.hashes {
+		if h.owners[point] == server {
+			delete(h.owners, point)
+			continue
+		}
+		kept = append(kept, point)
+	}
+	h.hashes = kept
+}
+
+// Get returns the server that owns key
+func (h *HashRing) Get(key string) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.hashes) == 0 {
+		return ""
+	}
+	point := hashKey(key)
+	i := sort.Search(len(h.hashes), func(i int) bool { return h.hashes[i] >= point })
+	if i == len(h.hashes) {
+		i = 0 // wrap around the ring
+	}
+	return h.owners[h.hashes[i]]
+}
+
+func (h *HashRing) Select(r *http.Request) string {
+	return h.Get(h.keyFunc(r))
+}
+
+// hashKey maps a key onto the ring. MD5 (as in ketama) is used for its even
+// spread over similar keys, not for security.
+func hashKey(key string) uint32 {
+	sum := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+/*
+*
+NewStrategy: Builds the strategy named on the command line for a list of servers.
+keySource is only used by "consistent-hash".
+*/
+func NewStrategy(name, keySource string, servers []string) (Strategy, error) {
+	switch name {
+	case "round-robin":
+		return NewRoundRobin(servers), nil
+	case "consistent-hash":
+		keyFunc, err := ParseKeySource(keySource)
+		if err != nil {
+			return nil, err
+		}
+		return NewHashRing(servers, defaultReplicas, keyFunc), nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q (use round-robin or consistent-hash)", name)
+}
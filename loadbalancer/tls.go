@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+)
+
+/*
+*
+TLS termination:
+With -tls-cert and -tls-key the load balancer also listens for HTTPS on
+-tls-addr. TLS ends here: backends keep receiving plain HTTP, with the
+X-Forwarded-Proto header telling them which scheme the client used.
+
+The plain HTTP listener on :8080 keeps proxying as before, unless
+-https-redirect is set, in which case it answers every request with a
+308 Permanent Redirect to the same URL over HTTPS.
+*/
+func newTLSServer(addr, certFile, keyFile string, handler http.Handler) (*http.Server, error) {
+	// Load the pair up front so a bad path fails at startup
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Server{
+		Addr:    addr,
+		Handler: handler,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		},
+	}, nil
+}
+
+// redirectToHTTPS sends clients to the same host and path on the HTTPS listener
+func redirectToHTTPS(tlsAddr string) http.Handler {
+	_, tlsPort, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]") // IPv6 literal without a port
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+// forwardedProto returns the scheme the client used to reach the load balancer
+func forwardedProto(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"regexp"
@@ -23,6 +24,29 @@ location or does not contain a value.
 */
 
 func main() {
+	/**
+	-group-field is a regular expression used to pull an ID (such as a request ID)
+	out of each message, e.g. -group-field 'request_id=(\S+)'.
+	The first capture group is used as the ID; without a group the whole match is used.
+	*/
+	groupField := flag.String("group-field", "", "Regex whose first capture group extracts an ID to group entries by")
+	noColor := flag.Bool("no-color", false, "Disable colored output")
+	serve := flag.String("serve", "", "Serve a web page to browse the parsed entries on this address, e.g. :8080, instead of printing the analysis")
+	flag.Parse()
+
+	// Only color when writing to a terminal, so redirected output stays plain
+	useColor = !*noColor && isTerminal(os.Stdout)
+
+	var groupRegex *regexp.Regexp
+	if *groupField != "" {
+		var err error
+		groupRegex, err = regexp.Compile(*groupField)
+		if err != nil {
+			fmt.Printf("Invalid -group-field regex: %v\n", err)
+			return
+		}
+	}
+
 	// Open the log file
 	file, err := os.Open("sample.log")
 	/**
@@ -46,8 +70,21 @@ func main() {
 		return
 	}
 
+	// Browse the entries in a web page instead of printing them
+	if *serve != "" {
+		if err := serveLogs(*serve, file.Name(), logEntries); err != nil {
+			fmt.Printf("Error serving web UI: %v\n", err)
+		}
+		return
+	}
+
 	// Analyze the logs
 	analyzeLogs(logEntries)
+
+	// Reconstruct per-ID timelines if requested
+	if groupRegex != nil {
+		reportGroups(groupLogs(logEntries, groupRegex))
+	}
 }
 
 // parseLogFile reads and parses the log file into structured log entries
@@ -118,6 +155,41 @@ func parseLogFile(file *os.File) ([]LogEntry, error) {
 	return logEntries, nil
 }
 
+/*
+*
+ANSI color codes wrap text in escape sequences that terminals render as
+colors, e.g. "\033[31m" starts red and "\033[0m" resets back to normal.
+Files and pipes would receive the raw escape characters, so colors are only
+used when stdout is a terminal and -no-color was not given.
+*/
+var useColor bool
+
+var levelColors = map[string]string{
+	"ERROR": "\033[31m", // red
+	"FATAL": "\033[31m", // red
+	"WARN":  "\033[33m", // yellow
+	"INFO":  "\033[32m", // green
+	"DEBUG": "\033[36m", // cyan
+}
+
+const colorReset = "\033[0m"
+
+// isTerminal reports whether f is an interactive terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps text in the color for level, or returns it unchanged when
+// colors are off or the level has no color
+func colorize(level, text string) string {
+	color, ok := levelColors[strings.ToUpper(level)]
+	if !useColor || !ok {
+		return text
+	}
+	return color + text + colorReset
+}
+
 // analyzeLogs performs basic analysis on the parsed logs
 func analyzeLogs(logEntries []LogEntry) {
 	// Count log levels
@@ -133,22 +205,100 @@ func analyzeLogs(logEntries []LogEntry) {
 	entry.Level refers to the Level field of the current LogEntry object.
 	The Level field should contain a string value, such as "INFO", "ERROR", etc.
 	*/
-	levelCount := make(map[string]int)
-	for _, entry := range logEntries {
-		levelCount[entry.Level]++
-	}
+	levelCount := countLevels(logEntries)
 
 	// Print analysis
 	fmt.Println("Log Level Summary:")
 	for level, count := range levelCount {
-		fmt.Printf("  %s: %d\n", strings.ToUpper(level), count)
+		fmt.Printf("  %s: %d\n", colorize(level, strings.ToUpper(level)), count)
 	}
 
 	// Find error messages
 	fmt.Println("\nError Messages:")
 	for _, entry := range logEntries {
 		if entry.Level == "ERROR" {
-			fmt.Printf("  [%s] %s\n", entry.Timestamp, entry.Message)
+			fmt.Printf("  [%s] %s\n", entry.Timestamp, colorize(entry.Level, entry.Message))
+		}
+	}
+}
+
+// countLevels counts the entries of each log level, as used by the summary
+func countLevels(logEntries []LogEntry) map[string]int {
+	levelCount := make(map[string]int)
+	for _, entry := range logEntries {
+		levelCount[entry.Level]++
+	}
+	return levelCount
+}
+
+// LogGroup holds every entry that shares the same extracted ID, in file order
+type LogGroup struct {
+	ID       string
+	Entries  []LogEntry
+	HasError bool
+}
+
+/*
+*
+groupLogs extracts an ID from each entry's message using re and collects
+entries with the same ID together. Entries without a match are skipped.
+Groups are returned in the order their ID first appeared.
+*/
+func groupLogs(logEntries []LogEntry, re *regexp.Regexp) []*LogGroup {
+	var groups []*LogGroup
+	byID := make(map[string]*LogGroup)
+
+	for _, entry := range logEntries {
+		matches := re.FindStringSubmatch(entry.Message)
+		if matches == nil {
+			continue
+		}
+
+		// Prefer the first capture group, fall back to the whole match
+		id := matches[0]
+		if len(matches) > 1 {
+			id = matches[1]
+		}
+
+		group, exists := byID[id]
+		if !exists {
+			group = &LogGroup{ID: id}
+			byID[id] = group
+			groups = append(groups, group)
+		}
+		group.Entries = append(group.Entries, entry)
+		if entry.Level == "ERROR" {
+			group.HasError = true
+		}
+	}
+
+	return groups
+}
+
+// reportGroups prints groups containing an ERROR first, then the rest
+func reportGroups(groups []*LogGroup) {
+	printGroup := func(group *LogGroup) {
+		header := fmt.Sprintf("%s (%d entries)", group.ID, len(group.Entries))
+		if group.HasError {
+			header = colorize("ERROR", header)
+		}
+		fmt.Printf("  %s\n", header)
+		for _, entry := range group.Entries {
+			fmt.Printf("    [%s] %s %s\n", entry.Timestamp, colorize(entry.Level, entry.Level), entry.Message)
+		}
+	}
+
+	fmt.Println("\nGroups With Errors:")
+	for _, group := range groups {
+		if group.HasError {
+			printGroup(group)
+		}
+	}
+
+	fmt.Println("\nOther Groups:")
+	for _, group := range groups {
+		if !group.HasError {
+			printGroup(group)
 		}
 	}
 }
@@ -0,0 +1,159 @@
+package main
+
+/**
+Web UI:
+With -serve (e.g. -serve :8080) the parsed entries are served as a web page
+instead of being printed. The page shows the level summary and a table of
+entries that can be narrowed down with a form:
+
+level: only entries of this level
+from, to: only entries whose timestamp falls in this range. Timestamps are
+compared as text, which orders correctly for the usual
+"2006-01-02 15:04:05" format; a prefix such as "2024-05-01 12" works too.
+q: only entries whose message contains this text (case-insensitive)
+
+The filters are plain query parameters, so a filtered view can be bookmarked
+or shared, e.g. /?level=ERROR&q=timeout. The file is parsed once at startup.
+*/
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxShownEntries caps the table so a huge log does not produce a huge page
+const maxShownEntries = 5000
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Log entries: {{.File}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; vertical-align: top; }
+td.message { font-family: monospace; white-space: pre-wrap; }
+.ERROR, .FATAL { color: #c00; }
+.WARN { color: #b60; }
+.INFO { color: #080; }
+.DEBUG { color: #088; }
+form input, form select { margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.File}}</h1>
+<h2>Log Level Summary</h2>
+<p>{{range .Levels}}<a class="{{.Level}}" href="?level={{.Level}}">{{.Level}}</a>: {{.Count}} &nbsp; {{end}}</p>
+
+<form method="get">
+<label>Level <select name="level">
+<option value="">all</option>
+{{range .Levels}}<option{{if eq .Level $.Filter.Level}} selected{{end}}>{{.Level}}</option>
+{{end}}</select></label>
+<label>From <input name="from" value="{{.Filter.From}}" placeholder="2024-05-01 12:00"></label>
+<label>To <input name="to" value="{{.Filter.To}}" placeholder="2024-05-01 13:00"></label>
+<label>Text <input name="q" value="{{.Filter.Text}}"></label>
+<button type="submit">Filter</button> <a href="?">Reset</a>
+</form>
+
+<p>{{.Matched}} of {{.Total}} entries match{{if .Truncated}}, showing the first {{len .Entries}}{{end}}.</p>
+<table>
+<tr><th>Timestamp</th><th>Level</th><th>Message</th></tr>
+{{range .Entries}}<tr><td>{{.Timestamp}}</td><td class="{{.Level}}">{{.Level}}</td><td class="message">{{.Message}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// entryFilter holds the filters taken from the query string
+type entryFilter struct {
+	Level, From, To, Text string
+}
+
+func (f entryFilter) matches(entry LogEntry) bool {
+	if f.Level != "" && !strings.EqualFold(entry.Level, f.Level) {
+		return false
+	}
+	if f.From != "" && entry.Timestamp < f.From {
+		return false
+	}
+	// Compare only as much of the timestamp as "to" gives, so the range includes it
+	if f.To != "" && entry.Timestamp[:min(len(entry.Timestamp), len(f.To))] > f.To {
+		return false
+	}
+	if f.Text != "" && !strings.Contains(strings.ToLower(entry.Message), strings.ToLower(f.Text)) {
+		return false
+	}
+	return true
+}
+
+type levelTotal struct {
+	Level string
+	Count int
+}
+
+// serveLogs serves the web UI for the parsed entries on addr
+func serveLogs(addr, file string, logEntries []LogEntry) error {
+	// The summary never changes, so compute it once, sorted by level name
+	var levels []levelTotal
+	for level, count := range countLevels(logEntries) {
+		levels = append(levels, levelTotal{level, count})
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Level < levels[j].Level })
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		filter := entryFilter{
+			Level: query.Get("level"),
+			From:  query.Get("from"),
+			To:    query.Get("to"),
+			Text:  query.Get("q"),
+		}
+
+		var shown []LogEntry
+		matched := 0
+		for _, entry := range logEntries {
+			if !filter.matches(entry) {
+				continue
+			}
+			matched++
+			if len(shown) < maxShownEntries {
+				shown = append(shown, entry)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := pageTemplate.Execute(w, map[string]interface{}{
+			"File":      file,
+			"Levels":    levels,
+			"Filter":    filter,
+			"Entries":   shown,
+			"Matched":   matched,
+			"Total":     len(logEntries),
+			"Truncated": matched > len(shown),
+		})
+		if err != nil {
+			log.Printf("Error rendering page: %v", err)
+		}
+	})
+
+	fmt.Printf("Serving %d entries from %s on http://%s/\n", len(logEntries), file, displayAddr(addr))
+	return http.ListenAndServe(addr, nil)
+}
+
+// displayAddr turns ":8080" into "localhost:8080" for the startup message
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
@@ -0,0 +1,78 @@
+package main
+
+/**
+Container checks:
+A pod's phase says little about its containers: a pod stays Running while a
+container crash-loops, and Pending while its image cannot be pulled. Every
+pod event is therefore compared container by container with the pod's
+previous event:
+
+restarts: a RestartCount that grew prints a warning with the new count and
+          the reason of the last exit.
+waiting:  a container that enters a waiting reason listed in -alert-reasons
+          (by default CrashLoopBackOff, ImagePullBackOff and ErrImagePull)
+          prints an alert with the reason and message. It is alerted once
+          per episode, not on every event while it stays in that state.
+
+The state is kept per pod UID, so a pod recreated under the same name starts
+fresh. The first event of a pod records its restart counts without warning,
+but already reports stuck containers. A deleted pod's state is dropped.
+Restart counts are also passed to the /metrics endpoint (see prometheus.go).
+*/
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// containerSnapshot is what was last seen of a container
+type containerSnapshot struct {
+	restarts int32
+	waiting  string // State.Waiting.Reason, "" when not waiting
+}
+
+// parseReasons splits the -alert-reasons flag into a set
+func parseReasons(value string) map[string]bool {
+	reasons := make(map[string]bool)
+	for _, reason := range strings.Split(value, ",") {
+		if reason = strings.TrimSpace(reason); reason != "" {
+			reasons[reason] = true
+		}
+	}
+	return reasons
+}
+
+// checkContainers reports restarted and stuck containers of the pod
+func (m *podMonitor) checkContainers(eventType watch.EventType, pod *v1.Pod) {
+	if eventType == watch.Deleted {
+		delete(m.containers, pod.UID)
+		m.stats.forgetPod(pod.Namespace, pod.Name)
+		return
+	}
+
+	previous, seen := m.containers[pod.UID]
+	current := make(map[string]containerSnapshot, len(pod.Status.ContainerStatuses))
+	for _, status := range pod.Status.ContainerStatuses {
+		snapshot := containerSnapshot{restarts: status.RestartCount}
+		if status.State.Waiting != nil {
+			snapshot.waiting = status.State.Waiting.Reason
+		}
+		current[status.Name] = snapshot
+
+		before := previous[status.Name]
+		increased := int32(0)
+		if seen && snapshot.restarts > before.restarts {
+			increased = snapshot.restarts - before.restarts
+			m.reportRestart(pod, status)
+		}
+		m.stats.setRestarts(pod.Namespace, pod.Name, status.Name, snapshot.restarts, increased)
+		if m.alertReasons[snapshot.waiting] && snapshot.waiting != before.waiting {
+			m.reportAlert(pod, status.Name, status.State.Waiting)
+			m.notify(":warning: [%s] Container %s in pod %s is %s: %s",
+				pod.Namespace, status.Name, pod.Name, snapshot.waiting, status.State.Waiting.Message)
+		}
+	}
+	m.containers[pod.UID] = current
+}
@@ -0,0 +1,130 @@
+package main
+
+/**
+Dashboard mode:
+With -dashboard the scrolling event log is replaced by a table of every pod
+currently known, redrawn in place after each event and every
+dashboardRefresh so the ages keep counting:
+
+	NAMESPACE  NAME      PHASE    RESTARTS  AGE
+	default    web-7c9f  Running  0         3h
+	default    worker-1  Pending  2         45s
+
+The screen is cleared with ANSI escape codes, so this only works on a
+terminal; when stdout is redirected to a file or pipe the monitor warns and
+prints the normal event log instead. Exports, hooks, Slack and metrics are
+not affected. The dashboard shows pods only.
+*/
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const dashboardRefresh = 5 * time.Second
+
+// dashboard keeps the latest version of each pod; the event loop updates it
+// while the refresh ticker redraws it, hence the mutex
+type dashboard struct {
+	title string
+
+	mu   sync.Mutex
+	pods map[types.UID]*v1.Pod
+}
+
+func newDashboard(title string) *dashboard {
+	return &dashboard{title: title, pods: make(map[types.UID]*v1.Pod)}
+}
+
+// isTerminal reports whether f is an interactive terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update applies a pod event and redraws the table
+func (d *dashboard) update(eventType watch.EventType, pod *v1.Pod) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if eventType == watch.Deleted {
+		delete(d.pods, pod.UID)
+	} else {
+		d.pods[pod.UID] = pod
+	}
+	d.draw()
+}
+
+// run redraws the table every dashboardRefresh until the context is canceled
+func (d *dashboard) run(ctx context.Context) {
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.mu.Lock()
+			d.draw()
+			d.mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// draw clears the screen and prints the table; d.mu must be held
+func (d *dashboard) draw() {
+	pods := make([]*v1.Pod, 0, len(d.pods))
+	for _, pod := range d.pods {
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+
+	var b strings.Builder
+	// Move the cursor home and clear the screen
+	b.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&b, "%s: %d pods, updated %s\n\n", d.title, len(pods), time.Now().Format("15:04:05"))
+
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tPHASE\tRESTARTS\tAGE")
+	for _, pod := range pods {
+		var restarts int32
+		for _, status := range pod.Status.ContainerStatuses {
+			restarts += status.RestartCount
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", pod.Namespace, pod.Name, pod.Status.Phase, restarts,
+			formatAge(time.Since(pod.CreationTimestamp.Time)))
+	}
+	w.Flush()
+
+	os.Stdout.WriteString(b.String())
+}
+
+// formatAge shortens a duration the way kubectl does, e.g. 45s, 12m, 3h, 2d
+func formatAge(age time.Duration) string {
+	switch {
+	case age < 0:
+		// The node's clock may run slightly ahead of ours
+		return "0s"
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(age.Hours()/24))
+}
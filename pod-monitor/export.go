@@ -0,0 +1,137 @@
+package main
+
+/**
+Event export:
+Appends pod events to a file so a window of cluster activity can be analysed
+later (spreadsheets, jq, pandas, ...). Two formats are supported:
+
+csv:   type,kind,name,namespace,phase,timestamp rows. A header row is
+       written when the file is new or empty.
+jsonl: one JSON object per line with the same fields.
+
+Writes go through a buffered writer. Close flushes it and closes the file,
+so it must be called on shutdown to avoid losing the last events.
+
+Event log:
+-event-log is a durable record for post-mortems: the same JSON lines, but
+every line is flushed to the file as soon as it is written, so a crash loses
+nothing. The file is opened with O_APPEND|O_CREATE and never truncated, so
+it keeps growing across restarts. Writes are serialized by a mutex, which
+keeps lines whole even if events are written from several goroutines.
+*/
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// exportedEvent is the record written for every pod event
+type exportedEvent struct {
+	Type      string `json:"type"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Phase     string `json:"phase"`
+	Timestamp string `json:"timestamp"`
+}
+
+type eventExporter struct {
+	mu        sync.Mutex
+	flushEach bool // flush every record (-event-log)
+
+	file   *os.File
+	buf    *bufio.Writer
+	format string
+	csv    *csv.Writer
+}
+
+// newEventLog opens the -event-log file, flushing every event as it is written
+func newEventLog(path string) (*eventExporter, error) {
+	e, err := newEventExporter(path, "jsonl")
+	if err != nil {
+		return nil, err
+	}
+	e.flushEach = true
+	return e, nil
+}
+
+// newEventExporter opens path for appending and prepares a writer for format
+func newEventExporter(path, format string) (*eventExporter, error) {
+	if format != "csv" && format != "jsonl" {
+		return nil, fmt.Errorf("unknown export format %q (use csv or jsonl)", format)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &eventExporter{file: file, buf: bufio.NewWriter(file), format: format}
+	if format == "csv" {
+		e.csv = csv.NewWriter(e.buf)
+
+		// Only write the header when starting a new file
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if info.Size() == 0 {
+			e.csv.Write([]string{"type", "kind", "name", "namespace", "phase", "timestamp"})
+		}
+	}
+	return e, nil
+}
+
+// Write appends one event to the export file. phase holds the pod phase,
+// or a short status summary for other kinds.
+func (e *eventExporter) Write(eventType watch.EventType, kind, namespace, name, phase string) error {
+	record := exportedEvent{
+		Type:      string(eventType),
+		Kind:      kind,
+		Name:      name,
+		Namespace: namespace,
+		Phase:     phase,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.format == "csv" {
+		e.csv.Write([]string{record.Type, record.Kind, record.Name, record.Namespace, record.Phase, record.Timestamp})
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	e.buf.Write(line)
+	if err := e.buf.WriteByte('\n'); err != nil {
+		return err
+	}
+	if e.flushEach {
+		return e.buf.Flush()
+	}
+	return nil
+}
+
+// Close flushes any buffered events and closes the file
+func (e *eventExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.buf.Flush(); err != nil {
+		e.file.Close()
+		return err
+	}
+	return e.file.Close()
+}
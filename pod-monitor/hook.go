@@ -0,0 +1,176 @@
+package main
+
+/**
+Exec hook:
+Runs a local command when a watched pod is deleted or fails, e.g. to scale
+something up or send a notification. The command is a text/template whose
+fields are filled from the event:
+
+	-exec 'notify-send "{{.Name}} in {{.Namespace}} is {{.Status}} ({{.Type}})"'
+
+Fields: .Type (DELETED, FAILED), .Kind, .Namespace, .Name, .Status, .Time.
+The command runs through the shell (sh -c, or cmd /C on Windows).
+
+A burst of events must not spawn hundreds of processes, so:
+
+debounce:    events for the same pod are coalesced; the command runs once,
+             debounce after the last event, with the latest event's fields.
+concurrency: at most maxRunning commands run at the same time; the others
+             wait for a free slot.
+timeout:     a command running longer than timeout is killed.
+
+The output and exit code of every command are logged.
+*/
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// hookEvent holds the fields available to the -exec template
+type hookEvent struct {
+	Type      string
+	Kind      string
+	Namespace string
+	Name      string
+	Status    string
+	Time      time.Time
+}
+
+type execHook struct {
+	command  *template.Template
+	filter   *regexp.Regexp // only pods whose name matches trigger the hook (nil = all)
+	debounce time.Duration
+	timeout  time.Duration
+	slots    chan struct{} // semaphore limiting concurrent commands
+
+	mu      sync.Mutex
+	pending map[string]*pendingHook
+	wg      sync.WaitGroup
+}
+
+// pendingHook is a debounced run waiting for its timer, carrying the latest event
+type pendingHook struct {
+	timer *time.Timer
+	event hookEvent
+}
+
+func newExecHook(command, filter string, debounce, timeout time.Duration, maxRunning int) (*execHook, error) {
+	tmpl, err := template.New("exec").Option("missingkey=error").Parse(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -exec template: %v", err)
+	}
+	hook := &execHook{
+		command:  tmpl,
+		debounce: debounce,
+		timeout:  timeout,
+		pending:  make(map[string]*pendingHook),
+	}
+	if filter != "" {
+		if hook.filter, err = regexp.Compile(filter); err != nil {
+			return nil, fmt.Errorf("invalid -exec-filter: %v", err)
+		}
+	}
+	if maxRunning < 1 {
+		maxRunning = 1
+	}
+	hook.slots = make(chan struct{}, maxRunning)
+	return hook, nil
+}
+
+// Fire schedules the command for the event, restarting the pod's debounce timer
+func (h *execHook) Fire(event hookEvent) {
+	if h.filter != nil && !h.filter.MatchString(event.Name) {
+		return
+	}
+	key := objectKey(event.Kind, event.Namespace, event.Name)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if p, ok := h.pending[key]; ok {
+		// If Stop fails the timer has already fired and its callback is
+		// waiting for the lock; it will pick up the new event without a reset
+		p.event = event
+		if p.timer.Stop() {
+			p.timer.Reset(h.debounce)
+		}
+		return
+	}
+
+	p := &pendingHook{event: event}
+	h.wg.Add(1)
+	p.timer = time.AfterFunc(h.debounce, func() {
+		defer h.wg.Done()
+		h.mu.Lock()
+		event := p.event
+		delete(h.pending, key)
+		h.mu.Unlock()
+		h.run(event)
+	})
+	h.pending[key] = p
+}
+
+// run renders and executes the command once a concurrency slot is free
+func (h *execHook) run(event hookEvent) {
+	var command bytes.Buffer
+	if err := h.command.Execute(&command, event); err != nil {
+		log.Printf("exec hook: rendering command for %s: %v", event.Name, err)
+		return
+	}
+
+	h.slots <- struct{}{}
+	defer func() { <-h.slots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command.String())
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command.String())
+	}
+
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Printf("exec hook: %q for %s timed out after %s", command.String(), event.Name, h.timeout)
+		exitCode = -1
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case err != nil:
+		log.Printf("exec hook: %q for %s could not run: %v", command.String(), event.Name, err)
+		return
+	}
+
+	log.Printf("exec hook: %q for %s %s exited with %d in %s", command.String(), event.Type, event.Name, exitCode, time.Since(start).Round(time.Millisecond))
+	if len(output) > 0 {
+		log.Printf("exec hook output:\n%s", bytes.TrimRight(output, "\n"))
+	}
+}
+
+// Wait runs the debounced commands right away and blocks until every command
+// has finished, so no hook is lost on shutdown.
+func (h *execHook) Wait() {
+	h.mu.Lock()
+	for _, p := range h.pending {
+		if p.timer.Stop() {
+			p.timer.Reset(0)
+		}
+	}
+	h.mu.Unlock()
+	h.wg.Wait()
+}
@@ -99,12 +99,21 @@ core/v1 group.
 Here, it is used to import the Pod type (v1.Pod), which represents the
 Kubernetes pod resource that we are monitoring.
 
+appsv1 "k8s.io/api/apps/v1":
+This package contains the apps/v1 API types. It provides the Deployment type
+(appsv1.Deployment) used when watching deployments with -resource deployments.
+
 metav1 "k8s.io/apimachinery/pkg/apis/meta/v1":
 The metav1 package includes metadata-related APIs in Kubernetes, which
 are used across most Kubernetes resources.
 In this case, it is used to pass metav1.ListOptions{} when watching pods,
 defining options related to the pod listing, such as filters.
 
+labels "k8s.io/apimachinery/pkg/labels":
+The labels package parses label selectors such as app=nginx. It is used to
+check the -selector flag at startup, so an invalid selector is reported
+clearly instead of failing once the watch has started.
+
 watch "k8s.io/apimachinery/pkg/watch":
 The watch package allows the program to watch for changes (events) to
 Kubernetes resources.
@@ -124,19 +133,33 @@ typically from a kubeconfig file.
 It is used here to read the kubeconfig file (provided by the user via the -kubeconfig flag)
 and create a config object that is used to authenticate and communicate
 with the Kubernetes API server.
+
+rest "k8s.io/client-go/rest":
+The rest package holds the client configuration type (rest.Config).
+rest.InClusterConfig() builds one from the service account token that
+Kubernetes mounts into every pod, so no kubeconfig is needed when the
+monitor runs inside the cluster.
 */
 import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -148,28 +171,185 @@ kubeconfig: Specifies the path to the kubeconfig file that provides the
 necessary information to connect to a Kubernetes cluster.
 Default is "C:/Users/ethan/.kube/config".
 
-namespace: Defines the Kubernetes namespace in which to monitor pods.
-The default namespace is default.
+in-cluster: By default the in-cluster service account is tried first and the
+kubeconfig is used only if that fails. -in-cluster forces the service account,
+-in-cluster=false forces the kubeconfig.
+
+namespace: Defines the Kubernetes namespaces in which to monitor pods, as a
+comma-separated list (e.g. team-a,team-b). An empty value watches all
+namespaces. The default namespace is default.
+
+resource: Selects what to watch: pods (default), deployments or services, or
+a comma-separated list such as pods,deployments to watch several kinds at once.
+
+selector: A label selector (e.g. app=nginx or "tier in (web,api)") passed to
+the watch as ListOptions.LabelSelector, so only matching objects are reported.
+It is parsed at startup so a typo is reported before anything is watched.
+
+phases: Only prints Modified pod events whose phase is in this comma-separated
+list (e.g. Pending,Failed,Unknown), to hide healthy Running pods. Added and
+Deleted events are still printed unless -phases-all-events is set too. An
+empty value means all phases. Export, hooks and notifications are not
+filtered.
+
+verbose: Reports every Modified event. By default only Modified events that
+change the pod's phase (e.g. Pending -> Running) are printed.
+
+export-file / export-format: Appends every received event to a file as CSV
+rows or JSON lines, alongside the normal console output.
+
+event-log: Appends every received event to a file as JSON lines with a
+timestamp, flushing each one, as a durable record for post-mortems. The
+file is appended to across restarts (see export.go).
+
+exec / exec-filter / exec-debounce / exec-timeout / exec-max-running: Runs a
+command template when a pod whose name matches exec-filter is deleted or
+fails (see hook.go).
+
+output: text (default) prints readable lines; json prints each pod event as
+a JSON object per line and moves status messages to stderr (see output.go).
+
+alert-reasons: Container waiting reasons (State.Waiting.Reason) that print
+an alert, e.g. CrashLoopBackOff. They leave the pod's phase unchanged, so
+they would otherwise go unnoticed. An empty value turns the alerts off.
+
+slack-webhook: Posts deleted and failing pods to a Slack incoming webhook,
+batched into at most one message every 5 seconds (see slack.go).
+
+metrics-addr: Serves Prometheus metrics (pod event counters and container
+restart counts) at /metrics on this address (see prometheus.go).
+
+with-metrics: Adds each reported pod's CPU and memory usage from
+metrics-server to the output (see metrics.go).
 
 The flag.Parse() reads and processes the flags from the command line.
 */
 func main() {
 	// Parse kubeconfig flag
 	kubeconfig := flag.String("kubeconfig", "C:/Users/ethan/.kube/config", "Path to the kubeconfig file")
-	namespace := flag.String("namespace", "default", "Namespace to monitor pods in")
+	inCluster := flag.Bool("in-cluster", false, "Force in-cluster credentials (true) or the kubeconfig (false); by default in-cluster is tried first")
+	namespace := flag.String("namespace", "default", "Comma-separated namespaces to monitor (empty = all namespaces)")
+	resource := flag.String("resource", "pods", "Resources to watch, comma-separated: pods, deployments, services")
+	selector := flag.String("selector", "", "Label selector to filter watched objects, e.g. app=nginx")
+	phases := flag.String("phases", "", "Comma-separated pod phases whose Modified events are printed, e.g. Pending,Failed,Unknown (empty = all phases)")
+	phasesAll := flag.Bool("phases-all-events", false, "Apply -phases to Added and Deleted events as well")
+	verbose := flag.Bool("verbose", false, "Report every Modified event, not only phase changes")
+	exportFile := flag.String("export-file", "", "Append every event to this file")
+	eventLog := flag.String("event-log", "", "Append every event to this file as JSON lines, flushed immediately")
+	exportFormat := flag.String("export-format", "csv", "Format for -export-file: csv or jsonl")
+	execCommand := flag.String("exec", "", "Command template to run when a pod is deleted or fails, e.g. 'echo {{.Name}} {{.Type}}'")
+	execFilter := flag.String("exec-filter", "", "Regular expression a pod name must match to trigger -exec (default: all pods)")
+	execDebounce := flag.Duration("exec-debounce", 5*time.Second, "Quiet period after a pod's last event before -exec runs")
+	execTimeout := flag.Duration("exec-timeout", 30*time.Second, "Maximum run time of an -exec command")
+	execMaxRunning := flag.Int("exec-max-running", 4, "Maximum number of -exec commands running at once")
+	output := flag.String("output", "text", "Event output format: text or json (pods only)")
+	alertReasons := flag.String("alert-reasons", "CrashLoopBackOff,ImagePullBackOff,ErrImagePull", "Comma-separated container waiting reasons that print an alert")
+	slackWebhook := flag.String("slack-webhook", "", "Slack incoming webhook URL to notify about deleted and failing pods")
+	metricsAddr := flag.String("metrics-addr", "", "Address to serve Prometheus metrics on, e.g. :9090 (empty = disabled)")
+	withMetrics := flag.Bool("with-metrics", false, "Show CPU and memory usage of reported pods (needs metrics-server)")
+	dashboardMode := flag.Bool("dashboard", false, "Show a table of current pods redrawn in place instead of the event log (terminals only)")
 	flag.Parse()
 
-	// Build config from kubeconfig path
+	// Validate the label selector before connecting to the cluster
+	labelSelector, err := labels.Parse(*selector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -selector %q: %v\n", *selector, err)
+		os.Exit(2)
+	}
+	resources, err := parseResources(*resource)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -resource: %v\n", err)
+		os.Exit(2)
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid -output %q: use text or json\n", *output)
+		os.Exit(2)
+	}
+	if *output == "json" {
+		if len(resources) != 1 || resources[0] != "pods" {
+			fmt.Fprintf(os.Stderr, "-output json is only supported for -resource pods\n")
+			os.Exit(2)
+		}
+		statusOut = os.Stderr
+	}
+	if *dashboardMode {
+		if len(resources) != 1 || resources[0] != "pods" || *output == "json" {
+			fmt.Fprintf(os.Stderr, "-dashboard is only supported for -resource pods with -output text\n")
+			os.Exit(2)
+		}
+		if !isTerminal(os.Stdout) {
+			fmt.Fprintf(os.Stderr, "stdout is not a terminal, printing the event log instead of the dashboard\n")
+			*dashboardMode = false
+		}
+	}
+
+	phaseFilter, err := parsePhases(*phases)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -phases: %v\n", err)
+		os.Exit(2)
+	}
+
+	listOptions := metav1.ListOptions{LabelSelector: labelSelector.String(), AllowWatchBookmarks: true}
+
+	// Remember whether -in-cluster was given, since its default means "auto"
+	inClusterSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "in-cluster" {
+			inClusterSet = true
+		}
+	})
+
+	monitor := &podMonitor{
+		tracker:      newStateTracker(),
+		containers:   make(map[types.UID]map[string]containerSnapshot),
+		verbose:      *verbose,
+		phases:       phaseFilter,
+		phasesAll:    *phasesAll,
+		jsonOutput:   *output == "json",
+		alertReasons: parseReasons(*alertReasons),
+		stats:        newMonitorStats(),
+	}
+
+	// Open the export file before connecting so a bad path fails early
+	if *exportFile != "" {
+		exporter, err := newEventExporter(*exportFile, *exportFormat)
+		if err != nil {
+			panic(fmt.Errorf("error opening export file: %v", err))
+		}
+		defer exporter.Close()
+		monitor.exporter = exporter
+	}
+	if *eventLog != "" {
+		eventLogger, err := newEventLog(*eventLog)
+		if err != nil {
+			panic(fmt.Errorf("error opening event log: %v", err))
+		}
+		defer eventLogger.Close()
+		monitor.eventLog = eventLogger
+	}
+
+	if *execCommand != "" {
+		hook, err := newExecHook(*execCommand, *execFilter, *execDebounce, *execTimeout, *execMaxRunning)
+		if err != nil {
+			panic(err)
+		}
+		defer hook.Wait()
+		monitor.hook = hook
+	}
+
+	// Build config from the in-cluster service account or the kubeconfig path
 	/**
-	Config Creation: The clientcmd.BuildConfigFromFlags() function creates the
-	Kubernetes client configuration (config) from the kubeconfig file.
+	Config Creation: loadConfig() creates the Kubernetes client configuration
+	(config), either from the pod's service account (rest.InClusterConfig) or
+	from the kubeconfig file (clientcmd.BuildConfigFromFlags).
 	This config contains connection details like the cluster API endpoint,
 	authentication credentials, and more.
 	*/
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	config, source, err := loadConfig(*kubeconfig, *inCluster, inClusterSet)
 	if err != nil {
-		panic(fmt.Errorf("error building kubeconfig: %v", err))
+		panic(err)
 	}
+	statusf("Using Kubernetes credentials from %s\n", source)
 
 	// Create a clientset
 	/**
@@ -191,10 +371,37 @@ func main() {
 	defer cancel() ensures that the cancel() function is called when the main
 	function finishes, cleaning up resources.
 	*/
-	fmt.Printf("Starting to monitor pods in namespace: %s\n", *namespace)
+	namespaces := parseNamespaces(*namespace)
+	statusf("Starting to monitor %s in %s\n", strings.Join(resources, ", "), describeNamespaces(namespaces))
+	if !labelSelector.Empty() {
+		statusf("Only reporting %s matching selector: %s\n", strings.Join(resources, ", "), labelSelector)
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// The dashboard shows no usage, so there is nothing to fetch for it
+	if *withMetrics && !*dashboardMode {
+		if monitor.metrics = newMetricsClient(ctx, clientset, namespaces); monitor.metrics != nil {
+			go monitor.metrics.run(ctx)
+		}
+	}
+	if *metricsAddr != "" {
+		go serveMetrics(ctx, *metricsAddr, monitor.stats)
+	}
+	if *dashboardMode {
+		monitor.dashboard = newDashboard("pod-monitor (" + describeNamespaces(namespaces) + ")")
+		go monitor.dashboard.run(ctx)
+	}
+	if *slackWebhook != "" {
+		monitor.slack = newSlackNotifier(*slackWebhook)
+		go monitor.slack.run(ctx)
+		// Send the last batch before exiting
+		defer func() {
+			cancel()
+			monitor.slack.Wait()
+		}()
+	}
+
 	// Handle graceful shutdown
 	/**
 	Graceful Shutdown Handling: A goroutine (go handleShutdown(cancel))
@@ -205,77 +412,422 @@ func main() {
 	go handleShutdown(cancel)
 
 	/**
-	The watchPods() function is called to start watching pod events
-	in the specified namespace.
+	The watchResources() function is called to start watching events for
+	the selected resources in the specified namespaces.
 	*/
-	watchPods(ctx, clientset, *namespace)
+	watchResources(ctx, clientset, resources, namespaces, listOptions, monitor)
+}
+
+// podPhases lists the valid values for -phases
+var podPhases = []v1.PodPhase{v1.PodPending, v1.PodRunning, v1.PodSucceeded, v1.PodFailed, v1.PodUnknown}
+
+// parsePhases turns the -phases flag into a set, accepting any letter case.
+// An empty flag yields nil, which shows every phase.
+func parsePhases(value string) (map[v1.PodPhase]bool, error) {
+	var phases map[v1.PodPhase]bool
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, phase := range podPhases {
+			if strings.EqualFold(name, string(phase)) {
+				if phases == nil {
+					phases = make(map[v1.PodPhase]bool)
+				}
+				phases[phase] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown pod phase %q (use Pending, Running, Succeeded, Failed or Unknown)", name)
+		}
+	}
+	return phases, nil
+}
+
+// parseNamespaces splits the -namespace flag. An empty flag yields a single
+// "" entry, which the Kubernetes API treats as all namespaces
+// (metav1.NamespaceAll).
+func parseNamespaces(value string) []string {
+	var namespaces []string
+	seen := make(map[string]bool)
+	for _, ns := range strings.Split(value, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+	if len(namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return namespaces
+}
+
+func describeNamespaces(namespaces []string) string {
+	if len(namespaces) == 1 && namespaces[0] == metav1.NamespaceAll {
+		return "all namespaces"
+	}
+	if len(namespaces) == 1 {
+		return "namespace: " + namespaces[0]
+	}
+	return "namespaces: " + strings.Join(namespaces, ", ")
 }
 
 /*
 *
-Watcher Creation: clientset.CoreV1().Pods(namespace).Watch(ctx, metav1.ListOptions{}) creates a watcher that listens for pod events (add, modify, delete) in the specified namespace.
-Error Handling: If there’s an error in creating the watcher,
-the program panics.
-defer watcher.Stop() ensures that the watcher is stopped when the
-function returns.
+loadConfig picks the credentials to use and returns a description of where
+they came from for the startup log:
+
+forced (inClusterSet): only the requested source is tried, so a wrong mode
+fails loudly instead of silently using other credentials.
+auto: rest.InClusterConfig() is tried first; when it fails (not running in a
+pod) the kubeconfig file is used.
 */
-func watchPods(ctx context.Context, clientset *kubernetes.Clientset, namespace string) {
-	watcher, err := clientset.CoreV1().Pods(namespace).Watch(ctx, metav1.ListOptions{})
+func loadConfig(kubeconfig string, inCluster, inClusterSet bool) (*rest.Config, string, error) {
+	if !inClusterSet || inCluster {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			return config, "in-cluster service account", nil
+		}
+		if inClusterSet {
+			return nil, "", fmt.Errorf("error building in-cluster config: %v", err)
+		}
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
-		panic(fmt.Errorf("error creating pod watcher: %v", err))
+		return nil, "", fmt.Errorf("error building kubeconfig: %v", err)
+	}
+	return config, "kubeconfig " + kubeconfig, nil
+}
+
+/*
+*
+Watcher Creation: startWatch() creates one watcher per namespace for each
+selected resource, e.g. clientset.CoreV1().Pods(namespace).Watch(ctx, options)
+for pods, where options carries the label selector, that listens for events (add, modify, delete) in that namespace.
+Error Handling: If there’s an error in creating a watcher,
+the program panics.
+
+Each watcher runs in its own goroutine (forwardEvents) and sends its events
+into one shared channel, so handleEvent() still sees events one at a time and
+the state tracker and exporter need no locking.
+*/
+func watchResources(ctx context.Context, clientset *kubernetes.Clientset, resources, namespaces []string, options metav1.ListOptions, monitor *podMonitor) {
+	events := make(chan watch.Event)
+	var wg sync.WaitGroup
+	for _, resource := range resources {
+		for _, namespace := range namespaces {
+			watcher, err := startWatch(ctx, clientset, resource, namespace, options)
+			if err != nil {
+				panic(fmt.Errorf("error creating %s watcher for %s: %v", resource, describeNamespaces([]string{namespace}), err))
+			}
+			wg.Add(1)
+			go forwardEvents(ctx, clientset, resource, namespace, options, watcher, events, &wg)
+		}
 	}
-	defer watcher.Stop()
+
+	// Close the shared channel once every watcher has stopped
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
 
 	/**
 	Event Loop: The program enters an infinite loop, listening for events from
-	the watcher.ResultChan() channel, which delivers pod events
+	the shared events channel, which delivers events from every namespace
 	(such as addition, modification, deletion).
 
-	Event Handling: When an event is received, the program checks if it's an
-	error. If it's not an error, it passes the event to handlePodEvent() to
-	handle the event further.
+	Event Handling: Each event is passed to handleEvent() to handle the
+	event further; the printed lines are prefixed with the object's namespace.
 
 	Context Cancellation: If the context (ctx) is canceled
-	(for example, when the program shuts down),
-	the program prints a shutdown message and exits.
+	(for example, when the program shuts down), every watcher goroutine
+	stops its watch and the program waits for them before exiting.
 	*/
 	for {
 		select {
-		case event := <-watcher.ResultChan():
-			if event.Type == watch.Error {
-				fmt.Println("Error occurred while watching pods")
+		case event, ok := <-events:
+			if !ok {
+				statusf("All watchers stopped\n")
 				return
 			}
-			handlePodEvent(event)
+			monitor.handleEvent(event)
 		case <-ctx.Done():
-			fmt.Println("Shutting down pod monitor")
+			statusf("Shutting down pod monitor\n")
+			wg.Wait()
 			return
 		}
 	}
 }
 
+// maxReconnectBackoff caps the delay between attempts to re-establish a watch
+const maxReconnectBackoff = 30 * time.Second
+
 /*
 *
-Type Assertion: The event.Object contains the resource affected by the event.
-In this case, it expects a Pod. event.Object.(*v1.Pod) performs a type
-assertion to ensure the event is related to a pod. If it’s not,
-the program prints an error message.
+forwardEvents relays one namespace's watch events to the shared channel until
+the context is canceled.
+
+Reconnecting: The API server closes watches routinely (its watch timeout is a
+few minutes), and a watch can also end with an error event. Either way the
+watch is opened again from the last resourceVersion seen, so no event is
+missed or repeated. Bookmark events (requested with AllowWatchBookmarks)
+keep that resourceVersion fresh while nothing changes, and are not passed on.
+If the resourceVersion is too old (410 Gone), the watch restarts from the
+current state. Failed reconnects are retried with exponential backoff capped
+at maxReconnectBackoff; the backoff resets once a watch delivers events again.
 */
-func handlePodEvent(event watch.Event) {
-	pod, ok := event.Object.(*v1.Pod)
-	if !ok {
-		fmt.Println("Unexpected type received from watcher")
+func forwardEvents(ctx context.Context, clientset *kubernetes.Clientset, resource, namespace string, options metav1.ListOptions, watcher watch.Interface, events chan<- watch.Event, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	where := describeNamespaces([]string{namespace})
+	backoff := time.Second
+	for {
+		// Returns once the current watch ends; false means shut down
+		if !relayWatch(ctx, watcher, resource, where, &options, events, &backoff) {
+			return
+		}
+
+		// Re-establish the watch, backing off while the API server is unreachable
+		for {
+			statusf("Reconnecting %s watch in %s in %s\n", resource, where, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, maxReconnectBackoff)
+
+			var err error
+			watcher, err = startWatch(ctx, clientset, resource, namespace, options)
+			if err == nil {
+				break
+			}
+			statusf("Error re-creating %s watcher for %s: %v\n", resource, where, err)
+		}
+	}
+}
+
+// relayWatch forwards events from one watch until it closes or fails,
+// recording the last resourceVersion in options. It returns false when the
+// context is canceled and true when the watch should be re-established.
+func relayWatch(ctx context.Context, watcher watch.Interface, resource, where string, options *metav1.ListOptions, events chan<- watch.Event, backoff *time.Duration) bool {
+	defer watcher.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				statusf("Watch for %s in %s closed\n", resource, where)
+				return true
+			}
+			if event.Type == watch.Error {
+				if status, ok := event.Object.(*metav1.Status); ok && status.Code == http.StatusGone {
+					// The resourceVersion expired; start again from the current state
+					options.ResourceVersion = ""
+				}
+				statusf("Error occurred while watching %s in %s\n", resource, where)
+				return true
+			}
+
+			*backoff = time.Second
+			if obj, ok := event.Object.(metav1.Object); ok {
+				options.ResourceVersion = obj.GetResourceVersion()
+			}
+			if event.Type == watch.Bookmark {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return false
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+/*
+*
+podMonitor holds the state and options shared by every handled event:
+the last-seen state of each object, whether to print cosmetic updates,
+whether to print events as JSON, where to export and log events (nil when
+off), the command to run when a pod is deleted or fails (nil when -exec is
+not set) and where to fetch pod usage from (nil without -with-metrics or
+metrics-server).
+containers holds the last restart count and waiting reason of every
+container, per pod UID, and alertReasons the waiting reasons to alert on.
+stats collects the counters served at /metrics, slack batches
+notifications (nil without -slack-webhook) and dashboard holds the pod table
+drawn instead of the event log (nil without -dashboard).
+*/
+type podMonitor struct {
+	tracker      *stateTracker
+	containers   map[types.UID]map[string]containerSnapshot
+	alertReasons map[string]bool
+	stats        *monitorStats
+	slack        *slackNotifier
+	verbose      bool
+	phases       map[v1.PodPhase]bool // nil = every phase
+	phasesAll    bool
+	jsonOutput   bool
+	exporter     *eventExporter
+	eventLog     *eventExporter
+	hook         *execHook
+	metrics      *metricsClient
+	dashboard    *dashboard
+}
+
+/*
+*
+stateTracker remembers the last interesting state seen for every object,
+keyed by kind/namespace/name, so Modified events can be compared against it.
+For pods the state is the phase; for deployments the replica counts; for
+services the type and ports. Most Modified events are cosmetic (annotations,
+resource versions, condition timestamps) and leave that state unchanged.
+*/
+type stateTracker struct {
+	states map[string]string
+}
+
+func newStateTracker() *stateTracker {
+	return &stateTracker{states: make(map[string]string)}
+}
+
+func objectKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// update records the object's current state and returns the previous one
+// along with whether it differs.
+func (t *stateTracker) update(key, state string) (string, bool) {
+	previous, seen := t.states[key]
+	t.states[key] = state
+	return previous, !seen || previous != state
+}
+
+func (t *stateTracker) forget(key string) {
+	delete(t.states, key)
+}
+
+// fireHook runs the -exec hook for the pod when one is configured
+func (m *podMonitor) fireHook(hookType, namespace, name, status string) {
+	if m.hook == nil {
 		return
 	}
+	m.hook.Fire(hookEvent{Type: hookType, Kind: "pod", Namespace: namespace, Name: name, Status: status, Time: time.Now()})
+}
 
-	switch event.Type {
+// export appends the event to the export file and the event log, when enabled
+func (m *podMonitor) export(eventType watch.EventType, kind, namespace, name, status string) {
+	if m.exporter != nil {
+		if err := m.exporter.Write(eventType, kind, namespace, name, status); err != nil {
+			statusf("Error exporting event: %v\n", err)
+		}
+	}
+	if m.eventLog != nil {
+		if err := m.eventLog.Write(eventType, kind, namespace, name, status); err != nil {
+			statusf("Error writing event log: %v\n", err)
+		}
+	}
+}
+
+/*
+*
+handleEvent passes each event to the handler for the kind of object it
+carries, so the printed output adapts to the watched resource.
+*/
+func (m *podMonitor) handleEvent(event watch.Event) {
+	switch obj := event.Object.(type) {
+	case *v1.Pod:
+		m.handlePodEvent(event.Type, obj)
+	case *appsv1.Deployment:
+		m.handleDeploymentEvent(event.Type, obj)
+	case *v1.Service:
+		m.handleServiceEvent(event.Type, obj)
+	default:
+		statusf("Unexpected type received from watcher\n")
+	}
+}
+
+/*
+*
+Phase Filtering: Modified events whose phase matches the last-seen phase
+are skipped unless verbose is set. With -phases, events of pods in other
+phases are not printed (see phaseShown).
+
+Export: Every pod event is appended to the export file, if one is configured,
+before the console filtering is applied.
+
+Hook: A pod that is deleted or enters the Failed phase fires the -exec hook
+and is posted to Slack when -slack-webhook is set.
+
+Usage: With -with-metrics, printed events except deletions show the pod's
+CPU and memory usage as last listed by the background refresh.
+
+Containers: Container restart counts and waiting reasons are compared on
+every event, so a container crash-looping or failing to pull its image
+inside a Running or Pending pod is reported (see containers.go).
+
+Output: Events are printed by reportPod, as text or as JSON lines, or shown
+in the -dashboard table instead.
+*/
+func (m *podMonitor) handlePodEvent(eventType watch.EventType, pod *v1.Pod) {
+	phase := string(pod.Status.Phase)
+	key := objectKey("pod", pod.Namespace, pod.Name)
+	m.export(eventType, "pod", pod.Namespace, pod.Name, phase)
+	m.stats.observeEvent(eventType)
+	m.checkContainers(eventType, pod)
+	if m.dashboard != nil {
+		m.dashboard.update(eventType, pod)
+	}
+
+	switch eventType {
 	case watch.Added:
-		fmt.Printf("Pod added: %s\n", pod.Name)
+		m.tracker.update(key, phase)
+		if m.phaseShown(eventType, pod) {
+			m.reportPod(eventType, pod, "", "Pod added: "+pod.Name)
+		}
+		if pod.Status.Phase == v1.PodFailed {
+			m.fireHook("FAILED", pod.Namespace, pod.Name, phase)
+			m.notify(":red_circle: [%s] Pod failed: %s", pod.Namespace, pod.Name)
+		}
 	case watch.Modified:
-		fmt.Printf("Pod modified: %s (Status: %s)\n", pod.Name, pod.Status.Phase)
+		previous, changed := m.tracker.update(key, phase)
+		if m.phaseShown(eventType, pod) {
+			if changed {
+				m.reportPod(eventType, pod, previous, fmt.Sprintf("Pod phase changed: %s (%s -> %s)", pod.Name, previous, phase))
+			} else if m.verbose {
+				m.reportPod(eventType, pod, "", fmt.Sprintf("Pod modified: %s (Status: %s)", pod.Name, phase))
+			}
+		}
+		if changed && pod.Status.Phase == v1.PodFailed {
+			m.fireHook("FAILED", pod.Namespace, pod.Name, phase)
+			m.notify(":red_circle: [%s] Pod failed: %s (%s -> %s)", pod.Namespace, pod.Name, previous, phase)
+		}
 	case watch.Deleted:
-		fmt.Printf("Pod deleted: %s\n", pod.Name)
+		m.tracker.forget(key)
+		if m.phaseShown(eventType, pod) {
+			m.reportPod(eventType, pod, "", "Pod deleted: "+pod.Name)
+		}
+		m.fireHook("DELETED", pod.Namespace, pod.Name, phase)
+		m.notify(":wastebasket: [%s] Pod deleted: %s", pod.Namespace, pod.Name)
+	}
+}
+
+// phaseShown applies the -phases filter: Modified events always, Added and
+// Deleted events only with -phases-all-events
+func (m *podMonitor) phaseShown(eventType watch.EventType, pod *v1.Pod) bool {
+	if m.phases == nil || (eventType != watch.Modified && !m.phasesAll) {
+		return true
 	}
+	return m.phases[pod.Status.Phase]
 }
 
 func handleShutdown(cancel context.CancelFunc) {
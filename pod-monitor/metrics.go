@@ -0,0 +1,186 @@
+package main
+
+/**
+Resource usage:
+With -with-metrics, reported pod events are annotated with the pod's current
+CPU and memory usage from the metrics API (metrics.k8s.io), which is served by
+metrics-server:
+
+	[default] Pod added: web-7c9f (cpu 12m, memory 48Mi)
+
+The API is queried through the clientset's REST client and decoded here, so
+no extra client library is needed. If metrics-server is not installed the
+API group is missing: a warning is printed once at startup and events are
+reported without usage.
+
+Usage is not fetched per event, which would hold up the event loop for up to
+metricsTimeout on every pod event. Instead the usage of every pod in the
+watched namespaces is listed every metricsRefresh in the background, and
+events read the latest list. A pod that has just started has no metrics yet
+(they are collected every 15s or so); its events show "usage unavailable".
+The -dashboard table shows no usage, so nothing is fetched in that mode.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	metricsAPIPath = "/apis/metrics.k8s.io/v1beta1"
+	metricsTimeout = 2 * time.Second
+	metricsRefresh = 15 * time.Second
+)
+
+// podMetrics is the part of a metrics.k8s.io PodMetrics object we use
+type podMetrics struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Containers []struct {
+		Name  string            `json:"name"`
+		Usage map[string]string `json:"usage"`
+	} `json:"containers"`
+}
+
+// podMetricsList is a metrics.k8s.io PodMetricsList
+type podMetricsList struct {
+	Items []podMetrics `json:"items"`
+}
+
+// metricsClient keeps the usage of the pods in its namespaces, keyed by
+// "namespace/name"; run refreshes it while the event loop reads it
+type metricsClient struct {
+	clientset  *kubernetes.Clientset
+	namespaces []string
+
+	mu    sync.Mutex
+	usage map[string]string
+}
+
+// newMetricsClient checks that the metrics API is served and returns nil,
+// after printing a warning, when it is not
+func newMetricsClient(ctx context.Context, clientset *kubernetes.Clientset, namespaces []string) *metricsClient {
+	probeCtx, cancel := context.WithTimeout(ctx, metricsTimeout)
+	defer cancel()
+
+	if _, err := clientset.CoreV1().RESTClient().Get().AbsPath(metricsAPIPath).DoRaw(probeCtx); err != nil {
+		statusf("Warning: metrics API not available (is metrics-server installed?), reporting without usage: %v\n", err)
+		return nil
+	}
+	c := &metricsClient{clientset: clientset, namespaces: namespaces, usage: make(map[string]string)}
+	c.refresh(ctx)
+	return c
+}
+
+// run refreshes the usage every metricsRefresh until the context is canceled
+func (c *metricsClient) run(ctx context.Context) {
+	ticker := time.NewTicker(metricsRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.refresh(ctx)
+		}
+	}
+}
+
+// refresh replaces the usage with a fresh list, which also drops deleted
+// pods. A namespace whose list fails keeps its previous usage.
+func (c *metricsClient) refresh(ctx context.Context) {
+	usage := make(map[string]string)
+	for _, namespace := range c.namespaces {
+		if err := c.listUsage(ctx, namespace, usage); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			statusf("Warning: listing pod metrics: %v\n", err)
+			c.mu.Lock()
+			for key, value := range c.usage {
+				if namespace == metav1.NamespaceAll || strings.HasPrefix(key, namespace+"/") {
+					usage[key] = value
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+	c.mu.Lock()
+	c.usage = usage
+	c.mu.Unlock()
+}
+
+// listUsage adds the usage of every pod in the namespace (all namespaces
+// for metav1.NamespaceAll) to usage
+func (c *metricsClient) listUsage(ctx context.Context, namespace string, usage map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, metricsTimeout)
+	defer cancel()
+
+	request := c.clientset.CoreV1().RESTClient().Get()
+	if namespace == metav1.NamespaceAll {
+		request = request.AbsPath(metricsAPIPath, "pods")
+	} else {
+		request = request.AbsPath(metricsAPIPath, "namespaces", namespace, "pods")
+	}
+	data, err := request.DoRaw(ctx)
+	if err != nil {
+		return err
+	}
+	var list podMetricsList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("decoding pod metrics: %v", err)
+	}
+	for _, metrics := range list.Items {
+		total, err := metrics.total()
+		if err != nil {
+			return fmt.Errorf("pod %s/%s: %v", metrics.Metadata.Namespace, metrics.Metadata.Name, err)
+		}
+		usage[metrics.Metadata.Namespace+"/"+metrics.Metadata.Name] = total
+	}
+	return nil
+}
+
+// total returns the pod's usage summed over its containers, e.g.
+// "cpu 12m, memory 48Mi"
+func (p podMetrics) total() (string, error) {
+	var cpu, memory resource.Quantity
+	for _, container := range p.Containers {
+		for name, value := range container.Usage {
+			quantity, err := resource.ParseQuantity(value)
+			if err != nil {
+				return "", fmt.Errorf("container %s: invalid %s usage %q", container.Name, name, value)
+			}
+			switch name {
+			case "cpu":
+				cpu.Add(quantity)
+			case "memory":
+				memory.Add(quantity)
+			}
+		}
+	}
+	return fmt.Sprintf("cpu %dm, memory %dMi", cpu.MilliValue(), memory.Value()/(1024*1024)), nil
+}
+
+// podUsage returns the pod's latest listed usage for event output, "usage
+// unavailable" if it has none yet, or "" when -with-metrics is off
+func (m *podMonitor) podUsage(namespace, name string) string {
+	if m.metrics == nil {
+		return ""
+	}
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	if usage, ok := m.metrics.usage[namespace+"/"+name]; ok {
+		return usage
+	}
+	return "usage unavailable"
+}
@@ -0,0 +1,143 @@
+package main
+
+/**
+Output formats:
+-output text (the default) prints one readable line per reported event:
+
+	[default] Pod phase changed: web-7c9f (Pending -> Running)
+
+-output json prints the same events as one JSON object per line, for log
+collectors:
+
+	{"type":"MODIFIED","namespace":"default","pod":"web-7c9f","phase":"Running","previous_phase":"Pending","timestamp":"2024-05-01T12:00:00Z"}
+
+In JSON mode stdout carries nothing but events: status messages (startup,
+reconnects, warnings) go to stderr instead. JSON output is only available for
+pods. With -dashboard (see dashboard.go) none of these are printed. Container
+restarts are reported with the type "RESTARTED" and the
+container name and restart count, stuck containers with the type "ALERT" and
+the waiting reason and message.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// statusOut receives status messages; it is stderr when events are JSON
+var statusOut io.Writer = os.Stdout
+
+// statusf prints a status message that is not an event
+func statusf(format string, args ...interface{}) {
+	fmt.Fprintf(statusOut, format, args...)
+}
+
+// podEventRecord is the JSON form of a reported pod event
+type podEventRecord struct {
+	Type          string    `json:"type"`
+	Namespace     string    `json:"namespace"`
+	Pod           string    `json:"pod"`
+	Phase         string    `json:"phase"`
+	PreviousPhase string    `json:"previous_phase,omitempty"`
+	Container     string    `json:"container,omitempty"`
+	RestartCount  int32     `json:"restart_count,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	Message       string    `json:"message,omitempty"`
+	Usage         string    `json:"usage,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// reportPod prints a pod event in the selected output format. text is the
+// human-readable message; previous is the earlier phase for phase changes.
+func (m *podMonitor) reportPod(eventType watch.EventType, pod *v1.Pod, previous, text string) {
+	if m.dashboard != nil {
+		return
+	}
+	usage := ""
+	if eventType != watch.Deleted {
+		usage = m.podUsage(pod.Namespace, pod.Name)
+	}
+	if !m.jsonOutput {
+		if usage != "" {
+			text += " (" + usage + ")"
+		}
+		fmt.Printf("[%s] %s\n", pod.Namespace, text)
+		return
+	}
+
+	record := podEventRecord{
+		Type:          string(eventType),
+		Namespace:     pod.Namespace,
+		Pod:           pod.Name,
+		Phase:         string(pod.Status.Phase),
+		PreviousPhase: previous,
+		Usage:         usage,
+		Timestamp:     time.Now().UTC(),
+	}
+	printRecord(record)
+}
+
+// printRecord writes a record as one JSON line
+func printRecord(record podEventRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		statusf("Error encoding event: %v\n", err)
+		return
+	}
+	fmt.Println(string(line))
+}
+
+// reportRestart prints a warning for a container whose restart count grew
+func (m *podMonitor) reportRestart(pod *v1.Pod, status v1.ContainerStatus) {
+	if m.dashboard != nil {
+		return
+	}
+	if m.jsonOutput {
+		record := podEventRecord{
+			Type:         "RESTARTED",
+			Namespace:    pod.Namespace,
+			Pod:          pod.Name,
+			Phase:        string(pod.Status.Phase),
+			Container:    status.Name,
+			RestartCount: status.RestartCount,
+			Timestamp:    time.Now().UTC(),
+		}
+		printRecord(record)
+		return
+	}
+
+	reason := ""
+	if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason != "" {
+		reason = fmt.Sprintf(", last exit: %s (code %d)", terminated.Reason, terminated.ExitCode)
+	}
+	fmt.Printf("[%s] WARNING: container %s in pod %s restarted (restart count %d%s)\n",
+		pod.Namespace, status.Name, pod.Name, status.RestartCount, reason)
+}
+
+// reportAlert prints an alert for a container stuck in a waiting state
+func (m *podMonitor) reportAlert(pod *v1.Pod, container string, waiting *v1.ContainerStateWaiting) {
+	if m.dashboard != nil {
+		return
+	}
+	if m.jsonOutput {
+		printRecord(podEventRecord{
+			Type:      "ALERT",
+			Namespace: pod.Namespace,
+			Pod:       pod.Name,
+			Phase:     string(pod.Status.Phase),
+			Container: container,
+			Reason:    waiting.Reason,
+			Message:   waiting.Message,
+			Timestamp: time.Now().UTC(),
+		})
+		return
+	}
+	fmt.Printf("[%s] ALERT: container %s in pod %s is %s: %s\n",
+		pod.Namespace, container, pod.Name, waiting.Reason, waiting.Message)
+}
@@ -0,0 +1,93 @@
+package main
+
+/**
+Prometheus endpoint:
+With -metrics-addr (e.g. :9090) the monitor serves /metrics from its own
+prometheus client_golang registry:
+
+podmonitor_pod_events_total{type="added"}            pod events received, by type
+podmonitor_container_restarts{namespace,pod,container}
+                                                     current restart count of
+                                                     every container seen
+podmonitor_container_restarts_observed_total         restarts seen while running
+
+The restart gauge is dropped when its pod is deleted. The server runs in its
+own goroutine and shuts down when the context is canceled.
+*/
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// monitorStats holds the exported metrics. They are registered on a
+// registry of their own, so /metrics shows only the monitor's metrics and
+// not the process and Go runtime ones of the default registry.
+type monitorStats struct {
+	registry         *prometheus.Registry
+	events           *prometheus.CounterVec
+	restarts         *prometheus.GaugeVec
+	observedRestarts prometheus.Counter
+}
+
+func newMonitorStats() *monitorStats {
+	s := &monitorStats{
+		registry: prometheus.NewRegistry(),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "podmonitor_pod_events_total",
+			Help: "Pod watch events received, by type.",
+		}, []string{"type"}),
+		restarts: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "podmonitor_container_restarts",
+			Help: "Current restart count of each container.",
+		}, []string{"namespace", "pod", "container"}),
+		observedRestarts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "podmonitor_container_restarts_observed_total",
+			Help: "Container restarts seen since the monitor started.",
+		}),
+	}
+	s.registry.MustRegister(s.events, s.restarts, s.observedRestarts)
+	return s
+}
+
+// observeEvent counts one pod event
+func (s *monitorStats) observeEvent(eventType watch.EventType) {
+	s.events.WithLabelValues(strings.ToLower(string(eventType))).Inc()
+}
+
+// setRestarts records a container's current restart count; increased is the
+// number of restarts since the previous event
+func (s *monitorStats) setRestarts(namespace, pod, container string, count, increased int32) {
+	s.restarts.WithLabelValues(namespace, pod, container).Set(float64(count))
+	s.observedRestarts.Add(float64(increased))
+}
+
+// forgetPod drops the restart gauges of a deleted pod
+func (s *monitorStats) forgetPod(namespace, pod string) {
+	s.restarts.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "pod": pod})
+}
+
+// serveMetrics serves /metrics on addr until the context is canceled
+func serveMetrics(ctx context.Context, addr string, stats *monitorStats) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(stats.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	statusf("Serving metrics on %s/metrics\n", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		statusf("Metrics server error: %v\n", err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+/**
+Resource selection:
+The -resource flag picks which kind of object to watch. Each kind needs its
+own typed client to start the watch, and its own handler because the
+interesting state differs:
+
+pods:        the phase (Pending, Running, Succeeded, Failed)
+deployments: ready/desired and updated replica counts
+services:    the service type, cluster IP and ports
+
+Several kinds can be watched at once with a comma-separated list, e.g.
+-resource pods,deployments. Every kind gets one watcher per namespace, and
+all of them share the same reconnect handling and event loop.
+*/
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// supportedResources lists the kinds startWatch knows how to watch
+var supportedResources = []string{"pods", "deployments", "services"}
+
+// parseResources splits the -resource flag, rejecting unknown kinds and
+// dropping duplicates
+func parseResources(value string) ([]string, error) {
+	var resources []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		known := false
+		for _, supported := range supportedResources {
+			if name == supported {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unsupported resource %q (use pods, deployments or services)", name)
+		}
+		seen[name] = true
+		resources = append(resources, name)
+	}
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("no resource given")
+	}
+	return resources, nil
+}
+
+// startWatch opens a watch on the selected resource using its typed client;
+// options carries the label selector
+func startWatch(ctx context.Context, clientset *kubernetes.Clientset, resource, namespace string, options metav1.ListOptions) (watch.Interface, error) {
+	switch resource {
+	case "pods":
+		return clientset.CoreV1().Pods(namespace).Watch(ctx, options)
+	case "deployments":
+		return clientset.AppsV1().Deployments(namespace).Watch(ctx, options)
+	case "services":
+		return clientset.CoreV1().Services(namespace).Watch(ctx, options)
+	}
+	return nil, fmt.Errorf("unsupported resource %q (use pods, deployments or services)", resource)
+}
+
+// deploymentStatus summarises the replica counts, e.g. "2/3 ready, 3 updated"
+func deploymentStatus(deployment *appsv1.Deployment) string {
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	return fmt.Sprintf("%d/%d ready, %d updated", deployment.Status.ReadyReplicas, desired, deployment.Status.UpdatedReplicas)
+}
+
+/*
+*
+Deployment events: Modified events are reported when the replica counts
+change (a rollout progressing, a scale up/down), or always with -verbose.
+*/
+func (m *podMonitor) handleDeploymentEvent(eventType watch.EventType, deployment *appsv1.Deployment) {
+	status := deploymentStatus(deployment)
+	key := objectKey("deployment", deployment.Namespace, deployment.Name)
+	m.export(eventType, "deployment", deployment.Namespace, deployment.Name, status)
+
+	switch eventType {
+	case watch.Added:
+		m.tracker.update(key, status)
+		fmt.Printf("[%s] Deployment added: %s (%s)\n", deployment.Namespace, deployment.Name, status)
+	case watch.Modified:
+		previous, changed := m.tracker.update(key, status)
+		if changed {
+			fmt.Printf("[%s] Deployment replicas changed: %s (%s -> %s)\n", deployment.Namespace, deployment.Name, previous, status)
+		} else if m.verbose {
+			fmt.Printf("[%s] Deployment modified: %s (%s)\n", deployment.Namespace, deployment.Name, status)
+		}
+	case watch.Deleted:
+		m.tracker.forget(key)
+		fmt.Printf("[%s] Deployment deleted: %s\n", deployment.Namespace, deployment.Name)
+	}
+}
+
+// serviceSummary describes a service, e.g. "ClusterIP 10.0.0.12 80/TCP,443/TCP"
+func serviceSummary(service *v1.Service) string {
+	var ports []string
+	for _, port := range service.Spec.Ports {
+		ports = append(ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+	}
+	return fmt.Sprintf("%s %s %s", service.Spec.Type, service.Spec.ClusterIP, strings.Join(ports, ","))
+}
+
+/*
+*
+Service events: Modified events are reported when the type, cluster IP or
+ports change, or always with -verbose.
+*/
+func (m *podMonitor) handleServiceEvent(eventType watch.EventType, service *v1.Service) {
+	summary := serviceSummary(service)
+	key := objectKey("service", service.Namespace, service.Name)
+	m.export(eventType, "service", service.Namespace, service.Name, summary)
+
+	switch eventType {
+	case watch.Added:
+		m.tracker.update(key, summary)
+		fmt.Printf("[%s] Service added: %s (%s)\n", service.Namespace, service.Name, summary)
+	case watch.Modified:
+		previous, changed := m.tracker.update(key, summary)
+		if changed {
+			fmt.Printf("[%s] Service changed: %s (%s -> %s)\n", service.Namespace, service.Name, previous, summary)
+		} else if m.verbose {
+			fmt.Printf("[%s] Service modified: %s (%s)\n", service.Namespace, service.Name, summary)
+		}
+	case watch.Deleted:
+		m.tracker.forget(key)
+		fmt.Printf("[%s] Service deleted: %s\n", service.Namespace, service.Name)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+/**
+Slack notifications:
+With -slack-webhook set to a Slack incoming webhook URL, pods that are
+deleted, fail, or have a container stuck in an -alert-reasons state are
+posted to Slack, e.g.
+
+	:red_circle: [default] Pod failed: web-7c9f
+	:wastebasket: [default] Pod deleted: worker-1
+
+Events are batched: whatever arrived during the last flushInterval (5s) is
+sent as one message, so a burst of deletions stays within Slack's rate
+limits. A failed post is logged and its batch dropped; the monitor keeps
+running. Console output is not affected.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const slackFlushInterval = 5 * time.Second
+
+type slackNotifier struct {
+	webhook string
+	client  *http.Client
+
+	mu      sync.Mutex
+	pending []string
+	done    chan struct{} // closed once the final batch has been sent
+}
+
+func newSlackNotifier(webhook string) *slackNotifier {
+	return &slackNotifier{
+		webhook: webhook,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		done:    make(chan struct{}),
+	}
+}
+
+// Notify queues a line for the next batch
+func (s *slackNotifier) Notify(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, line)
+}
+
+// run sends the queued lines every slackFlushInterval until the context is
+// canceled, then sends what is left
+func (s *slackNotifier) run(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(slackFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-ctx.Done():
+			s.flush()
+			return
+		}
+	}
+}
+
+// Wait blocks until the final batch has been sent
+func (s *slackNotifier) Wait() {
+	<-s.done
+}
+
+func (s *slackNotifier) flush() {
+	s.mu.Lock()
+	lines := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if len(lines) == 0 {
+		return
+	}
+	if err := s.post(strings.Join(lines, "\n")); err != nil {
+		log.Printf("slack: dropping %d events: %v", len(lines), err)
+	}
+}
+
+// post sends one message to the webhook
+func (s *slackNotifier) post(text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// notify queues a Slack line when -slack-webhook is set
+func (m *podMonitor) notify(format string, args ...interface{}) {
+	if m.slack == nil {
+		return
+	}
+	m.slack.Notify(fmt.Sprintf(format, args...))
+}
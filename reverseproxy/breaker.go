@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/**
+Circuit breaker:
+When a backend is down, every request still waits for a connection attempt
+(and its retries) to fail. A circuit breaker notices repeated failures and
+starts failing fast instead, giving the backend time to recover.
+
+closed:    requests flow normally; consecutive failures are counted.
+open:      after maxFailures consecutive failures every request is rejected
+           immediately until cooldown has passed.
+half-open: once the cooldown is over a single probe request is let through.
+           Success closes the circuit, failure opens it for another cooldown.
+*/
+
+const (
+	stateClosed   = "closed"
+	stateOpen     = "open"
+	stateHalfOpen = "half-open"
+)
+
+// errCircuitOpen is returned instead of contacting a backend whose circuit is open
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker tracks the health of a single upstream host
+type circuitBreaker struct {
+	mu          sync.Mutex
+	state       string
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	maxFailures int
+	cooldown    time.Duration
+}
+
+// allow reports whether a request may be sent to the host right now
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case stateOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = stateHalfOpen
+		cb.probing = true
+		return true
+	case stateHalfOpen:
+		// Only one probe at a time while half-open
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of a request it allowed
+func (cb *circuitBreaker) record(host string, success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+	if success {
+		if cb.state != stateClosed {
+			log.Printf("Circuit for %s closed", host)
+		}
+		cb.state = stateClosed
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.state == stateHalfOpen || cb.failures >= cb.maxFailures {
+		if cb.state != stateOpen {
+			log.Printf("Circuit for %s opened after %d consecutive failures", host, cb.failures)
+		}
+		cb.state = stateOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+// breakerStatus is the JSON shape reported by /status for each host
+type breakerStatus struct {
+	State    string    `json:"state"`
+	Failures int       `json:"consecutive_failures"`
+	OpenedAt time.Time `json:"opened_at,omitempty"`
+}
+
+func (cb *circuitBreaker) status() breakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	status := breakerStatus{State: cb.state, Failures: cb.failures}
+	if cb.state != stateClosed {
+		status.OpenedAt = cb.openedAt
+	}
+	return status
+}
+
+// breakerTransport keeps one circuit breaker per upstream host
+type breakerTransport struct {
+	base        http.RoundTripper
+	maxFailures int
+	cooldown    time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerTransport(base http.RoundTripper, maxFailures int, cooldown time.Duration) *breakerTransport {
+	return &breakerTransport{
+		base:        base,
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+		breakers:    make(map[string]*circuitBreaker),
+	}
+}
+
+// breakerFor returns the breaker for host, creating a closed one on first use
+func (t *breakerTransport) breakerFor(host string) *circuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cb, ok := t.breakers[host]
+	if !ok {
+		cb = &circuitBreaker{state: stateClosed, maxFailures: t.maxFailures, cooldown: t.cooldown}
+		t.breakers[host] = cb
+	}
+	return cb
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	cb := t.breakerFor(host)
+	if !cb.allow() {
+		return nil, errCircuitOpen
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	cb.record(host, err == nil && resp.StatusCode < http.StatusInternalServerError)
+	return resp, err
+}
+
+// Status returns the current state of every known host's breaker
+func (t *breakerTransport) Status() map[string]breakerStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	statuses := make(map[string]breakerStatus, len(t.breakers))
+	for host, cb := range t.breakers {
+		statuses[host] = cb.status()
+	}
+	return statuses
+}
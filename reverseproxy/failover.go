@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+)
+
+/**
+Failover:
+Upstreams are listed in order of preference. Every request goes to the first
+one; if the connection fails or it answers with a 5xx, the same request is
+sent to the next one, and so on. The last upstream's answer is returned as is.
+This is simple active/passive failover rather than load balancing.
+
+Like retries (see retryTransport), failover on a 5xx is limited to idempotent
+methods: an upstream that answered a POST with a 5xx may already have acted
+on it, so its answer is returned as is. A non-idempotent request only fails
+over when the attempt failed before the request was written, e.g. because
+the connection was refused or the circuit is open.
+
+Each upstream gets its own httputil.ReverseProxy. The attempt number travels
+with the request in its context: ModifyResponse turns a 5xx into an error,
+and ErrorHandler uses the attempt number to hand the request to the next
+upstream's proxy. ErrorHandler is given the outgoing request, already
+rewritten for the failed upstream (path prefix, X-Forwarded-For), so it is
+the original inbound request that is handed on.
+
+To resend a request its body is kept in memory, up to -max-body bytes;
+larger bodies are refused with 413. With a single upstream there is nothing
+to fail over to and the body is streamed instead.
+*/
+
+// errUpstream5xx makes ModifyResponse hand a 5xx response to ErrorHandler
+var errUpstream5xx = errors.New("upstream returned a server error")
+
+// defaultMaxBody is the largest request body kept for failover without -max-body
+const defaultMaxBody = 10 << 20
+
+// failoverKey is the context key for the per-request failoverState
+type failoverKey struct{}
+
+// failoverState tracks which upstream is being tried and keeps the inbound
+// request and its body so they can be sent again to the next upstream
+type failoverState struct {
+	attempt int
+	req     *http.Request
+	body    []byte
+
+	// sent is set once the current attempt's request headers were written
+	sent atomic.Bool
+}
+
+type failoverProxy struct {
+	upstreams []*url.URL
+	proxies   []*httputil.ReverseProxy
+	maxBody   int64
+}
+
+// newFailoverProxy builds one reverse proxy per upstream sharing transport;
+// request bodies over maxBody bytes are refused when there is more than one
+func newFailoverProxy(upstreams []*url.URL, transport http.RoundTripper, maxBody int64) *failoverProxy {
+	fp := &failoverProxy{upstreams: upstreams, maxBody: maxBody}
+	for i, upstream := range upstreams {
+		proxy := httputil.NewSingleHostReverseProxy(upstream)
+		proxy.Transport = transport
+		proxy.ModifyResponse = fp.modifyResponse(i)
+		proxy.ErrorHandler = fp.errorHandler(i)
+		fp.proxies = append(fp.proxies, proxy)
+	}
+	return fp
+}
+
+func (fp *failoverProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state := &failoverState{}
+
+	// Buffer the body once so every upstream receives the full request
+	if len(fp.upstreams) > 1 && r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(io.LimitReader(r.Body, fp.maxBody+1))
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > fp.maxBody {
+			http.Error(w, fmt.Sprintf("Request body larger than %d bytes", fp.maxBody), http.StatusRequestEntityTooLarge)
+			return
+		}
+		state.body = body
+	}
+
+	state.req = r.WithContext(context.WithValue(r.Context(), failoverKey{}, state))
+	fp.serveAttempt(w, state)
+}
+
+// serveAttempt sends the inbound request to the upstream for the current
+// attempt
+func (fp *failoverProxy) serveAttempt(w http.ResponseWriter, state *failoverState) {
+	state.sent.Store(false)
+	r := state.req.WithContext(httptrace.WithClientTrace(state.req.Context(), &httptrace.ClientTrace{
+		WroteHeaders: func() { state.sent.Store(true) },
+	}))
+	if state.body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(state.body))
+		// retryTransport replays the buffered body instead of reading it again
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(state.body)), nil
+		}
+	}
+	fp.proxies[state.attempt].ServeHTTP(w, r)
+}
+
+// modifyResponse logs the serving upstream, or rejects a 5xx to an
+// idempotent request when another upstream is still left to try
+func (fp *failoverProxy) modifyResponse(index int) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		upstream := fp.upstreams[index]
+		if resp.StatusCode >= http.StatusInternalServerError && index < len(fp.upstreams)-1 && isIdempotent(resp.Request.Method) {
+			resp.Body.Close()
+			return fmt.Errorf("%w: %s from %s", errUpstream5xx, resp.Status, upstream)
+		}
+		log.Printf("Served by upstream %s (attempt %d/%d): %s", upstream, index+1, len(fp.upstreams), resp.Status)
+		return nil
+	}
+}
+
+// errorHandler falls through to the next upstream, or reports the failure
+// once every upstream has been tried or the request must not be sent again
+func (fp *failoverProxy) errorHandler(index int) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		upstream := fp.upstreams[index]
+		state, _ := r.Context().Value(failoverKey{}).(*failoverState)
+
+		// A non-idempotent request may only go elsewhere if it never left
+		repeatable := isIdempotent(r.Method) || (state != nil && !errors.Is(err, errUpstream5xx) && !state.sent.Load())
+		if state != nil && repeatable && index < len(fp.upstreams)-1 && r.Context().Err() == nil {
+			state.attempt = index + 1
+			log.Printf("Upstream %s failed (%v), failing over to %s", upstream, err, fp.upstreams[state.attempt])
+			fp.serveAttempt(w, state)
+			return
+		}
+
+		// Fail fast with 503 while a circuit is open, 502 for other upstream errors
+		log.Printf("Proxy error for %s from %s: %v", r.URL.Path, upstream, err)
+		if errors.Is(err, errCircuitOpen) {
+			http.Error(w, "Upstream unavailable (circuit open)", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "Bad gateway", http.StatusBadGateway)
+	}
+}
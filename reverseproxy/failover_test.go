@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// received is what an upstream saw of the last request it was sent
+type received struct {
+	path, forwardedFor, body string
+}
+
+// upstreamAt starts a server answering status and returns its URL with
+// basePath appended, as -upstreams would list it; last reports the latest
+// request the server got
+func upstreamAt(t *testing.T, basePath string, status int) (*url.URL, func() *received) {
+	t.Helper()
+	var last *received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		last = &received{r.URL.Path, r.Header.Get("X-Forwarded-For"), string(body)}
+		w.WriteHeader(status)
+		io.WriteString(w, http.StatusText(status))
+	}))
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL + basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, func() *received { return last }
+}
+
+func serveProxy(proxy http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// The next upstream gets the client's request, not the one already
+// rewritten for the upstream that failed
+func TestFailoverResendsInboundRequest(t *testing.T) {
+	primary, _ := upstreamAt(t, "/api", http.StatusInternalServerError)
+	standby, standbyGot := upstreamAt(t, "/api", http.StatusOK)
+	proxy := newFailoverProxy([]*url.URL{primary, standby}, http.DefaultTransport, defaultMaxBody)
+
+	// httptest.NewRequest comes from 192.0.2.1
+	rec := serveProxy(proxy, http.MethodPut, "/users/7", "name=alice")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200 from the standby", rec.Code)
+	}
+	want := received{path: "/api/users/7", forwardedFor: "192.0.2.1", body: "name=alice"}
+	if got := standbyGot(); got == nil || *got != want {
+		t.Errorf("standby got %+v, want %+v", got, want)
+	}
+}
+
+// modifyResponse turns a 5xx into errUpstream5xx, which errorHandler takes
+// as the signal to fail over, only when the method is idempotent and
+// another upstream is left
+func TestModifyResponseHandsOffTo5xx(t *testing.T) {
+	primary, _ := upstreamAt(t, "", http.StatusOK)
+	standby, _ := upstreamAt(t, "", http.StatusOK)
+	fp := newFailoverProxy([]*url.URL{primary, standby}, http.DefaultTransport, defaultMaxBody)
+
+	tests := []struct {
+		index   int
+		method  string
+		status  int
+		wantErr bool
+	}{
+		{0, http.MethodGet, http.StatusBadGateway, true},
+		{0, http.MethodDelete, http.StatusInternalServerError, true},
+		{0, http.MethodGet, http.StatusNotFound, false},
+		{0, http.MethodPost, http.StatusBadGateway, false},
+		{1, http.MethodGet, http.StatusBadGateway, false}, // the last upstream's answer is returned
+	}
+	for _, tt := range tests {
+		resp := &http.Response{
+			StatusCode: tt.status,
+			Status:     http.StatusText(tt.status),
+			Body:       http.NoBody,
+			Request:    httptest.NewRequest(tt.method, "/", nil),
+		}
+		err := fp.modifyResponse(tt.index)(resp)
+		if got := errors.Is(err, errUpstream5xx); got != tt.wantErr {
+			t.Errorf("upstream %d, %s answered %d: got error %v, want errUpstream5xx: %v",
+				tt.index, tt.method, tt.status, err, tt.wantErr)
+		}
+	}
+}
+
+// A POST that reached an upstream is not sent again after a 5xx, but one
+// rejected by an open circuit never left and can go to the standby
+func TestNonIdempotentFailover(t *testing.T) {
+	primary, _ := upstreamAt(t, "", http.StatusInternalServerError)
+	standby, standbyGot := upstreamAt(t, "", http.StatusCreated)
+	breakers := newBreakerTransport(http.DefaultTransport, 1, time.Minute)
+	proxy := newFailoverProxy([]*url.URL{primary, standby}, breakers, defaultMaxBody)
+
+	if rec := serveProxy(proxy, http.MethodPost, "/orders", "item=1"); rec.Code != http.StatusInternalServerError || standbyGot() != nil {
+		t.Fatalf("got %d, standby got %+v; want the primary's 500 and nothing sent to the standby", rec.Code, standbyGot())
+	}
+
+	// That 500 opened the primary's circuit
+	if rec := serveProxy(proxy, http.MethodPost, "/orders", "item=2"); rec.Code != http.StatusCreated {
+		t.Fatalf("with the primary's circuit open got %d, want 201 from the standby", rec.Code)
+	}
+	if got := standbyGot(); got.body != "item=2" {
+		t.Errorf("standby got body %q, want item=2", got.body)
+	}
+}
+
+// With no upstream left an open circuit fails fast with 503
+func TestCircuitOpenReturns503(t *testing.T) {
+	only, _ := upstreamAt(t, "", http.StatusServiceUnavailable)
+	proxy := newFailoverProxy([]*url.URL{only}, newBreakerTransport(http.DefaultTransport, 1, time.Minute), defaultMaxBody)
+
+	if rec := serveProxy(proxy, http.MethodGet, "/", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first request: got %d, want the upstream's 503", rec.Code)
+	}
+	rec := serveProxy(proxy, http.MethodGet, "/", "")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "circuit open") {
+		t.Errorf("second request: got %d %q, want 503 for the open circuit", rec.Code, rec.Body)
+	}
+}
+
+// Bodies kept for failover are limited to maxBody; with a single upstream
+// nothing is kept, so any size is streamed through
+func TestRequestBodyLimit(t *testing.T) {
+	primary, _ := upstreamAt(t, "", http.StatusOK)
+	standby, _ := upstreamAt(t, "", http.StatusOK)
+	const maxBody = 8
+
+	failover := newFailoverProxy([]*url.URL{primary, standby}, http.DefaultTransport, maxBody)
+	if rec := serveProxy(failover, http.MethodPut, "/", "12345678"); rec.Code != http.StatusOK {
+		t.Errorf("%d byte body: got %d, want 200", maxBody, rec.Code)
+	}
+	if rec := serveProxy(failover, http.MethodPut, "/", "123456789"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("%d byte body: got %d, want 413", maxBody+1, rec.Code)
+	}
+
+	single := newFailoverProxy([]*url.URL{primary}, http.DefaultTransport, maxBody)
+	if rec := serveProxy(single, http.MethodPut, "/", strings.Repeat("x", 1000)); rec.Code != http.StatusOK {
+		t.Errorf("single upstream: got %d, want 200", rec.Code)
+	}
+}
@@ -36,38 +36,174 @@ servers, improving scalability.
 */
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
 	"log"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
+	"strings"
+	"time"
 )
 
+// retryTransport wraps another http.RoundTripper and retries requests that fail
+// with a dropped connection or a 502/503 from the upstream.
+//
+// Only idempotent methods (GET, HEAD, PUT, DELETE) are retried. Sending a POST
+// twice could create a resource twice, so those are passed through untouched.
+// Every attempt re-sends the body: from req.GetBody when the failover proxy
+// already keeps it in memory, otherwise from a copy read here. A body larger
+// than maxBody is not copied; the request is sent once without retries.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	backoff    time.Duration
+	maxBody    int64
+}
+
+// isIdempotent reports whether a request with this method is safe to repeat
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// shouldRetry reports whether the outcome of an attempt is worth retrying
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req.Method) || t.maxRetries <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	// Buffer the body so it can be replayed on each attempt
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	getBody := req.GetBody
+	if hasBody && getBody == nil {
+		body, err := io.ReadAll(io.LimitReader(req.Body, t.maxBody+1))
+		if err != nil {
+			req.Body.Close()
+			return nil, err
+		}
+		if int64(len(body)) > t.maxBody {
+			// Too large to keep: send what was read and the rest, once
+			outReq := req.Clone(req.Context())
+			outReq.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+			return t.base.RoundTrip(outReq)
+		}
+		getBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	if hasBody {
+		req.Body.Close()
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		outReq := req.Clone(req.Context())
+		if hasBody {
+			if outReq.Body, err = getBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err = t.base.RoundTrip(outReq)
+		if !shouldRetry(resp, err) || attempt >= t.maxRetries {
+			return resp, err
+		}
+
+		// Wait twice as long after every failed attempt
+		delay := t.backoff * time.Duration(1<<attempt)
+		if err != nil {
+			log.Printf("Retry %d/%d for %s %s after error: %v (waiting %s)", attempt+1, t.maxRetries, req.Method, req.URL, err, delay)
+		} else {
+			log.Printf("Retry %d/%d for %s %s after status %s (waiting %s)", attempt+1, t.maxRetries, req.Method, req.URL, resp.Status, delay)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
 func main() {
-	// Define the backend server to forward requests to
+	maxRetries := flag.Int("retries", 3, "Number of times to retry idempotent requests on 502/503 or connection errors")
+	backoff := flag.Duration("retry-backoff", 200*time.Millisecond, "Initial delay between retries, doubled after each attempt")
+	breakerFailures := flag.Int("breaker-failures", 5, "Consecutive failures before a host's circuit opens")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "How long an open circuit fails fast before allowing a probe")
+	upstreamList := flag.String("upstreams", "http://example.com", "Comma-separated upstream URLs, tried in order on connection failure or 5xx")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 10*time.Second, "Maximum time to read a client's request headers")
+	readTimeout := flag.Duration("read-timeout", 30*time.Second, "Maximum time to read a client's whole request, body included")
+	writeTimeout := flag.Duration("write-timeout", 90*time.Second, "Maximum time from the end of the request headers to the end of the response")
+	maxHeaderBytes := flag.Int("max-header-bytes", 64<<10, "Maximum size of a client's request headers in bytes")
+	maxResponseHeaderBytes := flag.Int64("max-response-header-bytes", 64<<10, "Maximum size of an upstream's response headers in bytes")
+	maxBody := flag.Int64("max-body", defaultMaxBody, "Maximum size of a request body kept in memory to fail over with (larger bodies get 413) or to retry (larger bodies are sent once)")
+	flag.Parse()
+
+	// Define the backend servers to forward requests to
 	/**
-	Replace http://example.com with the backend server's URL.
-	url.Parse parses the backend URL into a format usable by Go's HTTP client.
+	Replace http://example.com with the backend servers' URLs, most preferred first,
+	e.g. -upstreams http://primary:8081,http://standby:8082
+	url.Parse parses each backend URL into a format usable by Go's HTTP client.
 	*/
-	target := "http://example.com"
-	parsedURL, err := url.Parse(target)
-	if err != nil {
-		log.Fatalf("Error parsing target URL: %v", err)
+	var upstreams []*url.URL
+	for _, target := range strings.Split(*upstreamList, ",") {
+		parsedURL, err := url.Parse(strings.TrimSpace(target))
+		if err != nil {
+			log.Fatalf("Error parsing target URL: %v", err)
+		}
+		upstreams = append(upstreams, parsedURL)
 	}
 
-	// Create a reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(parsedURL)
+	// Retry idempotent requests when the upstream is briefly unavailable, and
+	// stop contacting a host entirely once it keeps failing after retries
+	// Upstream responses with oversized headers are rejected as errors
+	upstreamTransport := http.DefaultTransport.(*http.Transport).Clone()
+	upstreamTransport.MaxResponseHeaderBytes = *maxResponseHeaderBytes
 
-	// Customize the proxy behavior if needed
-	proxy.ModifyResponse = func(resp *http.Response) error {
-		log.Printf("Response status: %s", resp.Status)
-		return nil
-	}
+	breakers := newBreakerTransport(&retryTransport{
+		base:       upstreamTransport,
+		maxRetries: *maxRetries,
+		backoff:    *backoff,
+		maxBody:    *maxBody,
+	}, *breakerFailures, *breakerCooldown)
+
+	// Count requests, upstream errors and latency for /metrics
+	metrics := newProxyMetrics()
+
+	// Create a reverse proxy that fails over through the upstreams in order
+	proxy := metrics.wrap(newFailoverProxy(upstreams, metrics.transport(breakers), *maxBody))
 
 	/**
 	The http.HandleFunc function routes all incoming requests to the reverse proxy.
 	proxy.ServeHTTP forwards the request to the backend server
 	*/
 
+	// Report circuit breaker state per upstream host
+	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(breakers.Status())
+	})
+
+	// Prometheus metrics for the proxied traffic
+	http.Handle("/metrics", metrics)
+
 	// Handle incoming requests
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Request URL: %s", r.URL.Path)
@@ -75,9 +211,33 @@ func main() {
 	})
 
 	// Start the server
+	/**
+	http.ListenAndServe has no timeouts, so a client that sends its headers one
+	byte at a time (slowloris) can hold a connection open forever. The server
+	below bounds every stage of a request:
+
+	ReadHeaderTimeout (10s): headers must arrive quickly; this is the main
+	slowloris defence.
+	ReadTimeout (30s): the whole request, body included, must be read in time.
+	WriteTimeout (90s): the response must be finished in time. It covers the
+	upstream round trip too, so keep it above the slowest upstream plus the
+	retry backoff.
+	MaxHeaderBytes (64KiB): oversized request headers get 431 instead of
+	being buffered. Go's default is 1MiB.
+
+	Upstream response headers are capped separately with
+	-max-response-header-bytes on the transport above.
+	*/
 	port := ":8080"
+	server := &http.Server{
+		Addr:              port,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		MaxHeaderBytes:    *maxHeaderBytes,
+	}
 	log.Printf("Reverse proxy server is running on port %s", port)
-	if err := http.ListenAndServe(port, nil); err != nil {
+	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// flakyUpstream answers 503 to the first failures requests, then 200, and
+// records the body of every request
+func flakyUpstream(t *testing.T, failures int) (string, *[]string) {
+	t.Helper()
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &bodies
+}
+
+func retryTestTransport() *retryTransport {
+	return &retryTransport{base: http.DefaultTransport, maxRetries: 2, maxBody: 8}
+}
+
+func roundTrip(t *testing.T, transport http.RoundTripper, req *http.Request) int {
+	t.Helper()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	url, bodies := flakyUpstream(t, 1)
+	req, _ := http.NewRequest(http.MethodPut, url, io.NopCloser(strings.NewReader("12345678")))
+
+	if status := roundTrip(t, retryTestTransport(), req); status != http.StatusOK {
+		t.Fatalf("got %d, want 200 after one retry", status)
+	}
+	if got := strings.Join(*bodies, ","); got != "12345678,12345678" {
+		t.Errorf("upstream got bodies %s, want the full body twice", got)
+	}
+}
+
+// A body over maxBody is not kept, so the request is sent once, whole
+func TestRetryLargeBodySentOnce(t *testing.T) {
+	url, bodies := flakyUpstream(t, 1)
+	req, _ := http.NewRequest(http.MethodPut, url, io.NopCloser(strings.NewReader("123456789")))
+
+	if status := roundTrip(t, retryTestTransport(), req); status != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want the first answer, 503", status)
+	}
+	if len(*bodies) != 1 || (*bodies)[0] != "123456789" {
+		t.Errorf("upstream got bodies %q, want the full body once", *bodies)
+	}
+}
+
+// unreadable fails the test's request if the transport reads it
+type unreadable struct{}
+
+func (unreadable) Read([]byte) (int, error) { return 0, errors.New("body read instead of GetBody") }
+func (unreadable) Close() error             { return nil }
+
+// The body the failover proxy keeps is replayed through GetBody, whatever
+// its size, instead of being read into a second copy
+func TestRetryUsesGetBody(t *testing.T) {
+	url, bodies := flakyUpstream(t, 1)
+	req, _ := http.NewRequest(http.MethodPut, url, unreadable{})
+	req.ContentLength = 10
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("0123456789")), nil
+	}
+
+	if status := roundTrip(t, retryTestTransport(), req); status != http.StatusOK {
+		t.Fatalf("got %d, want 200 after one retry", status)
+	}
+	if got := strings.Join(*bodies, ","); got != "0123456789,0123456789" {
+		t.Errorf("upstream got bodies %s, want the GetBody body twice", got)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+Metrics:
+The proxy counts what passes through it and serves the numbers at /metrics in
+the Prometheus text format, so it can be scraped without extra middleware:
+
+reverseproxy_requests_total{class="2xx"}      requests answered, by status class
+reverseproxy_upstream_errors_total            failed round trips to an upstream
+                                              (connection errors, open circuits)
+reverseproxy_request_duration_seconds         histogram of end-to-end latency
+
+Upstream errors are counted per attempt, so a request that fails over or is
+retried can add more than one.
+*/
+
+// latencyBuckets are the histogram upper bounds in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type proxyMetrics struct {
+	mu             sync.Mutex
+	requests       map[string]int64 // by status class
+	upstreamErrors int64
+	bucketCounts   []int64 // one per latencyBuckets entry, non-cumulative
+	latencySum     float64
+	latencyCount   int64
+}
+
+func newProxyMetrics() *proxyMetrics {
+	return &proxyMetrics{
+		requests:     make(map[string]int64),
+		bucketCounts: make([]int64, len(latencyBuckets)),
+	}
+}
+
+// observe records one finished request
+func (m *proxyMetrics) observe(status int, duration time.Duration) {
+	class := fmt.Sprintf("%dxx", status/100)
+	seconds := duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[class]++
+	m.latencySum += seconds
+	m.latencyCount++
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			m.bucketCounts[i]++
+			break
+		}
+	}
+}
+
+// wrap records the status and latency of every request served by next
+func (m *proxyMetrics) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		m.observe(rec.status, time.Since(start))
+	})
+}
+
+// transport counts round trips to an upstream that fail without a response
+func (m *proxyMetrics) transport(base http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := base.RoundTrip(req)
+		if err != nil {
+			m.mu.Lock()
+			m.upstreamErrors++
+			m.mu.Unlock()
+		}
+		return resp, err
+	})
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *proxyMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP reverseproxy_requests_total Requests served, by response status class.\n")
+	b.WriteString("# TYPE reverseproxy_requests_total counter\n")
+	classes := make([]string, 0, len(m.requests))
+	for class := range m.requests {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		fmt.Fprintf(&b, "reverseproxy_requests_total{class=%q} %d\n", class, m.requests[class])
+	}
+
+	b.WriteString("# HELP reverseproxy_upstream_errors_total Round trips to an upstream that failed without a response.\n")
+	b.WriteString("# TYPE reverseproxy_upstream_errors_total counter\n")
+	fmt.Fprintf(&b, "reverseproxy_upstream_errors_total %d\n", m.upstreamErrors)
+
+	b.WriteString("# HELP reverseproxy_request_duration_seconds End-to-end request latency.\n")
+	b.WriteString("# TYPE reverseproxy_request_duration_seconds histogram\n")
+	var cumulative int64
+	for i, bound := range latencyBuckets {
+		cumulative += m.bucketCounts[i]
+		fmt.Fprintf(&b, "reverseproxy_request_duration_seconds_bucket{le=\"%g\"} %d\n", bound, cumulative)
+	}
+	fmt.Fprintf(&b, "reverseproxy_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	fmt.Fprintf(&b, "reverseproxy_request_duration_seconds_sum %g\n", m.latencySum)
+	fmt.Fprintf(&b, "reverseproxy_request_duration_seconds_count %d\n", m.latencyCount)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// statusRecorder remembers the status code written by a handler. Unwrap lets
+// http.ResponseController reach the original writer, so streamed responses
+// are still flushed.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,174 @@
+package main
+
+/**
+Service fingerprinting (heuristic)
+
+Once a port is known to be open, we try to guess what is listening on it:
+
+HTTP ports: send a HEAD request and read the Server header
+(e.g. "Apache/2.4.49 (Unix)").
+Everything else: connect and read whatever the service sends first.
+SSH ("SSH-2.0-OpenSSH_8.9p1"), FTP ("220 (vsFTPd 2.3.4)") and SMTP
+("220 mail ESMTP Exim 4.89") all announce themselves this way.
+
+The software name and version are pulled out of the banner with a regex and
+compared against a small built-in list of versions with well-known
+vulnerabilities. Banners can be hidden or faked, and backported patches keep
+the old version string, so every result is best-effort and labeled as such.
+*/
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fingerprint is the best guess about what is running on an open port
+type Fingerprint struct {
+	Port     int      `json:"port"`
+	Service  string   `json:"service"`
+	Banner   string   `json:"banner,omitempty"`
+	Software string   `json:"software,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// httpPorts are probed with an HTTP request; tlsPorts are wrapped in TLS first
+var httpPorts = map[int]bool{80: true, 443: true, 8000: true, 8080: true, 8443: true}
+var tlsPorts = map[int]bool{443: true, 8443: true}
+
+// knownVulnerable maps a banner fragment to the issue associated with it
+var knownVulnerable = []struct {
+	Match    string
+	Advisory string
+}{
+	{"Apache/2.4.49", "CVE-2021-41773 path traversal / RCE"},
+	{"Apache/2.4.50", "CVE-2021-42013 path traversal / RCE"},
+	{"vsFTPd 2.3.4", "backdoored release (CVE-2011-2523)"},
+	{"ProFTPD 1.3.5", "CVE-2015-3306 mod_copy arbitrary file copy"},
+	{"OpenSSH_7.2", "CVE-2016-6210 user enumeration"},
+	{"OpenSSH_7.4", "CVE-2018-15473 user enumeration"},
+	{"Exim 4.87", "CVE-2019-10149 remote command execution"},
+	{"Exim 4.89", "CVE-2019-10149 remote command execution"},
+	{"Exim 4.91", "CVE-2019-10149 remote command execution"},
+	{"nginx/1.20.0", "CVE-2021-23017 resolver off-by-one"},
+	{"Microsoft-IIS/6.0", "CVE-2017-7269 WebDAV buffer overflow"},
+}
+
+// versionRegex finds "name/1.2.3", "name_1.2p1" or "name 1.2.3" in a banner
+var versionRegex = regexp.MustCompile(`([A-Za-z][\w-]*)[/_ ]v?(\d+(?:\.\d+)+\w*)`)
+
+/*
+*
+Connects to the port and collects a banner. HTTP ports get a HEAD request and
+the Server header is used; other ports are read for up to 2 seconds for a
+greeting line.
+*/
+func fingerprintPort(hostname string, port int) Fingerprint {
+	fp := Fingerprint{Port: port, Service: guessService(port)}
+	address := net.JoinHostPort(hostname, strconv.Itoa(port))
+
+	var conn net.Conn
+	var err error
+	if tlsPorts[port] {
+		dialer := &net.Dialer{Timeout: 2 * time.Second}
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{InsecureSkipVerify: true})
+	} else {
+		conn, err = net.DialTimeout("tcp", address, 2*time.Second)
+	}
+	if err != nil {
+		return fp
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	if httpPorts[port] {
+		fmt.Fprintf(conn, "HEAD / HTTP/1.0\r\nHost: %s\r\n\r\n", hostname)
+		for {
+			line, err := reader.ReadString('\n')
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(strings.ToLower(line), "server:") {
+				fp.Banner = strings.TrimSpace(line[len("server:"):])
+				break
+			}
+			if err != nil || line == "" {
+				break
+			}
+		}
+	} else {
+		line, _ := reader.ReadString('\n')
+		fp.Banner = strings.TrimSpace(line)
+	}
+
+	if fp.Banner == "" {
+		return fp
+	}
+	if strings.HasPrefix(fp.Banner, "SSH-") {
+		fp.Service = "ssh"
+	}
+	if m := versionRegex.FindStringSubmatch(fp.Banner); m != nil {
+		fp.Software = m[1]
+		fp.Version = m[2]
+	}
+	for _, vuln := range knownVulnerable {
+		if strings.Contains(fp.Banner, vuln.Match) {
+			fp.Warnings = append(fp.Warnings, fmt.Sprintf("%s: %s", vuln.Match, vuln.Advisory))
+		}
+	}
+	return fp
+}
+
+// guessService names the service usually found on a well-known port
+func guessService(port int) string {
+	switch port {
+	case 21:
+		return "ftp"
+	case 22:
+		return "ssh"
+	case 25, 587:
+		return "smtp"
+	case 80, 8000, 8080:
+		return "http"
+	case 443, 8443:
+		return "https"
+	case 110:
+		return "pop3"
+	case 143:
+		return "imap"
+	case 3306:
+		return "mysql"
+	}
+	return "unknown"
+}
+
+// reportFingerprints fingerprints every open port, prints a summary and
+// returns the fingerprints for the scan report
+func reportFingerprints(hostname string, ports []int) []Fingerprint {
+	if len(ports) == 0 {
+		return nil
+	}
+	fmt.Println("\nService fingerprints (heuristic, best-effort):")
+	var fingerprints []Fingerprint
+	for _, port := range ports {
+		fp := fingerprintPort(hostname, port)
+		fingerprints = append(fingerprints, fp)
+		switch {
+		case fp.Software != "":
+			fmt.Printf("Port %d (%s): likely %s %s\n", fp.Port, fp.Service, fp.Software, fp.Version)
+		case fp.Banner != "":
+			fmt.Printf("Port %d (%s): banner %q\n", fp.Port, fp.Service, fp.Banner)
+		default:
+			fmt.Printf("Port %d (%s): no banner\n", fp.Port, fp.Service)
+		}
+		for _, warning := range fp.Warnings {
+			fmt.Printf("  [possible vulnerability] %s\n", warning)
+		}
+	}
+	return fingerprints
+}
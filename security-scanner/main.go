@@ -35,13 +35,31 @@ fmt: Provides formatted I/O operations like printing to the console.
 net: Offers networking utilities to handle TCP and other connections.
 os: Manages OS-level operations like reading environment variables or exiting programs.
 time: Adds support for time-related functionality like delays or timeouts
+strconv: Converts port numbers to strings when building addresses.
+errors, syscall: Used to recognise "connection refused" when classifying ports.
+flag: Reads the -report-url and -report-token options.
 */
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
+// PortState is the result of scanning one port
+type PortState string
+
+const (
+	PortOpen     PortState = "open"
+	PortClosed   PortState = "closed"
+	PortFiltered PortState = "filtered"
+)
+
 /*
 *
 Inputs:
@@ -52,19 +70,35 @@ port: Port number to check.
 Functionality:
 
 Creates an address string in the form of hostname:port (e.g., 127.0.0.1:80).
-Attempts to connect to the address using net.DialTimeout. If successful,
-it means the port is open.
-Returns true if the connection succeeds, otherwise false.
+Attempts to connect to the address using net.DialTimeout and classifies the result:
+
+open: the connection succeeded.
+closed: the host answered with a reset (connection refused), so it is
+reachable but nothing listens on the port.
+filtered: no answer before the timeout, or the host/network was reported
+unreachable. A firewall is most likely dropping the packets.
+
 Timeout: A timeout of 1 second is set to prevent indefinite blocking.
 */
-func scanPort(protocol, hostname string, port int) bool {
-	address := fmt.Sprintf("%s:%d", hostname, port)
+func scanPort(protocol, hostname string, port int) PortState {
+	address := net.JoinHostPort(hostname, strconv.Itoa(port))
 	conn, err := net.DialTimeout(protocol, address, 1*time.Second)
 	if err != nil {
-		return false
+		return classifyDialError(err)
 	}
 	defer conn.Close()
-	return true
+	return PortOpen
+}
+
+// classifyDialError tells a refused connection (closed) apart from a
+// timeout or unreachable error (filtered)
+func classifyDialError(err error) PortState {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return PortClosed
+	}
+	// Timeouts, and host/network unreachable errors, which usually come
+	// from a firewall rejecting the packet
+	return PortFiltered
 }
 
 /*
@@ -72,14 +106,49 @@ func scanPort(protocol, hostname string, port int) bool {
 Loops through port numbers from 1 to 1024 (common ports).
 Calls scanPort for each port.
 If a port is open, it prints a message indicating the port is open.
+Closed and filtered ports are counted and summarized at the end, with the
+filtered ports listed since they point at firewall rules.
+Returns the open and filtered ports and the number of closed ones, so the
+open ports can be fingerprinted afterwards and everything can go into the
+scan report.
 */
-func portScan(hostname string) {
+func portScan(hostname string) (open, filtered []int, closed int) {
 	fmt.Printf("Scanning ports on %s...\n", hostname)
 	for port := 1; port <= 1024; port++ {
-		if scanPort("tcp", hostname, port) {
+		switch scanPort("tcp", hostname, port) {
+		case PortOpen:
 			fmt.Printf("Port %d is open\n", port)
+			open = append(open, port)
+		case PortClosed:
+			closed++
+		case PortFiltered:
+			filtered = append(filtered, port)
 		}
 	}
+
+	fmt.Printf("%d open, %d closed, %d filtered\n", len(open), closed, len(filtered))
+	if len(filtered) > 0 {
+		fmt.Printf("Filtered ports: %s\n", formatPorts(filtered))
+	}
+	return open, filtered, closed
+}
+
+// formatPorts joins ports into a list, collapsing consecutive runs (e.g. 1-20,22,80)
+func formatPorts(ports []int) string {
+	var parts []string
+	for i := 0; i < len(ports); {
+		j := i
+		for j+1 < len(ports) && ports[j+1] == ports[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(ports[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", ports[i], ports[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
 }
 
 /*
@@ -94,17 +163,19 @@ Attempts to connect to hostname:27017.
 If the connection is successful, it warns that MongoDB may lack proper
 authentication.
 If the connection fails, it indicates MongoDB is not accessible.
+Returns whether MongoDB was reachable.
 */
-func checkMongoDB(hostname string) {
-	address := fmt.Sprintf("%s:%d", hostname, 27017)
+func checkMongoDB(hostname string) bool {
+	address := net.JoinHostPort(hostname, "27017")
 	conn, err := net.DialTimeout("tcp", address, 2*time.Second)
 	if err != nil {
 		fmt.Println("MongoDB not accessible")
-		return
+		return false
 	}
 	defer conn.Close()
 
 	fmt.Println("MongoDB is accessible without authentication!")
+	return true
 }
 
 /*
@@ -130,17 +201,33 @@ func concurrentPortScan(hostname string, ports []int) {
 		sem <- true
 		go func(port int) {
 			defer func() { <-sem }()
-			if scanPort("tcp", hostname, port) {
-				fmt.Printf("Port %d is open\n", port)
-			}
+			fmt.Printf("Port %d is %s\n", port, scanPort("tcp", hostname, port))
 		}(port)
 	}
 }
 
 func main() {
+	reportURL := flag.String("report-url", "", "Collector URL to POST the JSON scan report to (empty = print only)")
+	reportToken := flag.String("report-token", "", "Bearer token for -report-url (default $SCANNER_REPORT_TOKEN)")
+	flag.Parse()
+
+	// Read after parsing so the token is never shown as a default by -h
+	if *reportToken == "" {
+		*reportToken = os.Getenv("SCANNER_REPORT_TOKEN")
+	}
+
 	hostname := "127.0.0.1" // Replace with target
+	report := ScanReport{Target: hostname, PortRange: "1-1024", StartedAt: time.Now().UTC()}
+	report.ScannerHost, _ = os.Hostname()
+
 	fmt.Println("Starting security scan...")
-	portScan(hostname)
-	checkMongoDB(hostname)
+	report.OpenPorts, report.FilteredPorts, report.ClosedPorts = portScan(hostname)
+	report.Services = reportFingerprints(hostname, report.OpenPorts)
+	report.MongoDBExposed = checkMongoDB(hostname)
+	report.FinishedAt = time.Now().UTC()
 	fmt.Println("Scan completed.")
+
+	if *reportURL != "" {
+		uploadReport(report, *reportURL, *reportToken)
+	}
 }
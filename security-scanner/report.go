@@ -0,0 +1,117 @@
+package main
+
+/**
+Report upload
+
+With -report-url the results of a scan are also POSTed as JSON to a
+collector, so scans from many machines can be aggregated in one place:
+
+	{"target":"127.0.0.1","scanner_host":"build-01","started_at":"...",
+	 "finished_at":"...","port_range":"1-1024","open_ports":[22,80],
+	 "closed_ports":1020,"filtered_ports":[],"services":[...],
+	 "mongodb_exposed":false}
+
+-report-token (or the SCANNER_REPORT_TOKEN environment variable, which keeps
+the token out of the process list) is sent as "Authorization: Bearer <token>".
+
+The upload happens after everything has been printed, so the local output is
+never affected. Network errors and 5xx/429 answers are retried up to
+reportAttempts times with a growing delay; if the upload still fails the
+report is written to a local file that can be sent again later.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// reportAttempts is how many times an upload is tried before giving up
+const reportAttempts = 3
+
+// ScanReport is the structured result of one scan
+type ScanReport struct {
+	Target         string        `json:"target"`
+	ScannerHost    string        `json:"scanner_host"`
+	StartedAt      time.Time     `json:"started_at"`
+	FinishedAt     time.Time     `json:"finished_at"`
+	PortRange      string        `json:"port_range"`
+	OpenPorts      []int         `json:"open_ports"`
+	ClosedPorts    int           `json:"closed_ports"`
+	FilteredPorts  []int         `json:"filtered_ports"`
+	Services       []Fingerprint `json:"services"`
+	MongoDBExposed bool          `json:"mongodb_exposed"`
+}
+
+// uploadReport sends the report to url, retrying transient failures, and
+// falls back to saving it locally
+func uploadReport(report ScanReport, url, token string) {
+	// Send empty lists as [] rather than null
+	if report.OpenPorts == nil {
+		report.OpenPorts = []int{}
+	}
+	if report.FilteredPorts == nil {
+		report.FilteredPorts = []int{}
+	}
+	if report.Services == nil {
+		report.Services = []Fingerprint{}
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		fmt.Printf("Could not encode scan report: %v\n", err)
+		return
+	}
+
+	delay := 2 * time.Second
+	for attempt := 1; ; attempt++ {
+		retry, err := postReport(url, token, body)
+		if err == nil {
+			fmt.Printf("Scan report uploaded to %s\n", url)
+			return
+		}
+		fmt.Printf("Report upload attempt %d/%d failed: %v\n", attempt, reportAttempts, err)
+		if !retry || attempt >= reportAttempts {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	path := fmt.Sprintf("scan-report-%s.json", report.FinishedAt.Format("20060102-150405"))
+	if err := os.WriteFile(path, body, 0644); err != nil {
+		fmt.Printf("Could not save scan report: %v\n", err)
+		return
+	}
+	fmt.Printf("Scan report saved to %s\n", path)
+}
+
+// postReport makes one upload attempt; retry reports whether a failure is
+// worth trying again (network errors, rate limiting and server errors)
+func postReport(url, token string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("collector returned %s", resp.Status)
+}
@@ -9,31 +9,780 @@ ReverseProxy which helps in proxying requests to other servers.
 net/url: Provides URL parsing and manipulation functions.
 strings: Provides functions for string manipulation
 (used here for checking URL paths).
+bytes, io, encoding/json, sync, time: Used by the retry logic to replay request
+bodies, guard the retry budget and report it on the admin endpoint.
+flag, fmt, os, net, sort, math/rand: Used to load, validate and dry-run the
+routing config, match client CIDRs and pick weighted upstreams.
+context and the go.opentelemetry.io/otel packages: Used to trace requests
+and export the spans to an OpenTelemetry collector.
 */
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// url.Parse to create URL objects from strings.
-func main() {
-	// Define the upstream services
-	service1URL, err := url.Parse("http://localhost:8081")
+/*
+*
+Retry budget:
+Retrying failed requests hides short blips, but when an upstream is down for
+everyone, every request turns into several and the load on the failing
+service multiplies (a retry storm).
+
+The budget is a token bucket. Every original request deposits ratio tokens
+(0.1 = one retry allowed per ten requests) and every retry withdraws one
+whole token. When the bucket is empty retries are skipped and the original
+failure is returned, so retries can never exceed roughly ratio * requests.
+maxTokens caps how many retries can be saved up during quiet periods.
+*/
+type retryBudget struct {
+	mu        sync.Mutex
+	ratio     float64
+	maxTokens float64
+	tokens    float64
+
+	requests      int64
+	retries       int64
+	retriesDenied int64
+}
+
+func newRetryBudget(ratio, maxTokens float64) *retryBudget {
+	return &retryBudget{ratio: ratio, maxTokens: maxTokens}
+}
+
+// deposit records an original request and adds its share of retry tokens
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests++
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// withdraw takes one token for a retry, returning false if the budget is spent
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		b.retriesDenied++
+		return false
+	}
+	b.tokens--
+	b.retries++
+	return true
+}
+
+// snapshot returns the current budget consumption for the admin endpoint
+func (b *retryBudget) snapshot() map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	retryRatio := 0.0
+	if b.requests > 0 {
+		retryRatio = float64(b.retries) / float64(b.requests)
+	}
+	return map[string]interface{}{
+		"ratio":          b.ratio,
+		"tokens":         b.tokens,
+		"max_tokens":     b.maxTokens,
+		"requests":       b.requests,
+		"retries":        b.retries,
+		"retries_denied": b.retriesDenied,
+		"retry_ratio":    retryRatio,
+	}
+}
+
+/*
+*
+retryTransport retries idempotent requests that fail with a connection error
+or a 502/503, up to maxRetries times, as long as the shared budget allows it.
+The body is buffered so it can be sent again on each attempt; a body larger
+than maxBody is not, and its request is sent once without retries.
+*/
+type retryTransport struct {
+	base       http.RoundTripper
+	budget     *retryBudget
+	maxRetries int
+	backoff    time.Duration
+	maxBody    int64
+}
+
+// maxRetryBody is the largest request body kept in memory for retries
+const maxRetryBody = 1 << 20
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.budget.deposit()
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+	default:
+		return t.base.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(req.Body, t.maxBody+1))
+		if err != nil {
+			req.Body.Close()
+			return nil, err
+		}
+		if int64(len(body)) > t.maxBody {
+			// Too large to keep: send what was read and the rest, once
+			outReq := req.Clone(req.Context())
+			outReq.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+			return t.base.RoundTrip(outReq)
+		}
+		req.Body.Close()
+	}
+
+	for attempt := 0; ; attempt++ {
+		outReq := req.Clone(req.Context())
+		if body != nil {
+			outReq.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err := t.base.RoundTrip(outReq)
+		failed := err != nil || resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+		if !failed || attempt >= t.maxRetries {
+			return resp, err
+		}
+		if !t.budget.withdraw() {
+			log.Printf("Retry budget exhausted, not retrying %s %s", req.Method, req.URL)
+			return resp, err
+		}
+
+		log.Printf("Retrying %s %s (attempt %d/%d)", req.Method, req.URL, attempt+1, t.maxRetries)
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(t.backoff * time.Duration(1<<attempt)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+/*
+*
+Routing config:
+Routes are loaded from a JSON file given with -config. Each route maps a path
+prefix to one or more weighted upstreams and can optionally restrict which
+client networks may use it:
+
+	{
+	  "routes": [
+	    {"prefix": "/service1", "upstreams": [{"url": "http://localhost:8081", "weight": 1}]},
+	    {"prefix": "/service2", "upstreams": [{"url": "http://localhost:8082", "weight": 1}],
+	     "allow_cidrs": ["10.0.0.0/8", "127.0.0.1/32"]}
+	  ]
+	}
+
+Without -config the two built-in services below are used.
+
+Fault injection (for chaos testing) is off unless a route has a "fault" block.
+A share of the route's requests can be delayed, failed with a status code, or both:
+
+	"fault": {"delay": "2s", "delay_percent": 10, "abort_status": 503, "abort_percent": 5}
+
+Aborted requests never reach the upstream, so real backends are not affected.
+
+Outlier detection is on by default. An upstream whose error rate (connection
+errors and 5xx) reaches error_rate over at least min_requests requests within
+interval is ejected from the route for ejection_time, then re-admitted. Each
+route can tune or disable it:
+
+	"outlier_detection": {"error_rate": 0.5, "min_requests": 5, "interval": "10s", "ejection_time": "30s"}
+	"outlier_detection": {"disabled": true}
+*/
+type Upstream struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+type Route struct {
+	Prefix     string       `json:"prefix"`
+	Upstreams  []Upstream   `json:"upstreams"`
+	AllowCIDRs []string     `json:"allow_cidrs"`
+	Fault      *FaultConfig `json:"fault,omitempty"`
+
+	OutlierDetection *OutlierConfig `json:"outlier_detection,omitempty"`
+}
+
+// OutlierConfig tunes outlier detection for a route; zero values use the defaults
+type OutlierConfig struct {
+	Disabled     bool    `json:"disabled"`
+	ErrorRate    float64 `json:"error_rate"`
+	MinRequests  int     `json:"min_requests"`
+	Interval     string  `json:"interval"`
+	EjectionTime string  `json:"ejection_time"`
+}
+
+// defaultOutlierConfig is used for routes without an outlier_detection block
+var defaultOutlierConfig = OutlierConfig{ErrorRate: 0.5, MinRequests: 5, Interval: "10s", EjectionTime: "30s"}
+
+// withDefaults fills unset fields from defaultOutlierConfig
+func (c *OutlierConfig) withDefaults() OutlierConfig {
+	if c == nil {
+		return defaultOutlierConfig
+	}
+	merged := *c
+	if merged.ErrorRate == 0 {
+		merged.ErrorRate = defaultOutlierConfig.ErrorRate
+	}
+	if merged.MinRequests == 0 {
+		merged.MinRequests = defaultOutlierConfig.MinRequests
+	}
+	if merged.Interval == "" {
+		merged.Interval = defaultOutlierConfig.Interval
+	}
+	if merged.EjectionTime == "" {
+		merged.EjectionTime = defaultOutlierConfig.EjectionTime
+	}
+	return merged
+}
+
+// FaultConfig describes the faults injected into a route; percentages are 0-100
+type FaultConfig struct {
+	Delay        string  `json:"delay"`
+	DelayPercent float64 `json:"delay_percent"`
+	AbortStatus  int     `json:"abort_status"`
+	AbortPercent float64 `json:"abort_percent"`
+}
+
+type RoutingConfig struct {
+	Routes []Route `json:"routes"`
+}
+
+// defaultRoutingConfig mirrors the original hard-coded services
+func defaultRoutingConfig() RoutingConfig {
+	return RoutingConfig{Routes: []Route{
+		{Prefix: "/service1", Upstreams: []Upstream{{URL: "http://localhost:8081", Weight: 1}}},
+		{Prefix: "/service2", Upstreams: []Upstream{{URL: "http://localhost:8082", Weight: 1}}},
+	}}
+}
+
+func loadRoutingConfig(path string) (RoutingConfig, error) {
+	var config RoutingConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return config, nil
+}
+
+/*
+*
+validateRoutingConfig checks a config before it is used and returns every
+problem found rather than stopping at the first:
+- each route has a prefix starting with "/" and no two routes share a prefix
+- each route has at least one upstream with an absolute http(s) URL
+- weights are not negative and at least one upstream per route has weight > 0
+- every allow_cidrs entry parses as a CIDR
+- fault percentages are 0-100, delays parse and abort statuses are valid
+- outlier error_rate is 0-1, min_requests is not negative and durations parse
+*/
+func validateRoutingConfig(config RoutingConfig) []string {
+	var problems []string
+	if len(config.Routes) == 0 {
+		problems = append(problems, "no routes defined")
+	}
+
+	seen := make(map[string]bool)
+	for i, route := range config.Routes {
+		name := fmt.Sprintf("route %d (%s)", i+1, route.Prefix)
+		if !strings.HasPrefix(route.Prefix, "/") {
+			problems = append(problems, fmt.Sprintf("%s: prefix must start with \"/\"", name))
+		}
+		if seen[route.Prefix] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate prefix", name))
+		}
+		seen[route.Prefix] = true
+
+		if len(route.Upstreams) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: no upstreams", name))
+		}
+		totalWeight := 0
+		for _, upstream := range route.Upstreams {
+			u, err := url.Parse(upstream.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("%s: invalid upstream URL %q", name, upstream.URL))
+			}
+			if upstream.Weight < 0 {
+				problems = append(problems, fmt.Sprintf("%s: negative weight %d for %s", name, upstream.Weight, upstream.URL))
+			}
+			totalWeight += upstream.Weight
+		}
+		if len(route.Upstreams) > 0 && totalWeight <= 0 {
+			problems = append(problems, fmt.Sprintf("%s: all upstream weights are zero", name))
+		}
+
+		for _, cidr := range route.AllowCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid CIDR %q", name, cidr))
+			}
+		}
+
+		if fault := route.Fault; fault != nil {
+			if fault.DelayPercent < 0 || fault.DelayPercent > 100 || fault.AbortPercent < 0 || fault.AbortPercent > 100 {
+				problems = append(problems, fmt.Sprintf("%s: fault percentages must be between 0 and 100", name))
+			}
+			if fault.DelayPercent > 0 {
+				if delay, err := time.ParseDuration(fault.Delay); err != nil || delay <= 0 {
+					problems = append(problems, fmt.Sprintf("%s: invalid fault delay %q", name, fault.Delay))
+				}
+			}
+			if fault.AbortPercent > 0 && (fault.AbortStatus < 100 || fault.AbortStatus > 599) {
+				problems = append(problems, fmt.Sprintf("%s: invalid fault abort_status %d", name, fault.AbortStatus))
+			}
+		}
+
+		outlier := route.OutlierDetection.withDefaults()
+		if outlier.ErrorRate < 0 || outlier.ErrorRate > 1 {
+			problems = append(problems, fmt.Sprintf("%s: outlier error_rate must be between 0 and 1", name))
+		}
+		if outlier.MinRequests < 0 {
+			problems = append(problems, fmt.Sprintf("%s: outlier min_requests must not be negative", name))
+		}
+		for _, d := range []string{outlier.Interval, outlier.EjectionTime} {
+			if duration, err := time.ParseDuration(d); err != nil || duration <= 0 {
+				problems = append(problems, fmt.Sprintf("%s: invalid outlier duration %q", name, d))
+			}
+		}
+	}
+	return problems
+}
+
+/*
+*
+upstreamHealth tracks one upstream's requests and failures over the current
+interval. When the error rate crosses the threshold the upstream is ejected
+until ejectedUntil, and the counters start over once it is back.
+*/
+type upstreamHealth struct {
+	url          string
+	enabled      bool
+	errorRate    float64
+	minRequests  int
+	interval     time.Duration
+	ejectionTime time.Duration
+
+	mu           sync.Mutex
+	windowStart  time.Time
+	requests     int
+	failures     int
+	ejectedUntil time.Time
+	ejections    int
+}
+
+func newUpstreamHealth(url string, config OutlierConfig) *upstreamHealth {
+	interval, _ := time.ParseDuration(config.Interval)
+	ejectionTime, _ := time.ParseDuration(config.EjectionTime)
+	return &upstreamHealth{
+		url:          url,
+		enabled:      !config.Disabled,
+		errorRate:    config.ErrorRate,
+		minRequests:  config.MinRequests,
+		interval:     interval,
+		ejectionTime: ejectionTime,
+		windowStart:  time.Now(),
+	}
+}
+
+// record counts a finished request and ejects the upstream if it is failing too often
+func (h *upstreamHealth) record(failed bool) {
+	if !h.enabled {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(h.windowStart) > h.interval {
+		h.windowStart, h.requests, h.failures = now, 0, 0
+	}
+	h.requests++
+	if failed {
+		h.failures++
+	}
+
+	if now.Before(h.ejectedUntil) || h.requests < h.minRequests {
+		return
+	}
+	if rate := float64(h.failures) / float64(h.requests); rate >= h.errorRate {
+		h.ejectedUntil = now.Add(h.ejectionTime)
+		h.ejections++
+		log.Printf("Outlier detection: ejecting %s for %s (%d/%d requests failed)", h.url, h.ejectionTime, h.failures, h.requests)
+		h.windowStart, h.requests, h.failures = h.ejectedUntil, 0, 0
+	}
+}
+
+// available reports whether the upstream may receive traffic
+func (h *upstreamHealth) available(now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !now.Before(h.ejectedUntil)
+}
+
+// snapshot returns the upstream's outlier state for the admin endpoint
+func (h *upstreamHealth) snapshot() map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := map[string]interface{}{
+		"url":       h.url,
+		"ejected":   time.Now().Before(h.ejectedUntil),
+		"ejections": h.ejections,
+		"requests":  h.requests,
+		"failures":  h.failures,
+	}
+	if time.Now().Before(h.ejectedUntil) {
+		status["ejected_until"] = h.ejectedUntil.Format(time.RFC3339)
+	}
+	return status
+}
+
+// routeTarget is a validated route ready to serve traffic
+type routeTarget struct {
+	route     Route
+	proxies   []*httputil.ReverseProxy
+	health    []*upstreamHealth
+	weights   []int
+	networks  []*net.IPNet
+	total     int
+	delay     time.Duration
+	randMutex sync.Mutex
+	rand      *rand.Rand
+}
+
+// roll returns true for roughly percent out of every 100 calls
+func (t *routeTarget) roll(percent float64) bool {
+	if percent <= 0 {
+		return false
+	}
+	t.randMutex.Lock()
+	defer t.randMutex.Unlock()
+	return t.rand.Float64()*100 < percent
+}
+
+/*
+*
+injectFault applies the route's fault config to a request. A delay is waited
+out first (or cut short if the client goes away); then, if the request is
+picked for an abort, the error status is written and true is returned so the
+caller skips the upstream. Both faults can hit the same request.
+*/
+func (t *routeTarget) injectFault(w http.ResponseWriter, r *http.Request) bool {
+	fault := t.route.Fault
+	if fault == nil {
+		return false
+	}
+	if t.roll(fault.DelayPercent) {
+		log.Printf("Fault injection: delaying %s %s by %s", r.Method, r.URL.Path, t.delay)
+		select {
+		case <-time.After(t.delay):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+	if t.roll(fault.AbortPercent) {
+		log.Printf("Fault injection: aborting %s %s with %d", r.Method, r.URL.Path, fault.AbortStatus)
+		w.Header().Set("X-Fault-Injected", "abort")
+		http.Error(w, http.StatusText(fault.AbortStatus), fault.AbortStatus)
+		return true
+	}
+	return false
+}
+
+// pick chooses an upstream proxy at random, in proportion to its weight,
+// skipping ejected upstreams. If every upstream is ejected, all of them are
+// used again rather than failing the route outright.
+func (t *routeTarget) pick() *httputil.ReverseProxy {
+	now := time.Now()
+	weights := make([]int, len(t.weights))
+	total := 0
+	for i, weight := range t.weights {
+		if t.health[i].available(now) {
+			weights[i] = weight
+			total += weight
+		}
+	}
+	if total == 0 {
+		copy(weights, t.weights)
+		total = t.total
+	}
+
+	t.randMutex.Lock()
+	n := t.rand.Intn(total)
+	t.randMutex.Unlock()
+	for i, weight := range weights {
+		if n < weight {
+			return t.proxies[i]
+		}
+		n -= weight
+	}
+	return t.proxies[len(t.proxies)-1]
+}
+
+// allows reports whether the client address may use this route
+func (t *routeTarget) allows(remoteAddr string) bool {
+	if len(t.networks) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
 	if err != nil {
-		log.Fatal("Error parsing Service 1 URL:", err)
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	for _, network := range t.networks {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildRoutes turns a validated config into route targets, longest prefix first
+func buildRoutes(config RoutingConfig, transport http.RoundTripper) []*routeTarget {
+	var targets []*routeTarget
+	for _, route := range config.Routes {
+		target := &routeTarget{route: route, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+		outlier := route.OutlierDetection.withDefaults()
+		for _, upstream := range route.Upstreams {
+			u, _ := url.Parse(upstream.URL)
+			health := newUpstreamHealth(upstream.URL, outlier)
+			proxy := httputil.NewSingleHostReverseProxy(u)
+			proxy.Transport = transport
+
+			// Count every response and error towards the upstream's error rate
+			proxy.ModifyResponse = func(resp *http.Response) error {
+				health.record(resp.StatusCode >= 500)
+				return nil
+			}
+			proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+				health.record(true)
+				log.Printf("Proxy error for %s: %v", health.url, err)
+				w.WriteHeader(http.StatusBadGateway)
+			}
+
+			target.proxies = append(target.proxies, proxy)
+			target.health = append(target.health, health)
+			target.weights = append(target.weights, upstream.Weight)
+			target.total += upstream.Weight
+		}
+		for _, cidr := range route.AllowCIDRs {
+			_, network, _ := net.ParseCIDR(cidr)
+			target.networks = append(target.networks, network)
+		}
+		if route.Fault != nil && route.Fault.DelayPercent > 0 {
+			target.delay, _ = time.ParseDuration(route.Fault.Delay)
+		}
+		targets = append(targets, target)
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		return len(targets[i].route.Prefix) > len(targets[j].route.Prefix)
+	})
+	return targets
+}
+
+// outlierStatus lists the outlier state of every upstream, keyed by route prefix
+func outlierStatus(targets []*routeTarget) map[string][]map[string]interface{} {
+	status := make(map[string][]map[string]interface{})
+	for _, target := range targets {
+		for _, health := range target.health {
+			status[target.route.Prefix] = append(status[target.route.Prefix], health.snapshot())
+		}
+	}
+	return status
+}
+
+// matchRoute returns the route with the longest prefix matching path, or nil
+func matchRoute(targets []*routeTarget, path string) *routeTarget {
+	for _, target := range targets {
+		if strings.HasPrefix(path, target.route.Prefix) {
+			return target
+		}
+	}
+	return nil
+}
+
+// printDryRun shows the routes that would be created and how sample paths match
+func printDryRun(targets []*routeTarget, samplePaths []string) {
+	fmt.Println("Routes (matched longest prefix first):")
+	for _, target := range targets {
+		fmt.Printf("  %s\n", target.route.Prefix)
+		for _, upstream := range target.route.Upstreams {
+			share := float64(upstream.Weight) * 100 / float64(target.total)
+			fmt.Printf("    -> %s (weight %d, %.0f%%)\n", upstream.URL, upstream.Weight, share)
+		}
+		if len(target.route.AllowCIDRs) > 0 {
+			fmt.Printf("    allow: %s\n", strings.Join(target.route.AllowCIDRs, ", "))
+		}
+		if fault := target.route.Fault; fault != nil {
+			if fault.DelayPercent > 0 {
+				fmt.Printf("    fault: delay %s on %.0f%% of requests\n", target.delay, fault.DelayPercent)
+			}
+			if fault.AbortPercent > 0 {
+				fmt.Printf("    fault: abort with %d on %.0f%% of requests\n", fault.AbortStatus, fault.AbortPercent)
+			}
+		}
+	}
+
+	fmt.Println("\nSample path matches:")
+	for _, path := range samplePaths {
+		if target := matchRoute(targets, path); target != nil {
+			fmt.Printf("  %-30s -> %s\n", path, target.route.Prefix)
+		} else {
+			fmt.Printf("  %-30s -> 404 (no route)\n", path)
+		}
 	}
-	service2URL, err := url.Parse("http://localhost:8082")
+}
+
+// setupTracing makes otel export spans to the OTLP/HTTP traces URL of an
+// OpenTelemetry collector (e.g. http://localhost:4318/v1/traces) and
+// propagate W3C trace context. Spans are batched by the SDK and sent in the
+// background; while the collector is slow or down, spans beyond the batch
+// queue are dropped rather than slowing requests down.
+//
+// main wraps the router in otelhttp.NewHandler, so an incoming traceparent
+// makes the mesh span a child of the caller's span, and the upstream
+// transport in otelhttp.NewTransport, so every attempt (retries included)
+// gets a client span whose traceparent is sent to the service.
+func setupTracing(ctx context.Context, endpoint, serviceName string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
 	if err != nil {
-		log.Fatal("Error parsing Service 2 URL:", err)
+		return nil, err
 	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider, nil
+}
 
-	// Create reverse proxies for both services
+// spanName names server spans after the matched route rather than the full
+// path, which would give every user ID its own span name
+func spanName(routes []*routeTarget) func(string, *http.Request) string {
+	return func(_ string, r *http.Request) string {
+		if target := matchRoute(routes, r.URL.Path); target != nil {
+			return r.Method + " " + target.route.Prefix
+		}
+		return r.Method + " unmatched"
+	}
+}
 
-	service1Proxy := httputil.NewSingleHostReverseProxy(service1URL)
-	service2Proxy := httputil.NewSingleHostReverseProxy(service2URL)
+// url.Parse to create URL objects from strings.
+func main() {
+	configPath := flag.String("config", "", "Path to a JSON routing config (defaults to the built-in services)")
+	validateOnly := flag.Bool("validate", false, "Validate the routing config and exit")
+	dryRun := flag.Bool("dry-run", false, "Validate, print the routes and sample path matches, then exit")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP traces URL of an OpenTelemetry collector, e.g. http://localhost:4318/v1/traces (empty = tracing off)")
+	serviceName := flag.String("service-name", "service-mesh", "service.name reported with exported spans")
+	samples := flag.String("sample-paths", "", "Comma-separated paths to match in -dry-run (defaults to each prefix plus /unknown)")
+	flag.Parse()
+
+	// Load the routing config
+	config := defaultRoutingConfig()
+	if *configPath != "" {
+		var err error
+		config, err = loadRoutingConfig(*configPath)
+		if err != nil {
+			log.Fatal("Error loading routing config:", err)
+		}
+	}
+
+	// Refuse to start (or report and exit) if the config has problems
+	if problems := validateRoutingConfig(config); len(problems) > 0 {
+		fmt.Println("Routing config is invalid:")
+		for _, problem := range problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+		os.Exit(1)
+	}
+	if *validateOnly && !*dryRun {
+		fmt.Printf("Routing config is valid (%d routes)\n", len(config.Routes))
+		return
+	}
+
+	// Share one retry budget across all services: at most 10% extra load from retries
+	budget := newRetryBudget(0.1, 10)
+	base := http.DefaultTransport
+	if *otlpEndpoint != "" {
+		base = otelhttp.NewTransport(base)
+	}
+	transport := &retryTransport{
+		base:       base,
+		budget:     budget,
+		maxRetries: 2,
+		backoff:    100 * time.Millisecond,
+		maxBody:    maxRetryBody,
+	}
+
+	// Create reverse proxies for every upstream
+	routes := buildRoutes(config, transport)
+
+	if *dryRun {
+		var samplePaths []string
+		if *samples != "" {
+			samplePaths = strings.Split(*samples, ",")
+		} else {
+			for _, route := range config.Routes {
+				samplePaths = append(samplePaths, route.Prefix+"/example")
+			}
+			samplePaths = append(samplePaths, "/unknown")
+		}
+		printDryRun(routes, samplePaths)
+		return
+	}
+
+	if *otlpEndpoint != "" {
+		if _, err := setupTracing(context.Background(), *otlpEndpoint, *serviceName); err != nil {
+			log.Fatal("Error setting up tracing:", err)
+		}
+		log.Printf("Exporting traces to %s", *otlpEndpoint)
+	}
+
+	// Admin endpoint reporting retry budget consumption and ejected upstreams
+	http.HandleFunc("/admin/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"retry_budget": budget.snapshot(),
+			"outliers":     outlierStatus(routes),
+		})
+	})
 
 	// Handle routing based on URL path
 	/**
@@ -44,26 +793,44 @@ func main() {
 	w is the http.ResponseWriter, used to write responses.
 	r is the http.Request, which contains the incoming request data,
 	such as the URL path.
-	strings.HasPrefix(r.URL.Path, "/service1"): We check if the URL path
-	starts with /service1. This is how we route the traffic to Service 1.
+	matchRoute(routes, r.URL.Path): Finds the route with the longest prefix
+	that the path starts with, e.g. /service1/users matches /service1.
+
+	target.allows(r.RemoteAddr): If the route lists allow_cidrs, clients
+	outside those networks get 403 Forbidden.
 
-	If the path starts with /service1, we call service1Proxy.ServeHTTP(w, r),
-	which forwards the request to service1.
-	strings.HasPrefix(r.URL.Path, "/service2"): Similarly, if the path starts
-	with /service2, the request is forwarded to service2.
+	target.injectFault(w, r): If the route has a fault block, some requests are
+	delayed and/or answered with an error status instead of being proxied.
 
-	http.NotFound(w, r): If the path doesn't match /service1 or /service2,
+	target.pick().ServeHTTP(w, r): Picks one of the route's upstreams by weight,
+	skipping upstreams ejected by outlier detection, and forwards the request to it.
+
+	http.NotFound(w, r): If no route prefix matches,
 	we return a 404 error indicating that the requested resource was not found.
+
+	otelhttp.NewHandler(proxy, ...): With tracing on, every request gets a
+	server span named after its route (see setupTracing).
 	*/
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/service1") {
-			service1Proxy.ServeHTTP(w, r)
-		} else if strings.HasPrefix(r.URL.Path, "/service2") {
-			service2Proxy.ServeHTTP(w, r)
-		} else {
+	var proxy http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := matchRoute(routes, r.URL.Path)
+		if target == nil {
 			http.NotFound(w, r)
+			return
 		}
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.route", target.route.Prefix))
+		if !target.allows(r.RemoteAddr) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if target.injectFault(w, r) {
+			return
+		}
+		target.pick().ServeHTTP(w, r)
 	})
+	if *otlpEndpoint != "" {
+		proxy = otelhttp.NewHandler(proxy, "proxy", otelhttp.WithSpanNameFormatter(spanName(routes)))
+	}
+	http.Handle("/", proxy)
 
 	/**
 	http.ListenAndServe(":8080", nil): This starts an HTTP server that listens
@@ -6,22 +6,45 @@ fmt: This is used for formatted I/O, like printing output to the console (fmt.Pr
 log: Provides logging functions. Here it is used to log errors.
 
 os: Provides a platform-independent interface for interacting with the operating system.
-It's included but not used directly in the script. You could use it to handle environment
-variables or input/output redirection.
+It is used to read the inventory file and to exit with a failure status.
+
+encoding/json: Used to parse the inventory file of host groups and commands.
 
 golang.org/x/crypto/ssh: This is the Go SSH package used to establish SSH connections and
 execute commands remotely.
 
-strings: Useful for string manipulation, but it's not used directly in this script.
+strings: Used to split the -forward flag into its local and remote addresses.
 time: Used to set a timeout for SSH connections to avoid indefinite hanging on unreachable
 servers.
+
+context, io, net, sync: Used by the port forwarding tunnel to listen for local
+connections, copy data in both directions and shut everything down when cancelled.
+
+errors, flag: Used to select interactive or forwarding mode and to recognise a
+remote shell's exit status.
+
+os/signal: Stops port forwarding on Ctrl-C.
+
+golang.org/x/term: Puts the local terminal in raw mode for interactive mode and
+reports its size.
 */
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh" //go get -u golang.org/x/crypto/ssh
+	"golang.org/x/term"       //go get -u golang.org/x/term
 )
 
 // Server represents a server to connect to
@@ -32,12 +55,69 @@ Host: The IP address or hostname of the server.
 Port: The SSH port (typically "22").
 Username: The username for SSH login.
 Password: The password for SSH authentication.
+Commands: Optional commands for this host only. When set they replace the
+commands of the host's group.
 */
 type Server struct {
-	Host     string
-	Port     string
-	Username string
-	Password string
+	Host     string   `json:"host"`
+	Port     string   `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Commands []string `json:"commands,omitempty"`
+}
+
+// Inventory of host groups
+/**
+Defines which servers to connect to and what to run on them.
+A HostGroup bundles servers that share an ordered list of commands.
+ContinueOnError: By default a host's sequence stops at the first failing
+command; set it to true to run the remaining commands anyway.
+
+Example inventory.json:
+{
+  "groups": [
+    {
+      "name": "web",
+      "commands": ["uptime", "systemctl is-active nginx"],
+      "servers": [
+        {"host": "192.168.1.1", "port": "22", "username": "user", "password": "password"},
+        {"host": "192.168.1.2", "port": "22", "username": "user", "password": "password",
+         "commands": ["df -h"]}
+      ]
+    }
+  ]
+}
+*/
+type HostGroup struct {
+	Name            string   `json:"name"`
+	Servers         []Server `json:"servers"`
+	Commands        []string `json:"commands"`
+	ContinueOnError bool     `json:"continue_on_error"`
+}
+
+type Inventory struct {
+	Groups []HostGroup `json:"groups"`
+}
+
+// loadInventory reads an inventory from a JSON file
+func loadInventory(path string) (Inventory, error) {
+	var inventory Inventory
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return inventory, err
+	}
+	if err := json.Unmarshal(data, &inventory); err != nil {
+		return inventory, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return inventory, nil
+}
+
+// CommandFailure records which command failed on which host
+type CommandFailure struct {
+	Group   string
+	Host    string
+	Command string
+	Err     error
 }
 
 // SSH connection function
@@ -100,66 +180,377 @@ func executeCommand(client *ssh.Client, cmd string) (string, error) {
 	return string(output), nil
 }
 
-// Automate tasks across multiple servers
+// Forward a local port to a remote address through the SSH connection
 /**
-Purpose: Automates the task of connecting to multiple servers and executing a
-command on each.
+Purpose: Opens a local-forward tunnel, like ssh -L localAddr:remoteAddr.
+Every connection accepted on localAddr is carried over the existing SSH
+connection and connected to remoteAddr as seen from the remote server.
 Steps:
-For Loop: Iterates through each server in the servers slice.
-Connect to server: It calls sshConnect(server) to establish an SSH connection.
-If the connection fails, it logs the error and continues with the next server.
-Execute command: If the connection is successful, it calls
-executeCommand(client, cmd) to execute the specified command on the server.
-If the command execution fails, it logs the error and continues with the
-next server.
-If successful, it prints the command output from the server.
+net.Listen: Listens on localAddr (e.g. "127.0.0.1:5432").
+client.Dial: For each accepted connection, opens a channel through the SSH
+connection to remoteAddr (e.g. "db.internal:5432"). The dial happens in the
+connection's goroutine, so accepting is never blocked by it.
+io.Copy: Copies data in both directions until either side closes.
+Each forwarded connection is handled in its own goroutine, so many clients can
+use the tunnel at once.
+Shutdown: When ctx is cancelled the listener and all open forwarded
+connections are closed, and the function returns once they have finished.
 */
-func automateTasks(servers []Server, cmd string) {
-	for _, server := range servers {
-		fmt.Printf("Connecting to server: %s\n", server.Host)
+func forwardLocalPort(ctx context.Context, client *ssh.Client, localAddr, remoteAddr string) error {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", localAddr, err)
+	}
+	log.Printf("Forwarding %s -> %s\n", localAddr, remoteAddr)
 
-		// Connect to server
-		client, err := sshConnect(server)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	open := make(map[net.Conn]struct{})
+	closed := false
+
+	// track remembers a connection so it can be closed on shutdown
+	track := func(conn net.Conn, add bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !add {
+			delete(open, conn)
+		} else if closed {
+			conn.Close()
+		} else {
+			open[conn] = struct{}{}
+		}
+	}
+
+	// Close the listener and every open connection once ctx is cancelled
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		mu.Lock()
+		closed = true
+		for conn := range open {
+			conn.Close()
+		}
+		mu.Unlock()
+	}()
+
+	for {
+		local, err := listener.Accept()
 		if err != nil {
-			log.Printf("Error connecting to server %s: %v\n", server.Host, err)
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("Error accepting connection on %s: %v\n", localAddr, err)
 			continue
 		}
-		defer client.Close()
 
+		track(local, true)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				local.Close()
+				track(local, false)
+			}()
+
+			// Dial here rather than in the accept loop, so a slow or
+			// unreachable remoteAddr does not hold up other connections
+			remote, err := client.Dial("tcp", remoteAddr)
+			if err != nil {
+				log.Printf("Error dialing %s through SSH: %v\n", remoteAddr, err)
+				return
+			}
+			track(remote, true)
+			defer func() {
+				remote.Close()
+				track(remote, false)
+			}()
+
+			// Copy in both directions; when one side finishes close both
+			done := make(chan struct{}, 2)
+			go func() {
+				io.Copy(remote, local)
+				done <- struct{}{}
+			}()
+			go func() {
+				io.Copy(local, remote)
+				done <- struct{}{}
+			}()
+			<-done
+		}()
+	}
+
+	wg.Wait()
+	log.Printf("Stopped forwarding %s -> %s\n", localAddr, remoteAddr)
+	return nil
+}
+
+// resizeInterval is how often interactive mode checks the local terminal size
+const resizeInterval = 250 * time.Millisecond
+
+// Open an interactive shell on a single server
+/**
+Purpose: A shell-like session against one host, for when a batch command is
+not enough. Typing "exit" (or Ctrl-D) ends the session.
+Steps:
+term.MakeRaw: Puts the local terminal in raw mode so every key press, including
+Ctrl-C and the arrow keys, is sent to the remote shell instead of being handled
+locally. The previous mode is restored when the session ends, even on error.
+session.RequestPty: Asks the server for a pseudo-terminal of the same type
+($TERM) and size as the local one, so editors and pagers work.
+session.Shell: Starts the user's login shell with stdin, stdout and stderr wired
+to the local terminal.
+Resize: The local size is checked every resizeInterval and any change is sent
+with session.WindowChange. Polling rather than waiting for SIGWINCH keeps this
+working on Windows too.
+*/
+func interactiveShell(server Server) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("interactive mode needs a terminal on stdin")
+	}
+
+	client, err := sshConnect(server)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %v", err)
+	}
+	defer session.Close()
+
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		width, height = 80, 24
+	}
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty(termType, height, width, modes); err != nil {
+		return fmt.Errorf("failed to request pty: %v", err)
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to put terminal in raw mode: %v", err)
+	}
+	defer term.Restore(fd, state)
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	if err := session.Shell(); err != nil {
+		return fmt.Errorf("failed to start shell: %v", err)
+	}
+
+	// Forward terminal resizes until the shell exits
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(resizeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w, h, err := term.GetSize(fd)
+				if err != nil || (w == width && h == height) {
+					continue
+				}
+				width, height = w, h
+				session.WindowChange(height, width)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// The shell's exit status is that of its last command, not a failure
+	// of the session itself
+	err = session.Wait()
+	var exitErr *ssh.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+	return nil
+}
+
+// findServer looks up a host in the inventory to reuse its credentials
+func findServer(inventory Inventory, host string) (Server, bool) {
+	for _, group := range inventory.Groups {
+		for _, server := range group.Servers {
+			if server.Host == host {
+				return server, true
+			}
+		}
+	}
+	return Server{}, false
+}
+
+// Automate tasks across multiple servers
+/**
+Purpose: Automates the task of connecting to every server in the inventory and
+running its sequence of commands.
+Steps:
+For Loop: Iterates through each group, then each server in the group.
+Commands: A server uses its own commands if it has any, otherwise its group's.
+Connect to server: It calls sshConnect(server) to establish an SSH connection.
+If the connection fails, it records the failure and continues with the next server.
+Execute commands: Runs each command in order with executeCommand(client, cmd)
+and prints its output. When a command fails the rest of that host's sequence
+is skipped, unless the group sets ContinueOnError.
+Returns every failure so the caller can report which command failed on which host.
+*/
+func automateTasks(inventory Inventory) []CommandFailure {
+	var failures []CommandFailure
+	for _, group := range inventory.Groups {
+		for _, server := range group.Servers {
+			commands := group.Commands
+			if len(server.Commands) > 0 {
+				commands = server.Commands
+			}
+			failures = append(failures, runSequence(group, server, commands)...)
+		}
+	}
+	return failures
+}
+
+// runSequence runs a host's commands in order over a single connection
+func runSequence(group HostGroup, server Server, commands []string) []CommandFailure {
+	var failures []CommandFailure
+	fmt.Printf("Connecting to server: %s\n", server.Host)
+
+	// Connect to server
+	client, err := sshConnect(server)
+	if err != nil {
+		log.Printf("Error connecting to server %s: %v\n", server.Host, err)
+		return append(failures, CommandFailure{Group: group.Name, Host: server.Host, Command: "(connect)", Err: err})
+	}
+	defer client.Close()
+
+	for i, cmd := range commands {
 		// Execute command on server
 		output, err := executeCommand(client, cmd)
 		if err != nil {
-			log.Printf("Error executing command on server %s: %v\n", server.Host, err)
+			log.Printf("Error executing command %q on server %s: %v\n", cmd, server.Host, err)
+			failures = append(failures, CommandFailure{Group: group.Name, Host: server.Host, Command: cmd, Err: err})
+			if !group.ContinueOnError {
+				if remaining := len(commands) - i - 1; remaining > 0 {
+					fmt.Printf("Skipping %d remaining command(s) on %s\n", remaining, server.Host)
+				}
+				break
+			}
 			continue
 		}
 
 		// Print the output
-		fmt.Printf("Output from server %s:\n%s\n", server.Host, output)
+		fmt.Printf("Output of %q from server %s:\n%s\n", cmd, server.Host, output)
+	}
+	return failures
+}
+
+// reportFailures prints a summary of failed commands per host
+func reportFailures(failures []CommandFailure) {
+	if len(failures) == 0 {
+		fmt.Println("All commands succeeded.")
+		return
+	}
+	fmt.Println("Failed commands:")
+	for _, failure := range failures {
+		fmt.Printf("  [%s] %s: %q: %v\n", failure.Group, failure.Host, failure.Command, failure.Err)
 	}
 }
 
 /*
 *
 Purpose: The entry point of the program, where you define the servers
-and the command to run.
+and the commands to run.
 Steps:
-Define Servers: The servers slice contains two servers, each with their IP
+Inventory: If a path to an inventory JSON file is given as the first argument
+it is loaded, otherwise a default group is used.
+Interactive mode: With -interactive <host>, an interactive shell is opened on
+that inventory host (using its port and credentials) instead of running the
+command sequences, e.g. go run main.go -interactive 192.168.1.1 inventory.json
+Forwarding mode: With -forward local=remote and -via <host>, a local port is
+forwarded through that inventory host until Ctrl-C (see forwardLocalPort),
+e.g. go run main.go -via 192.168.1.1 -forward 127.0.0.1:5432=db.internal:5432 inventory.json
+Define Servers: The default group contains two servers, each with their IP
 address, SSH port, username, and password. You can add more servers to the list.
-Command: The command to be executed on each server is "uptime", which shows
+Command: The default command executed on each server is "uptime", which shows
 how long the server has been running.
-Call automateTasks: The automateTasks function is called to execute the task
-across all the servers in the list.
+Call automateTasks: The automateTasks function is called to run the command
+sequences across all the servers, then any failures are reported.
 */
 func main() {
+	interactive := flag.String("interactive", "", "Open an interactive shell on this inventory host instead of running commands")
+	forward := flag.String("forward", "", "Forward a local address to a remote one through the -via host, e.g. 127.0.0.1:5432=db.internal:5432")
+	via := flag.String("via", "", "Inventory host whose SSH connection -forward uses")
+	flag.Parse()
+
 	// Define servers
-	servers := []Server{
-		{"192.168.1.1", "22", "user", "password"},
-		{"192.168.1.2", "22", "user", "password"},
+	inventory := Inventory{Groups: []HostGroup{{
+		Name: "default",
+		Servers: []Server{
+			{Host: "192.168.1.1", Port: "22", Username: "user", Password: "password"},
+			{Host: "192.168.1.2", Port: "22", Username: "user", Password: "password"},
+		},
+		// Command to be executed
+		Commands: []string{"uptime"},
+	}}}
+
+	if flag.NArg() > 0 {
+		var err error
+		inventory, err = loadInventory(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("Error loading inventory: %v", err)
+		}
 	}
 
-	// Command to be executed
-	command := "uptime"
+	if *interactive != "" {
+		server, ok := findServer(inventory, *interactive)
+		if !ok {
+			log.Fatalf("Host %s is not in the inventory", *interactive)
+		}
+		if err := interactiveShell(server); err != nil {
+			log.Fatalf("Interactive session on %s failed: %v", server.Host, err)
+		}
+		return
+	}
+
+	if *forward != "" {
+		localAddr, remoteAddr, ok := strings.Cut(*forward, "=")
+		if !ok || localAddr == "" || remoteAddr == "" {
+			log.Fatalf("-forward must be local=remote, e.g. 127.0.0.1:5432=db.internal:5432")
+		}
+		server, ok := findServer(inventory, *via)
+		if !ok {
+			log.Fatalf("-forward needs -via with a host from the inventory, got %q", *via)
+		}
+		client, err := sshConnect(server)
+		if err != nil {
+			log.Fatalf("Failed to connect to %s: %v", server.Host, err)
+		}
+		defer client.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := forwardLocalPort(ctx, client, localAddr, remoteAddr); err != nil {
+			log.Fatalf("Port forwarding through %s failed: %v", server.Host, err)
+		}
+		return
+	}
 
 	// Automate tasks
-	automateTasks(servers, command)
+	failures := automateTasks(inventory)
+	reportFailures(failures)
+	if len(failures) > 0 {
+		os.Exit(1)
+	}
 }